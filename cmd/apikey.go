@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/auth"
+	"github.com/crt379/svc-collector-grpc/internal/config"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/server/tenant"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"go.uber.org/zap"
+)
+
+// apikey create -tenant t -name n [-expire d]
+// apikey list -tenant t
+// apikey revoke -uuid n
+func apikeyCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: apikey create|list|revoke")
+	}
+
+	dao := auth.ApiKeyPgDao{
+		W:      storage.WriteDB,
+		R:      storage.WriteDB,
+		Logger: zap.L(),
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		tname := fs.String("tenant", "", "tenant name")
+		name := fs.String("name", "", "key name, used as the actor")
+		expire := fs.Duration("expire", 0, "expire after, 0 for never")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return fmt.Errorf("-name 不能为空")
+		}
+
+		t, err := findTenant(*tname)
+		if err != nil {
+			return err
+		}
+
+		key, prefix, err := auth.NewApiKey()
+		if err != nil {
+			return err
+		}
+		meta := server.ApiKeyMeta{
+			TenantId:   t.Uuid,
+			Name:       *name,
+			Prefix:     prefix,
+			KeyHash:    auth.HashApiKey(key),
+			CreateTime: types.Time(time.Now()),
+		}
+		if *expire > 0 {
+			at := types.Time(time.Now().Add(*expire))
+			meta.ExpireTime = &at
+		}
+		if meta.Uuid, err = dao.Insert(&meta); err != nil {
+			return err
+		}
+
+		// key 只显示这一次
+		fmt.Printf("uuid: %d\nkey: %s\n", meta.Uuid, key)
+		return nil
+	case "list":
+		fs := flag.NewFlagSet("apikey list", flag.ContinueOnError)
+		tname := fs.String("tenant", "", "tenant name")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		t, err := findTenant(*tname)
+		if err != nil {
+			return err
+		}
+		metas, err := dao.Select(&server.ApiKeyMeta{TenantId: t.Uuid})
+		for _, m := range metas {
+			expire := "-"
+			if m.ExpireTime != nil {
+				expire = m.ExpireTime.String()
+			}
+			fmt.Printf("%d  %s  %s%s_...  %s  %s\n", m.Uuid, m.Name, auth.ApiKeyPrefix, m.Prefix, m.CreateTime, expire)
+		}
+		return err
+	case "revoke":
+		fs := flag.NewFlagSet("apikey revoke", flag.ContinueOnError)
+		uuid := fs.Int("uuid", 0, "key uuid")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		prefix, err := dao.Revoke(*uuid, types.Time(time.Now()))
+		if err != nil {
+			return err
+		}
+
+		// 通知所有实例删除验证过的 key
+		server.Invalidations.Redis = storage.WriteRedis
+		server.Invalidations.Channel = config.AppConfig.Cache.Channel
+		if err = server.Invalidations.Publish(auth.ApiKeyCacheKey(prefix)); err != nil {
+			return fmt.Errorf("已撤销, 通知失败, 最长 %s 后失效: %w", config.AppConfig.Auth.ApiKeyTTL, err)
+		}
+		fmt.Printf("revoked: %d\n", *uuid)
+		return nil
+	}
+
+	return fmt.Errorf("unknown subcommand: %s", args[0])
+}
+
+func findTenant(name string) (t server.TenantMeta, err error) {
+	if name == "" {
+		return t, fmt.Errorf("-tenant 不能为空")
+	}
+
+	dao := tenant.TenantPgDao{
+		W:      storage.WriteDB,
+		R:      storage.WriteDB,
+		Logger: zap.L(),
+	}
+	tenants, err := dao.Select(&server.TenantMeta{Name: name})
+	if err != nil {
+		return t, err
+	}
+	if len(tenants) == 0 {
+		return t, fmt.Errorf("tenant: %s 不存在", name)
+	}
+
+	return tenants[0], nil
+}
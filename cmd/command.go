@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var commands = map[string]func(args []string) error{
+	"migrate": migrateCommand,
+	"jdata":   jdataCommand,
+	"apikey":  apikeyCommand,
+	"role":    roleCommand,
+}
+
+// 执行子命令, 返回进程退出码
+func runCommand(args []string) int {
+	f, ok := commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "unknown command: %s, available: %s\n", args[0], strings.Join(names, ", "))
+		return 2
+	}
+
+	if err := f(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err.Error())
+		return 1
+	}
+
+	return 0
+}
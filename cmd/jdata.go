@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/crt379/svc-collector-grpc/internal/server/jdata"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// jdata gc [-dry-run] [-batch n]
+// jdata rehash [-hash-type t] [-dry-run] [-batch n]
+func jdataCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: jdata gc|rehash [-dry-run] [-batch n]")
+	}
+
+	dao := jdata.JdataPgDao{
+		W:      storage.WriteDB,
+		R:      storage.WriteDB,
+		Logger: zap.L(),
+	}
+
+	switch args[0] {
+	case "gc":
+		fs := flag.NewFlagSet("jdata gc", flag.ContinueOnError)
+		dryrun := fs.Bool("dry-run", false, "only report orphans")
+		batch := fs.Int("batch", 0, "rows per delete statement")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		sweeper := jdata.Sweeper{
+			Dao:    &dao,
+			Batch:  *batch,
+			DryRun: *dryrun,
+			Logger: zap.L(),
+		}
+		result, err := sweeper.Sweep(context.Background())
+		for _, o := range result.Sample {
+			fmt.Printf("%d  %s  %s  %s\n", o.Uuid, o.HashType, o.HashValue, o.UpdateTime)
+		}
+		fmt.Printf("orphans: %d, purged: %d\n", result.Orphans, result.Purged)
+		return err
+	case "rehash":
+		fs := flag.NewFlagSet("jdata rehash", flag.ContinueOnError)
+		hashtype := fs.String("hash-type", jdata.HashType(), "target hash type: "+strings.Join(jdata.HashTypes(), ", "))
+		dryrun := fs.Bool("dry-run", false, "only report changes")
+		batch := fs.Int("batch", 0, "rows per select statement")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		rehasher := jdata.Rehasher{
+			DB:       storage.WriteDB,
+			HashType: *hashtype,
+			Batch:    *batch,
+			DryRun:   *dryrun,
+			Logger:   zap.L(),
+		}
+		result, err := rehasher.Rehash(context.Background())
+		fmt.Printf(
+			"scanned: %d, rehashed: %d, merged: %d, removed examples: %d\n",
+			result.Scanned, result.Rehashed, result.Merged, result.Removed,
+		)
+		return err
+	}
+
+	return fmt.Errorf("unknown subcommand: %s", args[0])
+}
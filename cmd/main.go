@@ -2,67 +2,147 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"syscall"
 
+	"github.com/crt379/svc-collector-grpc/internal/auth"
 	"github.com/crt379/svc-collector-grpc/internal/config"
 	"github.com/crt379/svc-collector-grpc/internal/interceptor"
+	"github.com/crt379/svc-collector-grpc/internal/limit"
 	"github.com/crt379/svc-collector-grpc/internal/logging"
+	"github.com/crt379/svc-collector-grpc/internal/migration"
+	"github.com/crt379/svc-collector-grpc/internal/server"
 	"github.com/crt379/svc-collector-grpc/internal/server/appapi"
 	"github.com/crt379/svc-collector-grpc/internal/server/application"
 	"github.com/crt379/svc-collector-grpc/internal/server/appproc"
 	"github.com/crt379/svc-collector-grpc/internal/server/appsvc"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
+	"github.com/crt379/svc-collector-grpc/internal/server/history"
+	"github.com/crt379/svc-collector-grpc/internal/server/jdata"
+	"github.com/crt379/svc-collector-grpc/internal/server/job"
+	"github.com/crt379/svc-collector-grpc/internal/server/outbox"
 	"github.com/crt379/svc-collector-grpc/internal/server/processor"
 	"github.com/crt379/svc-collector-grpc/internal/server/register"
 	"github.com/crt379/svc-collector-grpc/internal/server/service"
 	"github.com/crt379/svc-collector-grpc/internal/server/svcapi"
 	"github.com/crt379/svc-collector-grpc/internal/server/svcapieg"
 	"github.com/crt379/svc-collector-grpc/internal/server/tenant"
+	"github.com/crt379/svc-collector-grpc/internal/server/trash"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
 
 	"github.com/oklog/run"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
 )
 
 func main() {
 	defer logging.LoggerSync()
 
+	if args := flag.Args(); len(args) > 0 {
+		code := runCommand(args)
+		logging.LoggerSync()
+		os.Exit(code)
+	}
+
 	logger := zap.L()
 	logger.Info("starting")
 
+	if config.AppConfig.PgSql.Migrate {
+		m := migration.Migrator{
+			DB:     storage.WriteDB,
+			Logger: logger,
+		}
+		n, err := m.Up(context.Background())
+		if err != nil {
+			logger.Error("migrate up error", zap.String("error", err.Error()))
+			os.Exit(1)
+		}
+		logger.Info("migrate up", zap.Int("applied", n))
+	}
+
 	zlogger := logging.NewZapLogger(logger)
 	grpclog.SetLoggerV2(zlogger)
 
 	panicsTotal := promauto.NewCounter(interceptor.PanicsTotal)
 
+	unary := []grpc.UnaryServerInterceptor{
+		interceptor.UnaryMeta,
+		interceptor.UnaryTrace,
+		interceptor.UnaryActor,
+		interceptor.UnaryTraceSpanLog,
+		interceptor.UnaryLatency,
+		interceptor.UnaryReqRepLog,
+		interceptor.WithUnaryPrometheus(),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		interceptor.StreamMeta,
+		interceptor.StreamTrace,
+		interceptor.StreamActor,
+		interceptor.StreamTraceSpanLog,
+		interceptor.StreamLatency,
+		interceptor.StreamHandlerLog,
+		interceptor.WithStreamPrometheus(),
+	}
+	if config.AppConfig.Rbac.Enabled && !config.AppConfig.Auth.Enabled {
+		logger.Error("rbac requires auth enabled")
+		os.Exit(1)
+	}
+	if config.AppConfig.Auth.Enabled {
+		authenticator := newAuthenticator(logger)
+		unary = append(unary, interceptor.WithUnaryAuth(authenticator))
+		stream = append(stream, interceptor.WithStreamAuth(authenticator))
+	}
+	if config.AppConfig.Rbac.Enabled {
+		authorizer := &auth.Authorizer{
+			Policy: &auth.Policy{Path: config.AppConfig.Rbac.Policy},
+			Logger: logger,
+		}
+		if err := authorizer.Policy.Check(); err != nil {
+			logger.Error("rbac policy error", zap.String("error", err.Error()))
+			os.Exit(1)
+		}
+		unary = append(unary, interceptor.WithUnaryAuthz(authorizer))
+		stream = append(stream, interceptor.WithStreamAuthz(authorizer))
+	}
+	if config.AppConfig.Limit.Enabled {
+		limiter := &limit.Limiter{Rules: config.AppConfig.Limit.Rules}
+		unary = append(unary, interceptor.WithUnaryLimit(limiter))
+		stream = append(stream, interceptor.WithStreamLimit(limiter))
+	}
+	unary = append(unary, interceptor.FWithUnaryRecovery(panicsTotal.Inc))
+	stream = append(stream, interceptor.FWithStreamRecovery(panicsTotal.Inc))
+
 	opts := []grpc.ServerOption{
-		grpc.ChainUnaryInterceptor(
-			interceptor.UnaryMeta,
-			interceptor.UnaryTrace,
-			interceptor.UnaryTraceSpanLog,
-			interceptor.UnaryLatency,
-			interceptor.UnaryReqRepLog,
-			interceptor.WithUnaryPrometheus(),
-			interceptor.FWithUnaryRecovery(panicsTotal.Inc),
-		),
-		grpc.ChainStreamInterceptor(
-			interceptor.StreamMeta,
-			interceptor.StreamTrace,
-			interceptor.StreamTraceSpanLog,
-			interceptor.StreamLatency,
-			interceptor.StreamHandlerLog,
-			interceptor.WithStreamPrometheus(),
-			interceptor.FWithStreamRecovery(panicsTotal.Inc),
-		),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
 		grpc.UnknownServiceHandler(interceptor.UnknownServiceHandler),
 	}
 
+	var tlsReloader *auth.TLSReloader
+	if config.AppConfig.TLS.Enabled {
+		var err error
+		if tlsReloader, err = newTLSReloader(logger); err != nil {
+			logger.Error("tls error", zap.String("error", err.Error()))
+			os.Exit(1)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsReloader.TLSConfig("h2"))))
+	}
+
+	// 每个实例都读取 stream, 发布由启用 outbox 的实例进行
+	hub := &outbox.Hub{
+		Redis:  storage.WriteRedis,
+		Stream: config.AppConfig.Outbox.Stream,
+		Logger: logger,
+	}
+
 	srv := grpc.NewServer(opts...)
 	tenant.RegisterServer(srv)
 	service.RegisterServer(srv)
@@ -70,10 +150,24 @@ func main() {
 	svcapieg.RegisterServer(srv)
 	application.RegisterServer(srv)
 	appsvc.RegisterServer(srv)
-	register.RegisterServer(srv)
+	if config.AppConfig.Register.Secret == "" {
+		logger.Warn("register secret is empty, Register and Unregister are disabled")
+	}
+	register.RegisterServer(srv, &register.Verifier{
+		Secret:      config.AppConfig.Register.Secret,
+		MaxFailures: config.AppConfig.Register.MaxFailures,
+		Window:      config.AppConfig.Register.Window,
+		Logger:      logger,
+	})
 	processor.RegisterServer(srv)
 	appapi.RegisterServer(srv)
 	appproc.RegisterServer(srv)
+	appapi.RegisterWatchServer(srv, hub)
+	appproc.RegisterWatchServer(srv, hub)
+	job.RegisterServer(srv)
+	trash.RegisterServer(srv)
+	audit.RegisterServer(srv, tenant.CheckByMeta)
+	history.RegisterServer(srv)
 
 	g := &run.Group{}
 
@@ -99,6 +193,10 @@ func main() {
 		httpSrv.Handler = m
 		logger.Info("starting HTTP server addr: " + httpaddr)
 
+		if tlsReloader != nil && config.AppConfig.TLS.Metrics {
+			httpSrv.TLSConfig = tlsReloader.TLSConfig("h2", "http/1.1")
+			return httpSrv.ListenAndServeTLS("", "")
+		}
 		return httpSrv.ListenAndServe()
 	}, func(error) {
 		if err := httpSrv.Close(); err != nil {
@@ -122,6 +220,130 @@ func main() {
 		close(c)
 	})
 
+	if config.AppConfig.Jdata.GC.Enabled {
+		sweeper := jdata.Sweeper{
+			Dao: &jdata.JdataPgDao{
+				W:      storage.WriteDB,
+				R:      storage.ReadDB,
+				Logger: logger,
+			},
+			Interval: config.AppConfig.Jdata.GC.Interval,
+			Batch:    config.AppConfig.Jdata.GC.Batch,
+			DryRun:   config.AppConfig.Jdata.GC.DryRun,
+			Logger:   logger,
+		}
+		sctx, scancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger.Info("starting jdata sweeper")
+			return sweeper.Run(sctx)
+		}, func(error) {
+			scancel()
+		})
+	}
+
+	if config.AppConfig.Job.Enabled {
+		runner := job.Runner{
+			Dao: &job.JobPgDao{
+				W:      storage.WriteDB,
+				R:      storage.WriteDB,
+				Logger: logger,
+			},
+			Handlers: map[string]job.Handler{
+				tenant.DeleteJobKind: tenant.DeleteJob,
+			},
+			Interval: config.AppConfig.Job.Interval,
+			Stale:    config.AppConfig.Job.Stale,
+			Logger:   logger,
+		}
+		jctx, jcancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger.Info("starting job runner")
+			return runner.Run(jctx)
+		}, func(error) {
+			jcancel()
+		})
+	}
+
+	if config.AppConfig.Trash.Enabled {
+		purger := trash.Purger{
+			DB:               storage.WriteDB,
+			Retention:        config.AppConfig.Trash.Retention,
+			HistoryRetention: config.AppConfig.Trash.HistoryRetention,
+			Interval:         config.AppConfig.Trash.Interval,
+			Batch:            config.AppConfig.Trash.Batch,
+			Logger:           logger,
+		}
+		pctx, pcancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger.Info("starting trash purger")
+			return purger.Run(pctx)
+		}, func(error) {
+			pcancel()
+		})
+	}
+
+	if config.AppConfig.Outbox.Enabled {
+		relay := outbox.Relay{
+			DB:        storage.WriteDB,
+			Redis:     storage.WriteRedis,
+			Stream:    config.AppConfig.Outbox.Stream,
+			MaxLen:    config.AppConfig.Outbox.MaxLen,
+			Interval:  config.AppConfig.Outbox.Interval,
+			Batch:     config.AppConfig.Outbox.Batch,
+			Retention: config.AppConfig.Outbox.Retention,
+			Logger:    logger,
+		}
+		octx, ocancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger.Info("starting outbox relay")
+			return relay.Run(octx)
+		}, func(error) {
+			ocancel()
+		})
+	}
+
+	server.Invalidations.Redis = storage.WriteRedis
+	server.Invalidations.Channel = config.AppConfig.Cache.Channel
+	server.Invalidations.Logger = logger
+	ictx, icancel := context.WithCancel(context.Background())
+	g.Add(func() error {
+		logger.Info("starting cache invalidation")
+		return server.Invalidations.Run(ictx)
+	}, func(error) {
+		icancel()
+	})
+
+	if config.AppConfig.Cache.Reconcile > 0 {
+		reconciler := server.TenantReconciler{
+			Dao: &tenant.TenantPgDao{
+				W:      storage.WriteDB,
+				R:      storage.WriteDB,
+				Logger: logger,
+			},
+			Cache: &server.TenantCache{
+				R: storage.ReadRedis,
+				W: storage.WriteRedis,
+			},
+			Interval: config.AppConfig.Cache.Reconcile,
+			Logger:   logger,
+		}
+		rctx, rcancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			logger.Info("starting tenant cache reconciler")
+			return reconciler.Run(rctx)
+		}, func(error) {
+			rcancel()
+		})
+	}
+
+	hctx, hcancel := context.WithCancel(context.Background())
+	g.Add(func() error {
+		logger.Info("starting outbox hub")
+		return hub.Run(hctx)
+	}, func(error) {
+		hcancel()
+	})
+
 	g.Add(run.SignalHandler(context.Background(), syscall.SIGINT, syscall.SIGTERM))
 
 	if err := g.Run(); err != nil {
@@ -129,3 +351,52 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func newAuthenticator(logger *zap.Logger) *auth.Authenticator {
+	a := &auth.Authenticator{
+		ApiKeys: &auth.ApiKeys{
+			DB:     storage.ReadDB,
+			TTL:    config.AppConfig.Auth.ApiKeyTTL,
+			Logger: logger,
+		},
+		Skip:   config.AppConfig.Auth.Skip,
+		Logger: logger,
+	}
+	if config.AppConfig.Auth.Jwks != "" {
+		a.Jwt = &auth.JwtVerifier{
+			Keys:        &auth.JWKS{Path: config.AppConfig.Auth.Jwks},
+			Issuer:      config.AppConfig.Auth.Issuer,
+			Audience:    config.AppConfig.Auth.Audience,
+			TenantClaim: config.AppConfig.Auth.TenantClaim,
+			Leeway:      config.AppConfig.Auth.Leeway,
+		}
+	}
+	if config.AppConfig.TLS.Enabled && config.AppConfig.Auth.CertTenantPrefix != "" {
+		a.Cert = &auth.CertIdentity{TenantPrefix: config.AppConfig.Auth.CertTenantPrefix}
+	}
+	if config.AppConfig.Rbac.Enabled {
+		a.Roles = &auth.RoleBindings{
+			DB:     storage.ReadDB,
+			TTL:    config.AppConfig.Rbac.TTL,
+			Logger: logger,
+		}
+	}
+
+	return a
+}
+
+func newTLSReloader(logger *zap.Logger) (*auth.TLSReloader, error) {
+	clientAuth, err := auth.ParseClientAuth(config.AppConfig.TLS.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &auth.TLSReloader{
+		Cert:       config.AppConfig.TLS.Cert,
+		Key:        config.AppConfig.TLS.Key,
+		CA:         config.AppConfig.TLS.CA,
+		ClientAuth: clientAuth,
+		Logger:     logger,
+	}
+	return r, r.Load()
+}
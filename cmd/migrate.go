@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/crt379/svc-collector-grpc/internal/migration"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// migrate up|down [n]|status
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [n]|status")
+	}
+
+	ctx := context.Background()
+	m := migration.Migrator{
+		DB:     storage.WriteDB,
+		Logger: zap.L(),
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		fmt.Printf("applied %d migrations\n", n)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid steps: %s", args[1])
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		fmt.Printf("rolled back %d migrations\n", n)
+		return err
+	case "status":
+		ss, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range ss {
+			applied := "pending"
+			if s.Applied {
+				applied = s.ApplyTime.String()
+			}
+			fmt.Printf("%04d  %-24s  %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown subcommand: %s", args[0])
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/auth"
+	"github.com/crt379/svc-collector-grpc/internal/config"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"go.uber.org/zap"
+)
+
+// role bind -tenant t -principal p -role r
+// role unbind -tenant t -principal p -role r
+// role list -tenant t [-principal p]
+func roleCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: role bind|unbind|list")
+	}
+
+	dao := auth.RoleBindingPgDao{
+		W:      storage.WriteDB,
+		R:      storage.WriteDB,
+		Logger: zap.L(),
+	}
+
+	fs := flag.NewFlagSet("role "+args[0], flag.ContinueOnError)
+	tname := fs.String("tenant", "", "principal 所属的 tenant")
+	principal := fs.String("principal", "", "api key 为 apikey:<name>, jwt 为 sub")
+	role := fs.String("role", "", "role name")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	t, err := findTenant(*tname)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "bind", "unbind":
+		if *principal == "" || *role == "" {
+			return fmt.Errorf("-principal 和 -role 不能为空")
+		}
+		meta := server.RoleBindingMeta{
+			TenantId:   t.Uuid,
+			Principal:  *principal,
+			Role:       *role,
+			CreateTime: types.Time(time.Now()),
+		}
+
+		if args[0] == "bind" {
+			policy := auth.Policy{Path: config.AppConfig.Rbac.Policy}
+			ok, err := policy.HasRole(*role)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("policy 中没有角色: %s", *role)
+			}
+			if meta.Uuid, err = dao.Insert(&meta); err != nil {
+				return err
+			}
+		} else {
+			n, err := dao.Delete(&meta)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("没有绑定")
+			}
+		}
+
+		// 通知所有实例删除查询过的角色
+		server.Invalidations.Redis = storage.WriteRedis
+		server.Invalidations.Channel = config.AppConfig.Cache.Channel
+		if err = server.Invalidations.Publish(auth.RoleCacheKey(t.Name, *principal)); err != nil {
+			return fmt.Errorf("已修改, 通知失败, 最长 %s 后生效: %w", config.AppConfig.Rbac.TTL, err)
+		}
+		fmt.Printf("%s: %s %s %s\n", args[0], t.Name, *principal, *role)
+		return nil
+	case "list":
+		metas, err := dao.Select(&server.RoleBindingMeta{TenantId: t.Uuid, Principal: *principal})
+		for _, m := range metas {
+			fmt.Printf("%s  %s  %s\n", m.Principal, m.Role, m.CreateTime)
+		}
+		return err
+	}
+
+	return fmt.Errorf("unknown subcommand: %s", args[0])
+}
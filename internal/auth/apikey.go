@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// api key 的格式为 sck_<prefix>_<secret>, prefix 用于查找
+	ApiKeyPrefix = "sck_"
+
+	MethodApiKey = "apikey"
+
+	defaultApiKeyTTL = time.Minute
+)
+
+// 验证过的 api key, 撤销时通过 server.Invalidations 删除
+var apiKeyCache = server.NewLocalStore()
+
+func init() {
+	server.Invalidations.Register(apiKeyCache)
+}
+
+func ApiKeyCacheKey(prefix string) string {
+	return "apikey:" + prefix
+}
+
+// 生成新的 key, 只在创建时返回一次
+func NewApiKey() (key string, prefix string, err error) {
+	b := make([]byte, 4+32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	prefix = hex.EncodeToString(b[:4])
+	key = ApiKeyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[4:])
+
+	return key, prefix, nil
+}
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func IsApiKey(s string) bool {
+	return strings.HasPrefix(s, ApiKeyPrefix)
+}
+
+func apiKeyPrefix(key string) (string, bool) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(key, ApiKeyPrefix), "_")
+	return prefix, ok && prefix != ""
+}
+
+// 按 prefix 查找 key 并比较 sha256
+type ApiKeys struct {
+	DB server.DB
+	// 验证过的 key 在进程内保留的时间, <= 0 时为 1 分钟
+	TTL    time.Duration
+	Logger *zap.Logger
+}
+
+func (k *ApiKeys) ttl() time.Duration {
+	if k.TTL <= 0 {
+		return defaultApiKeyTTL
+	}
+	return k.TTL
+}
+
+func (k *ApiKeys) lookup(prefix string) (meta server.ApiKeyMeta, found bool, err error) {
+	ckey := ApiKeyCacheKey(prefix)
+	if buf, ok := apiKeyCache.Get(ckey); ok {
+		err = json.Unmarshal(buf, &meta)
+		return meta, err == nil, err
+	}
+
+	dao := ApiKeyPgDao{W: k.DB, R: k.DB, Logger: k.Logger}
+	var metas []server.ApiKeyMeta
+	if metas, err = dao.Select(&server.ApiKeyMeta{Prefix: prefix}); err != nil || len(metas) == 0 {
+		return meta, false, err
+	}
+	meta = metas[0]
+
+	var buf []byte
+	if buf, err = json.Marshal(&meta); err == nil {
+		apiKeyCache.Set(ckey, buf, k.ttl())
+	}
+
+	return meta, true, nil
+}
+
+func (k *ApiKeys) Verify(key string) (id ctxvalue.Identity, err error) {
+	prefix, ok := apiKeyPrefix(key)
+	if !ok {
+		return id, ErrInvalidCredential
+	}
+
+	meta, found, err := k.lookup(prefix)
+	if err != nil {
+		return id, err
+	}
+	if !found || subtle.ConstantTimeCompare([]byte(HashApiKey(key)), []byte(meta.KeyHash)) != 1 {
+		return id, ErrInvalidCredential
+	}
+	if meta.ExpireTime != nil && time.Now().After(time.Time(*meta.ExpireTime)) {
+		return id, fmt.Errorf("%w: api key 已经过期", ErrInvalidCredential)
+	}
+
+	return ctxvalue.Identity{
+		Tenant:  meta.TenantName,
+		Subject: "apikey:" + meta.Name,
+		Method:  MethodApiKey,
+	}, nil
+}
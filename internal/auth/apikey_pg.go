@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	table       = "api_key"
+	tenantTable = "tenant"
+)
+
+var (
+	_fields = [...]string{"uuid", "tenant_id", "name", "prefix", "key_hash", "create_time", "expire_time", "revoke_time"}
+)
+
+type ApiKeyPgDao struct {
+	W      server.DB
+	R      server.DB
+	Logger *zap.Logger
+	server.Dao
+	server.DaoLog
+}
+
+func (d *ApiKeyPgDao) Table() string {
+	return table
+}
+
+func (d *ApiKeyPgDao) fields() []string {
+	fs := make([]string, 0, len(_fields)+1)
+	for _, f := range _fields {
+		fs = append(fs, d.Field(d.Table(), f))
+	}
+	return append(fs, d.FieldAs(tenantTable, "name", "tenant_name"))
+}
+
+func (d *ApiKeyPgDao) Insert(meta *server.ApiKeyMeta) (uuid int, err error) {
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:7]...).
+		Values(meta.TenantId, meta.Name, meta.Prefix, meta.KeyHash, meta.CreateTime, meta.ExpireTime).
+		Returning("uuid").
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.W.QueryRowx(query, args...).Scan(&uuid)
+
+	return uuid, err
+}
+
+// 按 uuid, tenant 或 prefix 查询, 只包含没有撤销且 tenant 没有被删除的 key
+func (d *ApiKeyPgDao) Select(meta *server.ApiKeyMeta, ops ...server.DaoOption) (objs []server.ApiKeyMeta, err error) {
+	cs := []server.Cond{
+		server.IsNull(d.Field(d.Table(), "revoke_time")),
+		server.IsNull(d.Field(tenantTable, server.DeletedAtCol)),
+	}
+
+	if meta.Uuid != 0 {
+		cs = append(cs, server.Eq(d.Field(d.Table(), "uuid"), meta.Uuid))
+	}
+	if meta.TenantId != 0 {
+		cs = append(cs, server.Eq(d.Field(d.Table(), "tenant_id"), meta.TenantId))
+	}
+	if meta.Prefix != "" {
+		cs = append(cs, server.Eq(d.Field(d.Table(), "prefix"), meta.Prefix))
+	}
+
+	query, args := server.Select(d.fields()...).
+		From(d.Table()).
+		Join(tenantTable, server.EqCol(d.Field(d.Table(), "tenant_id"), d.Field(tenantTable, "uuid"))).
+		Where(cs...).
+		OrderBy(d.Field(d.Table(), "uuid")).
+		Options(ops...).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var rows *sqlx.Rows
+	rows, err = d.R.Queryx(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	err = server.RowsToStructs(&objs, rows)
+
+	return objs, err
+}
+
+// 撤销后不能再使用, 没有可以撤销的 key 时返回 sql.ErrNoRows
+func (d *ApiKeyPgDao) Revoke(uuid int, at types.Time) (prefix string, err error) {
+	query, args := server.Update(d.Table()).
+		Set("revoke_time", at).
+		Where(server.Eq("uuid", uuid), server.IsNull("revoke_time")).
+		Returning("prefix").
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.W.QueryRowx(query, args...).Scan(&prefix)
+
+	return prefix, err
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	jsoniter "github.com/json-iterator/go"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	AuthorizationKey = "authorization"
+	ApiKeyKey        = "x-api-key"
+	TenantKey        = "x-access-tenant"
+	ActorKey         = "x-access-actor"
+)
+
+// 凭证无效, 返回 Unauthenticated
+var ErrInvalidCredential = errors.New("凭证无效")
+
+// 从 authorization: Bearer <jwt|api key>, x-api-key 或客户端证书得到身份, 身份的 tenant 写入 x-access-tenant.
+// 请求的 x-access-tenant 与身份不一致时拒绝
+type Authenticator struct {
+	ApiKeys *ApiKeys
+	// 为 nil 时不接受 jwt
+	Jwt *JwtVerifier
+	// 为 nil 时不使用客户端证书; 请求中有其他凭证时优先使用其他凭证
+	Cert *CertIdentity
+	// 为 nil 时不查询角色; super-admin 可以通过 x-access-tenant 访问其他 tenant
+	Roles *RoleBindings
+	// 不需要认证的方法, 以 "/" 结尾时为 service 的所有方法
+	Skip   []string
+	Logger *zap.Logger
+}
+
+func (a *Authenticator) skip(method string) bool {
+	for _, s := range a.Skip {
+		if s == method || (strings.HasSuffix(s, "/") && strings.HasPrefix(method, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func credential(md metadata.MD) (string, bool) {
+	if v := md.Get(ApiKeyKey); len(v) > 0 && v[0] != "" {
+		return v[0], true
+	}
+	if v := md.Get(AuthorizationKey); len(v) > 0 {
+		scheme, token, ok := strings.Cut(v[0], " ")
+		if ok && strings.EqualFold(scheme, "bearer") && token != "" {
+			return strings.TrimSpace(token), true
+		}
+	}
+	return "", false
+}
+
+func (a *Authenticator) identify(cred string) (ctxvalue.Identity, error) {
+	if IsApiKey(cred) {
+		return a.ApiKeys.Verify(cred)
+	}
+	if a.Jwt == nil {
+		return ctxvalue.Identity{}, ErrInvalidCredential
+	}
+	return a.Jwt.Verify(cred)
+}
+
+// 返回带有身份的 context. 身份的 subject 作为操作者, 覆盖 x-access-actor
+func (a *Authenticator) Authenticate(ctx context.Context, method string) (context.Context, error) {
+	if a.skip(method) {
+		return ctx, nil
+	}
+
+	md := metadata.MD{}
+	pmd, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if ok {
+		md = pmd.Copy()
+	}
+
+	var id ctxvalue.Identity
+	var err error
+	if cred, ok := credential(md); ok {
+		if id, err = a.identify(cred); err != nil {
+			if errors.Is(err, ErrInvalidCredential) {
+				return ctx, status.Error(codes.Unauthenticated, err.Error())
+			}
+			a.Logger.Warn("authenticate err", zap.String("error", err.Error()))
+			return ctx, server.InternalErr("认证失败")
+		}
+	} else if a.Cert != nil {
+		if id, ok = a.Cert.Identify(ctx); !ok {
+			return ctx, status.Error(codes.Unauthenticated, "没有凭证")
+		}
+	} else {
+		return ctx, status.Error(codes.Unauthenticated, "没有凭证")
+	}
+
+	if a.Roles != nil {
+		if id.Roles, err = a.Roles.Roles(id.Tenant, id.Subject); err != nil {
+			a.Logger.Warn("roles err", zap.String("error", err.Error()))
+			return ctx, server.InternalErr("认证失败")
+		}
+	}
+
+	if v := md.Get(TenantKey); len(v) > 0 && v[0] != id.Tenant {
+		if !isSuperAdmin(id.Roles) {
+			return ctx, status.Errorf(codes.PermissionDenied, "凭证不属于 tenant: %s", v[0])
+		}
+	} else {
+		md.Set(TenantKey, id.Tenant)
+	}
+	md.Set(ActorKey, id.Subject)
+
+	ctx = ctxvalue.GrpcMetaContext{}.NewContext(ctx, &md)
+	ctx = ctxvalue.IdentityContext{}.NewContext(ctx, &id)
+	ctx = ctxvalue.ActorContext{}.NewContext(ctx, &id.Subject)
+
+	return ctx, nil
+}
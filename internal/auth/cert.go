@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const MethodCert = "mtls"
+
+// 从验证过的客户端证书得到身份. URI SAN 以 TenantPrefix 开头时, 之后的部分为 tenant,
+// 如 TenantPrefix 为 spiffe://svc-collector/tenant/ 时 spiffe://svc-collector/tenant/t1 的 tenant 为 t1.
+// subject 为 cert:<CN>
+type CertIdentity struct {
+	TenantPrefix string
+}
+
+// 没有验证过的客户端证书或证书中没有 tenant 时返回 false
+func (c *CertIdentity) Identify(ctx context.Context) (id ctxvalue.Identity, ok bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return id, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return id, false
+	}
+	leaf := info.State.VerifiedChains[0][0]
+
+	for _, u := range leaf.URIs {
+		tenant, found := strings.CutPrefix(u.String(), c.TenantPrefix)
+		if !found || tenant == "" || strings.Contains(tenant, "/") {
+			continue
+		}
+		subject := leaf.Subject.CommonName
+		if subject == "" {
+			subject = u.String()
+		}
+		return ctxvalue.Identity{Tenant: tenant, Subject: "cert:" + subject, Method: MethodCert}, true
+	}
+
+	return id, false
+}
@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+)
+
+const (
+	MethodJwt = "jwt"
+
+	DefaultTenantClaim = "tenant"
+	// jwks 文件修改后最长的生效时间
+	jwksCheckInterval = 10 * time.Second
+)
+
+// ES 的 alg 对应的曲线
+var esCurves = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC 和 OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBig(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBig(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBig(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的 crv: %s", k.Crv)
+		}
+		x, err := decodeBig(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBig(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("不支持的 crv: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("ed25519 key 长度错误")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("不支持的 kty: %s", k.Kty)
+}
+
+// 本地的 jwks 文件, 文件修改后重新读取
+type JWKS struct {
+	Path string
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	modTime time.Time
+	checked time.Time
+}
+
+func (s *JWKS) load() error {
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		return err
+	}
+	if s.keys != nil && fi.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	buf, err := os.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(buf, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i := range set.Keys {
+		k := &set.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pk, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("jwks kid %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = pk
+	}
+
+	s.keys, s.modTime = keys, fi.ModTime()
+	return nil
+}
+
+// kid 为空且只有一个 key 时使用该 key
+func (s *JWKS) Key(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil || time.Since(s.checked) >= jwksCheckInterval {
+		s.checked = time.Now()
+		if err := s.load(); err != nil && s.keys == nil {
+			return nil, err
+		}
+	}
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, nil
+		}
+	}
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: 未知的 kid %s", ErrInvalidCredential, kid)
+	}
+	return k, nil
+}
+
+// 验证 jwt 的签名和 exp, nbf, iss, aud, 从 TenantClaim 得到 tenant
+type JwtVerifier struct {
+	Keys *JWKS
+	// 为空时不检查
+	Issuer   string
+	Audience string
+	// 为空时为 DefaultTenantClaim
+	TenantClaim string
+	// 时间的误差
+	Leeway time.Duration
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (v *JwtVerifier) tenantClaim() string {
+	if v.TenantClaim == "" {
+		return DefaultTenantClaim
+	}
+	return v.TenantClaim
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+	default:
+		// 不接受 none 和 HS*
+		return fmt.Errorf("不支持的 alg: %s", alg)
+	}
+
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	ok := false
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			ok = rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil
+		case "PS":
+			ok = rsa.VerifyPSS(k, hash, digest, sig, nil) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if esCurves[alg] == k.Curve.Params().Name && len(sig) == 2*size {
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			ok = ecdsa.Verify(k, digest, r, s)
+		}
+	case ed25519.PublicKey:
+		ok = alg == "EdDSA" && ed25519.Verify(k, signed, sig)
+	}
+	if !ok {
+		return fmt.Errorf("签名错误")
+	}
+
+	return nil
+}
+
+func (v *JwtVerifier) Verify(token string) (id ctxvalue.Identity, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return id, fmt.Errorf("%w: jwt 格式错误", ErrInvalidCredential)
+	}
+
+	var header jwtHeader
+	if err = decodeSegment(parts[0], &header); err != nil {
+		return id, fmt.Errorf("%w: jwt header: %s", ErrInvalidCredential, err.Error())
+	}
+
+	key, err := v.Keys.Key(header.Kid)
+	if err != nil {
+		return id, err
+	}
+
+	var sig []byte
+	if sig, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return id, fmt.Errorf("%w: jwt signature: %s", ErrInvalidCredential, err.Error())
+	}
+	if err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return id, fmt.Errorf("%w: %s", ErrInvalidCredential, err.Error())
+	}
+
+	var claims map[string]any
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return id, fmt.Errorf("%w: jwt claims: %s", ErrInvalidCredential, err.Error())
+	}
+	if err = v.checkClaims(claims); err != nil {
+		return id, fmt.Errorf("%w: %s", ErrInvalidCredential, err.Error())
+	}
+
+	tenant, _ := claims[v.tenantClaim()].(string)
+	if tenant == "" {
+		return id, fmt.Errorf("%w: jwt 没有 %s", ErrInvalidCredential, v.tenantClaim())
+	}
+	sub, _ := claims["sub"].(string)
+
+	return ctxvalue.Identity{Tenant: tenant, Subject: sub, Method: MethodJwt}, nil
+}
+
+func (v *JwtVerifier) checkClaims(claims map[string]any) error {
+	now := time.Now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("jwt 没有 exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.Leeway)) {
+		return fmt.Errorf("jwt 已经过期")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("jwt 还没有生效")
+	}
+
+	if v.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.Issuer {
+			return fmt.Errorf("jwt iss 不匹配")
+		}
+	}
+
+	if v.Audience != "" {
+		// aud 可以是字符串或数组
+		match := false
+		switch aud := claims["aud"].(type) {
+		case string:
+			match = aud == v.Audience
+		case []any:
+			for _, a := range aud {
+				if s, _ := a.(string); s == v.Audience {
+					match = true
+				}
+			}
+		}
+		if !match {
+			return fmt.Errorf("jwt aud 不匹配")
+		}
+	}
+
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	buf, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
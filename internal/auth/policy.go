@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// 所有 tenant 的所有方法, 不需要在 policy 中配置
+	RoleSuperAdmin = "super-admin"
+
+	// policy 文件修改后最长的生效时间
+	policyCheckInterval = 10 * time.Second
+)
+
+type rolePolicy struct {
+	// 包含其他角色的方法
+	Inherits []string `toml:"inherits"`
+	// 使用 path.Match 匹配 FullMethod, 如 "/service.collector.*/Get"
+	Methods []string `toml:"methods"`
+}
+
+// 本地的 policy 文件, 配置每个角色可以调用的方法, 文件修改后重新读取
+type Policy struct {
+	Path string
+
+	mu      sync.Mutex
+	roles   map[string][]string
+	modTime time.Time
+	checked time.Time
+}
+
+func parsePolicy(file string) (map[string][]string, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("toml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var p struct {
+		Roles map[string]rolePolicy `toml:"roles"`
+	}
+	if err := v.Unmarshal(&p); err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string][]string, len(p.Roles))
+	var expand func(name string, seen map[string]bool) ([]string, error)
+	expand = func(name string, seen map[string]bool) ([]string, error) {
+		r, ok := p.Roles[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的角色: %s", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("角色循环继承: %s", name)
+		}
+		seen[name] = true
+		defer delete(seen, name)
+
+		methods := append([]string{}, r.Methods...)
+		for _, in := range r.Inherits {
+			ms, err := expand(in, seen)
+			if err != nil {
+				return nil, err
+			}
+			methods = append(methods, ms...)
+		}
+		return methods, nil
+	}
+
+	for name := range p.Roles {
+		if name == RoleSuperAdmin {
+			return nil, fmt.Errorf("%s 不能在 policy 中配置", RoleSuperAdmin)
+		}
+		methods, err := expand(name, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range methods {
+			if _, err = path.Match(m, ""); err != nil {
+				return nil, fmt.Errorf("角色 %s 的方法 %s: %w", name, m, err)
+			}
+		}
+		roles[name] = methods
+	}
+
+	return roles, nil
+}
+
+func (p *Policy) load() error {
+	fi, err := os.Stat(p.Path)
+	if err != nil {
+		return err
+	}
+	if p.roles != nil && fi.ModTime().Equal(p.modTime) {
+		return nil
+	}
+
+	roles, err := parsePolicy(p.Path)
+	if err != nil {
+		return err
+	}
+
+	p.roles, p.modTime = roles, fi.ModTime()
+	return nil
+}
+
+// 读取失败时继续使用之前的内容, 没有读取过时返回错误
+func (p *Policy) current() (map[string][]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.roles == nil || time.Since(p.checked) >= policyCheckInterval {
+		p.checked = time.Now()
+		if err := p.load(); err != nil && p.roles == nil {
+			return nil, err
+		}
+	}
+
+	return p.roles, nil
+}
+
+// 检查文件是否可以读取和解析
+func (p *Policy) Check() error {
+	_, err := p.current()
+	return err
+}
+
+func (p *Policy) HasRole(role string) (bool, error) {
+	if role == RoleSuperAdmin {
+		return true, nil
+	}
+	roles, err := p.current()
+	if err != nil {
+		return false, err
+	}
+	_, ok := roles[role]
+	return ok, nil
+}
+
+// roles 中是否有角色可以调用 method
+func (p *Policy) Allow(roles []string, method string) (bool, error) {
+	policy, err := p.current()
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if role == RoleSuperAdmin {
+			return true, nil
+		}
+		for _, m := range policy[role] {
+			if ok, _ := path.Match(m, method); ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
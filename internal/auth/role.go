@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultRoleTTL = time.Minute
+
+// 查询过的角色, 修改绑定时通过 server.Invalidations 删除
+var roleCache = server.NewLocalStore()
+
+func init() {
+	server.Invalidations.Register(roleCache)
+}
+
+func RoleCacheKey(tenant, principal string) string {
+	return "role:" + tenant + ":" + principal
+}
+
+// 按 tenant 和 principal 查询绑定的角色
+type RoleBindings struct {
+	DB server.DB
+	// 查询过的角色在进程内保留的时间, <= 0 时为 1 分钟
+	TTL    time.Duration
+	Logger *zap.Logger
+}
+
+func (r *RoleBindings) ttl() time.Duration {
+	if r.TTL <= 0 {
+		return defaultRoleTTL
+	}
+	return r.TTL
+}
+
+func (r *RoleBindings) Roles(tenant, principal string) (roles []string, err error) {
+	ckey := RoleCacheKey(tenant, principal)
+	if buf, ok := roleCache.Get(ckey); ok {
+		err = json.Unmarshal(buf, &roles)
+		return roles, err
+	}
+
+	dao := RoleBindingPgDao{W: r.DB, R: r.DB, Logger: r.Logger}
+	var metas []server.RoleBindingMeta
+	if metas, err = dao.Select(&server.RoleBindingMeta{TenantName: tenant, Principal: principal}); err != nil {
+		return nil, err
+	}
+	roles = make([]string, 0, len(metas))
+	for _, m := range metas {
+		roles = append(roles, m.Role)
+	}
+
+	var buf []byte
+	if buf, err = json.Marshal(roles); err == nil {
+		roleCache.Set(ckey, buf, r.ttl())
+	}
+
+	return roles, nil
+}
+
+func isSuperAdmin(roles []string) bool {
+	for _, role := range roles {
+		if role == RoleSuperAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// context 中的身份是否有 super-admin 角色, 没有启用认证时为 false
+func IsSuperAdmin(ctx context.Context) bool {
+	id, ok := ctxvalue.IdentityContext{}.GetValue(ctx)
+	return ok && isSuperAdmin(id.Roles)
+}
+
+// 按身份的角色和 policy 检查是否可以调用方法, 需要在 Authenticator 之后
+type Authorizer struct {
+	Policy *Policy
+	Logger *zap.Logger
+}
+
+func (a *Authorizer) Authorize(ctx context.Context, method string) error {
+	id, ok := ctxvalue.IdentityContext{}.GetValue(ctx)
+	if !ok {
+		// 不需要认证的方法
+		return nil
+	}
+
+	allow, err := a.Policy.Allow(id.Roles, method)
+	if err != nil {
+		a.Logger.Warn("authorize err", zap.String("error", err.Error()))
+		return server.InternalErr("授权失败")
+	}
+	if !allow {
+		a.Logger.Info("permission denied",
+			zap.String("tenant", id.Tenant),
+			zap.String("principal", id.Subject),
+			zap.Strings("roles", id.Roles),
+			zap.String("method", method),
+		)
+		return status.Errorf(codes.PermissionDenied, "没有调用 %s 的权限", method)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const roleTable = "role_binding"
+
+var (
+	_roleFields = [...]string{"uuid", "tenant_id", "principal", "role", "create_time"}
+)
+
+type RoleBindingPgDao struct {
+	W      server.DB
+	R      server.DB
+	Logger *zap.Logger
+	server.Dao
+	server.DaoLog
+}
+
+func (d *RoleBindingPgDao) Table() string {
+	return roleTable
+}
+
+func (d *RoleBindingPgDao) fields() []string {
+	fs := make([]string, 0, len(_roleFields)+1)
+	for _, f := range _roleFields {
+		fs = append(fs, d.Field(d.Table(), f))
+	}
+	return append(fs, d.FieldAs(tenantTable, "name", "tenant_name"))
+}
+
+// 已经存在时返回已有的 uuid
+func (d *RoleBindingPgDao) Insert(meta *server.RoleBindingMeta) (uuid int, err error) {
+	query, args := server.Insert(d.Table()).
+		Columns(_roleFields[1:]...).
+		Values(meta.TenantId, meta.Principal, meta.Role, meta.CreateTime).
+		OnConflict("tenant_id", "principal", "role").
+		DoUpdate("role").
+		Returning("uuid").
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.W.QueryRowx(query, args...).Scan(&uuid)
+
+	return uuid, err
+}
+
+// 按 tenant, tenant 名称或 principal 查询, 不包含 tenant 已经被删除的
+func (d *RoleBindingPgDao) Select(meta *server.RoleBindingMeta, ops ...server.DaoOption) (objs []server.RoleBindingMeta, err error) {
+	cs := []server.Cond{
+		server.IsNull(d.Field(tenantTable, server.DeletedAtCol)),
+	}
+
+	if meta.TenantId != 0 {
+		cs = append(cs, server.Eq(d.Field(d.Table(), "tenant_id"), meta.TenantId))
+	}
+	if meta.TenantName != "" {
+		cs = append(cs, server.Eq(d.Field(tenantTable, "name"), meta.TenantName))
+	}
+	if meta.Principal != "" {
+		cs = append(cs, server.Eq(d.Field(d.Table(), "principal"), meta.Principal))
+	}
+
+	query, args := server.Select(d.fields()...).
+		From(d.Table()).
+		Join(tenantTable, server.EqCol(d.Field(d.Table(), "tenant_id"), d.Field(tenantTable, "uuid"))).
+		Where(cs...).
+		OrderBy(d.Field(d.Table(), "principal"), d.Field(d.Table(), "role")).
+		Options(ops...).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var rows *sqlx.Rows
+	rows, err = d.R.Queryx(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	err = server.RowsToStructs(&objs, rows)
+
+	return objs, err
+}
+
+// 返回删除的数量
+func (d *RoleBindingPgDao) Delete(meta *server.RoleBindingMeta) (n int64, err error) {
+	query, args := server.Delete(d.Table()).
+		Where(
+			server.Eq("tenant_id", meta.TenantId),
+			server.Eq("principal", meta.Principal),
+			server.Eq("role", meta.Role),
+		).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	result, err := d.W.Exec(query, args...)
+	if err != nil {
+		return n, err
+	}
+
+	return result.RowsAffected()
+}
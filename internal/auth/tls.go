@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 证书文件修改后最长的生效时间
+const tlsCheckInterval = 10 * time.Second
+
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("不支持的 client_auth: %s", s)
+}
+
+// 本地的证书, 私钥和 CA 文件, 文件修改后在新的连接中使用新的内容
+type TLSReloader struct {
+	Cert string
+	Key  string
+	// 验证客户端证书的 CA, ClientAuth 不为 NoClientCert 时需要
+	CA         string
+	ClientAuth tls.ClientAuthType
+	Logger     *zap.Logger
+
+	mu       sync.Mutex
+	config   *tls.Config
+	modTimes []time.Time
+	checked  time.Time
+}
+
+func (r *TLSReloader) files() []string {
+	if r.CA == "" {
+		return []string{r.Cert, r.Key}
+	}
+	return []string{r.Cert, r.Key, r.CA}
+}
+
+func (r *TLSReloader) changed() ([]time.Time, bool, error) {
+	files := r.files()
+	modTimes := make([]time.Time, len(files))
+	changed := r.config == nil
+	for i, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, false, err
+		}
+		modTimes[i] = fi.ModTime()
+		if !changed && !modTimes[i].Equal(r.modTimes[i]) {
+			changed = true
+		}
+	}
+	return modTimes, changed, nil
+}
+
+func (r *TLSReloader) load() error {
+	modTimes, changed, err := r.changed()
+	if err != nil || !changed {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.Cert, r.Key)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   r.ClientAuth,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if r.ClientAuth != tls.NoClientCert {
+		if r.CA == "" {
+			return fmt.Errorf("验证客户端证书需要 ca")
+		}
+		buf, err := os.ReadFile(r.CA)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return fmt.Errorf("ca 中没有证书: %s", r.CA)
+		}
+		config.ClientCAs = pool
+	}
+
+	r.config, r.modTimes = config, modTimes
+	return nil
+}
+
+// 第一次读取, 失败时返回错误
+func (r *TLSReloader) Load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checked = time.Now()
+	return r.load()
+}
+
+func (r *TLSReloader) current() (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.config == nil || time.Since(r.checked) >= tlsCheckInterval {
+		r.checked = time.Now()
+		if err := r.load(); err != nil {
+			if r.config == nil {
+				return nil, err
+			}
+			// 读取失败时继续使用之前的证书
+			r.Logger.Warn("tls reload err", zap.String("error", err.Error()))
+		}
+	}
+
+	return r.config, nil
+}
+
+// 每个连接握手时使用当前的证书, nextProtos 为 ALPN 的协议, 如 gRPC 的 h2
+func (r *TLSReloader) TLSConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config, err := r.current()
+			if err != nil {
+				return nil, err
+			}
+			config = config.Clone()
+			config.NextProtos = nextProtos
+			return config, nil
+		},
+		NextProtos: nextProtos,
+		MinVersion: tls.VersionTLS12,
+	}
+}
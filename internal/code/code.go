@@ -5,4 +5,6 @@ const (
 	PARAMTER_ERROR
 	SQL_EXEC_ERROR
 	INTERNAL_ERROR
+	REVISION_CONFLICT
+	AUTH_ERROR
 )
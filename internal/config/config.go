@@ -7,6 +7,7 @@ import (
 	_ "time/tzdata"
 
 	"github.com/crt379/svc-collector-grpc/internal/flags"
+	"github.com/crt379/svc-collector-grpc/internal/limit"
 	"github.com/crt379/svc-collector-grpc/internal/util"
 
 	"github.com/spf13/viper"
@@ -55,10 +56,22 @@ type Config struct {
 	Log        LogConfig      `toml:"log"`
 	Etcd       []AddrConfig   `toml:"etcd"`
 	Prometheus AddrConfig     `toml:"prometheus"`
+	Jdata      JdataConfig    `toml:"jdata"`
+	Job        JobConfig      `toml:"job"`
+	Trash      TrashConfig    `toml:"trash"`
+	Outbox     OutboxConfig   `toml:"outbox"`
+	Cache      CacheConfig    `toml:"cache"`
+	Auth       AuthConfig     `toml:"auth"`
+	Rbac       RbacConfig     `toml:"rbac"`
+	TLS        TLSConfig      `toml:"tls"`
+	Limit      LimitConfig    `toml:"limit"`
 }
 
 type RegisterConfig struct {
-	Name string
+	Name        string        `toml:"name"`
+	Secret      string        `toml:"secret"`
+	MaxFailures int           `toml:"max_failures" mapstructure:"max_failures"`
+	Window      time.Duration `toml:"window"`
 }
 
 type AddrConfig struct {
@@ -67,8 +80,18 @@ type AddrConfig struct {
 }
 
 type PgSqlConfig struct {
-	Write PgSqlMeta `toml:"write"`
-	Read  PgSqlMeta `toml:"read"`
+	Migrate bool       `toml:"migrate"`
+	Pool    PoolConfig `toml:"pool"`
+	Write   PgSqlMeta  `toml:"write"`
+	Read    PgSqlMeta  `toml:"read"`
+}
+
+// write 和 read 分别使用一个连接池
+type PoolConfig struct {
+	MaxOpen     int           `toml:"max_open" mapstructure:"max_open"`
+	MaxIdle     int           `toml:"max_idle" mapstructure:"max_idle"`
+	MaxLifetime time.Duration `toml:"max_lifetime" mapstructure:"max_lifetime"`
+	MaxIdleTime time.Duration `toml:"max_idle_time" mapstructure:"max_idle_time"`
 }
 
 type PgSqlMeta struct {
@@ -102,3 +125,81 @@ type LogRedisMeta struct {
 	Key       string `toml:"key"`
 	RedisMeta `mapstructure:",squash"`
 }
+
+type JdataConfig struct {
+	HashType string        `toml:"hash_type" mapstructure:"hash_type"`
+	GC       JdataGCConfig `toml:"gc"`
+}
+
+type JdataGCConfig struct {
+	Enabled  bool          `toml:"enabled"`
+	Interval time.Duration `toml:"interval"`
+	Batch    int           `toml:"batch"`
+	DryRun   bool          `toml:"dry_run" mapstructure:"dry_run"`
+}
+
+type JobConfig struct {
+	Enabled  bool          `toml:"enabled"`
+	Interval time.Duration `toml:"interval"`
+	Stale    time.Duration `toml:"stale"`
+}
+
+type TrashConfig struct {
+	Enabled          bool          `toml:"enabled"`
+	Retention        time.Duration `toml:"retention"`
+	HistoryRetention time.Duration `toml:"history_retention" mapstructure:"history_retention"`
+	Interval         time.Duration `toml:"interval"`
+	Batch            int           `toml:"batch"`
+}
+
+type OutboxConfig struct {
+	Enabled   bool          `toml:"enabled"`
+	Stream    string        `toml:"stream"`
+	MaxLen    int64         `toml:"max_len" mapstructure:"max_len"`
+	Interval  time.Duration `toml:"interval"`
+	Batch     int           `toml:"batch"`
+	Retention time.Duration `toml:"retention"`
+}
+
+type CacheConfig struct {
+	TTL       time.Duration `toml:"ttl"`
+	MissTTL   time.Duration `toml:"miss_ttl" mapstructure:"miss_ttl"`
+	Local     time.Duration `toml:"local"`
+	Channel   string        `toml:"channel"`
+	Reconcile time.Duration `toml:"reconcile"`
+}
+
+type AuthConfig struct {
+	Enabled     bool          `toml:"enabled"`
+	Jwks        string        `toml:"jwks"`
+	Issuer      string        `toml:"issuer"`
+	Audience    string        `toml:"audience"`
+	TenantClaim string        `toml:"tenant_claim" mapstructure:"tenant_claim"`
+	Leeway      time.Duration `toml:"leeway"`
+	ApiKeyTTL   time.Duration `toml:"api_key_ttl" mapstructure:"api_key_ttl"`
+	// 客户端证书中 tenant 的 URI SAN 前缀, 为空时不使用客户端证书
+	CertTenantPrefix string   `toml:"cert_tenant_prefix" mapstructure:"cert_tenant_prefix"`
+	Skip             []string `toml:"skip"`
+}
+
+type RbacConfig struct {
+	Enabled bool          `toml:"enabled"`
+	Policy  string        `toml:"policy"`
+	TTL     time.Duration `toml:"ttl"`
+}
+
+type TLSConfig struct {
+	Enabled bool   `toml:"enabled"`
+	Cert    string `toml:"cert"`
+	Key     string `toml:"key"`
+	CA      string `toml:"ca"`
+	// none, request 或 require
+	ClientAuth string `toml:"client_auth" mapstructure:"client_auth"`
+	// /metrics 也使用 tls
+	Metrics bool `toml:"metrics"`
+}
+
+type LimitConfig struct {
+	Enabled bool         `toml:"enabled"`
+	Rules   []limit.Rule `toml:"rules"`
+}
@@ -8,11 +8,11 @@ import (
 )
 
 type ContextK interface {
-	LoggerContextK | GrpcMetaContextK | TraceContextK
+	LoggerContextK | GrpcMetaContextK | TraceContextK | ActorContextK | IdentityContextK
 }
 
 type CTargetType interface {
-	zap.Logger | metadata.MD | string
+	zap.Logger | metadata.MD | string | Identity
 }
 
 type TargetContext[T CTargetType, K ContextK] struct {
@@ -57,3 +57,27 @@ type TraceContextK struct{}
 type TraceContext struct {
 	TargetContext[string, TraceContextK]
 }
+
+type ActorContextK struct{}
+
+// 请求的操作者, 用于审计记录
+type ActorContext struct {
+	TargetContext[string, ActorContextK]
+}
+
+// 认证得到的身份
+type Identity struct {
+	Tenant  string
+	Subject string
+	// 认证方式, apikey 或 jwt
+	Method string
+	// Tenant 中绑定的角色, 没有启用授权时为空
+	Roles []string
+}
+
+type IdentityContextK struct{}
+
+// 没有启用认证时 context 中没有身份
+type IdentityContext struct {
+	TargetContext[Identity, IdentityContextK]
+}
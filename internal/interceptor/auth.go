@@ -0,0 +1,36 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/crt379/svc-collector-grpc/internal/auth"
+
+	"google.golang.org/grpc"
+)
+
+func WithUnaryAuth(a *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		ctx, err = a.Authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func WithStreamAuth(a *auth.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx, err := a.Authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		ssb := ServerStreamBox{
+			ServerStream: ss,
+			Ctx:          &ctx,
+		}
+
+		return handler(srv, &ssb)
+	}
+}
@@ -0,0 +1,29 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/crt379/svc-collector-grpc/internal/auth"
+
+	"google.golang.org/grpc"
+)
+
+func WithUnaryAuthz(a *auth.Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		if err = a.Authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func WithStreamAuthz(a *auth.Authorizer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		if err = a.Authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
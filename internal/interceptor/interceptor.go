@@ -139,6 +139,40 @@ func StreamTrace(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, han
 	return handler(srv, &ssb)
 }
 
+// 请求 meta 中的操作者没有经过认证, 加上前缀与认证得到的 subject 区分
+const headerActorPrefix = "header:"
+
+// 启用认证时由认证的 subject 覆盖
+func actorFromMeta(ctx context.Context) string {
+	md, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if ok {
+		if getvalue := md.Get("x-access-actor"); len(getvalue) > 0 && getvalue[0] != "" {
+			return headerActorPrefix + getvalue[0]
+		}
+	}
+
+	return ""
+}
+
+func UnaryActor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	actor := actorFromMeta(ctx)
+	ctx = ctxvalue.ActorContext{}.NewContext(ctx, &actor)
+
+	return handler(ctx, req)
+}
+
+func StreamActor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx := ss.Context()
+	actor := actorFromMeta(ctx)
+	ctx = ctxvalue.ActorContext{}.NewContext(ctx, &actor)
+	ssb := ServerStreamBox{
+		ServerStream: ss,
+		Ctx:          &ctx,
+	}
+
+	return handler(srv, &ssb)
+}
+
 func UnaryTraceSpanLog(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
 	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
 	traceid, _ := ctxvalue.TraceContext{}.GetValue(ctx)
@@ -0,0 +1,93 @@
+package interceptor
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/crt379/svc-collector-grpc/internal/auth"
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/limit"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 超过限制时响应 header 中建议的重试秒数
+const RetryAfterKey = "retry-after"
+
+var limitedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_server_limited_total",
+	Help: "Total number of RPCs rejected by the per-tenant rate or concurrency limits.",
+}, []string{"grpc_service", "grpc_method", "reason"})
+
+// 认证后按凭证的 tenant 计算, super-admin 访问其他 tenant 时也计入凭证的 tenant.
+// 没有身份时 (未启用认证或不需要认证的方法) 使用客户端传入的 x-access-tenant, 客户端可以任意指定
+func requestTenant(ctx context.Context) string {
+	id, ok := ctxvalue.IdentityContext{}.GetValue(ctx)
+	if ok {
+		return id.Tenant
+	}
+
+	md, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(auth.TenantKey); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// 超过限制时返回 ResourceExhausted 和 retry-after header
+func acquire(ctx context.Context, l *limit.Limiter, method string, stream bool, setHeader func(metadata.MD) error) (func(), error) {
+	tenant := requestTenant(ctx)
+	release, reason, retryAfter, ok := l.Acquire(tenant, method, stream)
+	if ok {
+		return release, nil
+	}
+
+	svc, m := splitFullMethodName(method)
+	limitedCounter.WithLabelValues(svc, m, reason).Inc()
+
+	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
+	logger.Info("limited", zap.String("tenant", tenant), zap.String("reason", reason), zap.Duration("retry_after", retryAfter))
+
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	if err := setHeader(metadata.Pairs(RetryAfterKey, seconds)); err != nil {
+		logger.Warn("set retry-after err", zap.String("error", err.Error()))
+	}
+
+	return nil, status.Errorf(codes.ResourceExhausted, "超过 %s 限制, 请 %s 秒后重试", reason, seconds)
+}
+
+func WithUnaryLimit(l *limit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		release, err := acquire(ctx, l, info.FullMethod, false, func(md metadata.MD) error {
+			return grpc.SetHeader(ctx, md)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		return handler(ctx, req)
+	}
+}
+
+func WithStreamLimit(l *limit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		release, err := acquire(ss.Context(), l, info.FullMethod, true, ss.SetHeader)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		return handler(srv, ss)
+	}
+}
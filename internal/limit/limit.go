@@ -0,0 +1,186 @@
+package limit
+
+import (
+	"math"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	// 超过并发限制时建议的重试时间
+	concurrencyRetryAfter = time.Second
+	// 空闲超过该时间的计数被删除
+	idleTimeout = 10 * time.Minute
+
+	ReasonRate        = "rate"
+	ReasonConcurrency = "concurrency"
+)
+
+// 一条限制. Method 相同的规则中, Tenant 与请求相同的规则覆盖 Tenant 为空的规则
+type Rule struct {
+	// 为空时每个 tenant 分别计算
+	Tenant string `toml:"tenant"`
+	// 使用 path.Match 匹配 FullMethod, 每个方法分别计算; 为空时为 tenant 的所有方法一起计算
+	Method string `toml:"method"`
+	// 每秒的请求数, <= 0 时不限制
+	Rate float64 `toml:"rate"`
+	// 令牌桶的容量, <= 0 时为 Rate 向上取整
+	Burst int `toml:"burst"`
+	// 同时执行的请求数, stream 在结束前一直占用, <= 0 时不限制.
+	// Method 为空的规则不计算 stream, 长时间的 Watch 不占用 tenant 所有方法的并发
+	Concurrency int `toml:"concurrency"`
+}
+
+func (r *Rule) burst() float64 {
+	if r.Burst <= 0 {
+		return math.Max(1, math.Ceil(r.Rate))
+	}
+	return float64(r.Burst)
+}
+
+// stream 只计算 Method 不为空的规则的并发
+func (r *Rule) concurrency(stream bool) int {
+	if stream && r.Method == "" {
+		return 0
+	}
+	return r.Concurrency
+}
+
+func (r *Rule) match(method string) bool {
+	if r.Method == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Method, method)
+	return ok
+}
+
+type key struct {
+	rule   int
+	tenant string
+	method string
+}
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	inflight int
+}
+
+// 按 tenant 和方法的令牌桶和并发限制, 计数保存在进程内
+type Limiter struct {
+	Rules []Rule
+
+	mu      sync.Mutex
+	buckets map[key]*bucket
+	swept   time.Time
+}
+
+// 请求适用的规则
+func (l *Limiter) rules(tenant string, method string) []int {
+	chosen := make(map[string]int)
+	for i := range l.Rules {
+		r := &l.Rules[i]
+		if !r.match(method) || (r.Tenant != "" && r.Tenant != tenant) {
+			continue
+		}
+		if j, ok := chosen[r.Method]; ok && l.Rules[j].Tenant != "" {
+			continue
+		}
+		chosen[r.Method] = i
+	}
+
+	idx := make([]int, 0, len(chosen))
+	for _, i := range chosen {
+		idx = append(idx, i)
+	}
+	return idx
+}
+
+func (l *Limiter) bucket(i int, tenant string, method string, now time.Time) *bucket {
+	r := &l.Rules[i]
+	k := key{rule: i, tenant: tenant}
+	if r.Method != "" {
+		k.method = method
+	}
+
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{tokens: r.burst(), last: now}
+		l.buckets[k] = b
+		return b
+	}
+
+	if r.Rate > 0 {
+		b.tokens = math.Min(r.burst(), b.tokens+now.Sub(b.last).Seconds()*r.Rate)
+	}
+	b.last = now
+	return b
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+
+	for k, b := range l.buckets {
+		if b.inflight == 0 && now.Sub(b.last) >= idleTimeout {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// 没有超过限制时返回 ok, 请求结束后需要调用 release.
+// 超过限制时返回原因和建议的重试时间, 不消耗令牌
+func (l *Limiter) Acquire(tenant string, method string, stream bool) (release func(), reason string, retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.buckets == nil {
+		l.buckets = make(map[key]*bucket)
+	}
+	l.sweep(now)
+
+	idx := l.rules(tenant, method)
+	bs := make([]*bucket, len(idx))
+	// 计算并发的桶
+	inflight := make([]*bucket, 0, len(idx))
+	for n, i := range idx {
+		r, b := &l.Rules[i], l.bucket(i, tenant, method, now)
+		bs[n] = b
+
+		c := r.concurrency(stream)
+		if c > 0 {
+			inflight = append(inflight, b)
+		}
+		if c > 0 && b.inflight >= c {
+			return nil, ReasonConcurrency, concurrencyRetryAfter, false
+		}
+		if r.Rate > 0 && b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / r.Rate * float64(time.Second))
+			return nil, ReasonRate, wait, false
+		}
+	}
+
+	for n, i := range idx {
+		if l.Rules[i].Rate > 0 {
+			bs[n].tokens--
+		}
+	}
+	for _, b := range inflight {
+		b.inflight++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for _, b := range inflight {
+				b.inflight--
+			}
+		})
+	}, "", 0, true
+}
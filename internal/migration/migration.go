@@ -0,0 +1,299 @@
+package migration
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+//go:embed migrations/*.sql
+var files embed.FS
+
+const (
+	table = "schema_migrations"
+	dir   = "migrations"
+
+	// pg_advisory_lock 的 key, 防止多个实例同时执行迁移
+	lockKey = 379_0001
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	ApplyTime types.Time
+}
+
+// 读取内嵌的迁移文件, 文件名格式: <version>_<name>.<up|down>.sql
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := make(map[int]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		fname := e.Name()
+		base, ok := strings.CutSuffix(fname, ".sql")
+		if !ok {
+			continue
+		}
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			direction, base = "up", strings.TrimSuffix(base, ".up")
+		case strings.HasSuffix(base, ".down"):
+			direction, base = "down", strings.TrimSuffix(base, ".down")
+		default:
+			return nil, fmt.Errorf("migration %s: missing .up or .down suffix", fname)
+		}
+
+		vstr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: missing version", fname)
+		}
+		version, err := strconv.Atoi(vstr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", fname)
+		}
+
+		var data []byte
+		data, err = files.ReadFile(path.Join(dir, fname))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := ms[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			ms[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d: name conflict %s, %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(ms))
+	for _, m := range ms {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up sql", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+type Migrator struct {
+	DB     *sqlx.DB
+	Logger *zap.Logger
+}
+
+func (m *Migrator) logger() *zap.Logger {
+	if m.Logger == nil {
+		return zap.L()
+	}
+	return m.Logger
+}
+
+// 在持有 advisory lock 的连接上执行 f
+func (m *Migrator) locked(ctx context.Context, f func(conn *sqlx.Conn) error) (err error) {
+	var conn *sqlx.Conn
+	conn, err = m.DB.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, uerr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+		if err == nil {
+			err = uerr
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+    version BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    apply_time TIMESTAMP(0) NOT NULL
+)`, table))
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sqlx.Conn) (map[int]types.Time, error) {
+	rows, err := conn.QueryxContext(ctx, fmt.Sprintf("SELECT version, apply_time FROM %s", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vs := make(map[int]types.Time)
+	for rows.Next() {
+		var (
+			version int
+			t       time.Time
+		)
+		if err = rows.Scan(&version, &t); err != nil {
+			return nil, err
+		}
+		vs[version] = types.Time(t)
+	}
+
+	return vs, rows.Err()
+}
+
+func (m *Migrator) exec(ctx context.Context, conn *sqlx.Conn, query string, record string, args ...any) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 执行所有未执行的迁移, 返回执行的数量
+func (m *Migrator) Up(ctx context.Context) (n int, err error) {
+	migrations, err := Load()
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.locked(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mg := range migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+
+			m.logger().Info("migrate up", zap.Int("version", mg.Version), zap.String("name", mg.Name))
+			err = m.exec(
+				ctx, conn, mg.Up,
+				fmt.Sprintf("INSERT INTO %s (version, name, apply_time) VALUES ($1, $2, $3)", table),
+				mg.Version, mg.Name, time.Now(),
+			)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			n++
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+// 回滚最近执行的 steps 个迁移, 返回回滚的数量
+func (m *Migrator) Down(ctx context.Context, steps int) (n int, err error) {
+	migrations, err := Load()
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.locked(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && n < steps; i-- {
+			mg := migrations[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("migration %d_%s: missing down sql", mg.Version, mg.Name)
+			}
+
+			m.logger().Info("migrate down", zap.Int("version", mg.Version), zap.String("name", mg.Name))
+			err = m.exec(
+				ctx, conn, mg.Down,
+				fmt.Sprintf("DELETE FROM %s WHERE version = $1", table),
+				mg.Version,
+			)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			n++
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+func (m *Migrator) Status(ctx context.Context) (ss []Status, err error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.locked(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		ss = make([]Status, len(migrations))
+		for i, mg := range migrations {
+			t, ok := applied[mg.Version]
+			ss[i] = Status{Migration: mg, Applied: ok, ApplyTime: t}
+		}
+
+		return nil
+	})
+
+	return ss, err
+}
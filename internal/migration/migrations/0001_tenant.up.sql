@@ -1,4 +1,4 @@
-CREATE TABLE tenant(
+CREATE TABLE IF NOT EXISTS tenant(
     uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     name VARCHAR(255) UNIQUE NOT NULL,
     describe VARCHAR(255),
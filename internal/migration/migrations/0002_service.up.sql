@@ -1,4 +1,4 @@
-CREATE TABLE application(
+CREATE TABLE IF NOT EXISTS service(
     uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     name VARCHAR(255) NOT NULL,
     describe VARCHAR(255),
@@ -6,4 +6,4 @@ CREATE TABLE application(
     update_time TIMESTAMP(0),
     tenant_id BIGINT REFERENCES tenant(uuid) NOT NULL,
     UNIQUE (name, tenant_id)
-);
\ No newline at end of file
+);
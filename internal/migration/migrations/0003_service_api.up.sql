@@ -1,4 +1,4 @@
-CREATE TABLE service_api(
+CREATE TABLE IF NOT EXISTS service_api(
     uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     path VARCHAR(255) NOT NULL,
     method VARCHAR(255) NOT NULL,
@@ -8,4 +8,4 @@ CREATE TABLE service_api(
     sid BIGINT REFERENCES service(uuid) NOT NULL,
     tenant_id BIGINT REFERENCES tenant(uuid) NOT NULL,
     UNIQUE (sid, path, method)
-);
\ No newline at end of file
+);
@@ -1,4 +1,4 @@
-CREATE TABLE jdata(
+CREATE TABLE IF NOT EXISTS jdata(
     uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     data JSONB NOT NULL,
     create_time TIMESTAMP(0) NOT NULL,
@@ -6,4 +6,4 @@ CREATE TABLE jdata(
     hash_type VARCHAR(255) NOT NULL,
     hash_value VARCHAR(255) NOT NULL,
     UNIQUE(hash_type, hash_value)
-);
\ No newline at end of file
+);
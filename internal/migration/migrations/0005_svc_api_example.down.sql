@@ -0,0 +1 @@
+DROP TABLE IF EXISTS svc_api_example;
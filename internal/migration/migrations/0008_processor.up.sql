@@ -1,4 +1,4 @@
-CREATE TABLE processor(
+CREATE TABLE IF NOT EXISTS processor(
     uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     addr VARCHAR(255) NOT NULL,
     weight integer,
@@ -8,4 +8,4 @@ CREATE TABLE processor(
     aid BIGINT REFERENCES application(uuid) NOT NULL,
     tenant_id BIGINT REFERENCES tenant(uuid) NOT NULL,
     UNIQUE (addr, aid)
-);
\ No newline at end of file
+);
@@ -0,0 +1,6 @@
+ALTER TABLE processor DROP COLUMN IF EXISTS revision;
+ALTER TABLE application DROP COLUMN IF EXISTS revision;
+ALTER TABLE svc_api_example DROP COLUMN IF EXISTS revision;
+ALTER TABLE service_api DROP COLUMN IF EXISTS revision;
+ALTER TABLE service DROP COLUMN IF EXISTS revision;
+ALTER TABLE tenant DROP COLUMN IF EXISTS revision;
@@ -0,0 +1 @@
+ALTER TABLE svc_api_example DROP CONSTRAINT IF EXISTS svc_api_example_aid_jid_key;
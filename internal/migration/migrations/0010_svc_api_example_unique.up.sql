@@ -0,0 +1,19 @@
+-- 重复的 (aid, jid) 不能自动删除, 列出后由人工合并
+DO $$
+DECLARE
+    dups TEXT;
+BEGIN
+    SELECT string_agg(format('aid=%s jid=%s uuid=%s', aid, jid, uuids), '; ')
+        INTO dups
+        FROM (
+            SELECT aid, jid, array_agg(uuid ORDER BY uuid) AS uuids
+                FROM svc_api_example
+                GROUP BY aid, jid
+                HAVING count(*) > 1
+        ) d;
+    IF dups IS NOT NULL THEN
+        RAISE EXCEPTION 'svc_api_example 有重复的 (aid, jid), 合并后再执行迁移: %', dups;
+    END IF;
+END
+$$;
+ALTER TABLE svc_api_example ADD CONSTRAINT svc_api_example_aid_jid_key UNIQUE (aid, jid);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS job(
+    uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    kind VARCHAR(255) NOT NULL,
+    target BIGINT NOT NULL,
+    state VARCHAR(32) NOT NULL,
+    progress TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    create_time TIMESTAMP(0) NOT NULL,
+    update_time TIMESTAMP(0)
+);
+CREATE INDEX IF NOT EXISTS job_state_idx ON job(state);
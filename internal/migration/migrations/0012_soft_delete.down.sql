@@ -0,0 +1,30 @@
+DELETE FROM processor WHERE deleted_at IS NOT NULL;
+DELETE FROM app_svc_relation WHERE deleted_at IS NOT NULL;
+DELETE FROM svc_api_example WHERE deleted_at IS NOT NULL;
+DELETE FROM service_api WHERE deleted_at IS NOT NULL;
+DELETE FROM service WHERE deleted_at IS NOT NULL;
+DELETE FROM application WHERE deleted_at IS NOT NULL;
+DELETE FROM tenant WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS processor_addr_aid_key;
+ALTER TABLE processor ADD CONSTRAINT processor_addr_aid_key UNIQUE (addr, aid);
+DROP INDEX IF EXISTS app_svc_relation_aid_sid_key;
+ALTER TABLE app_svc_relation ADD CONSTRAINT app_svc_relation_aid_sid_key UNIQUE (aid, sid);
+DROP INDEX IF EXISTS application_name_tenant_id_key;
+ALTER TABLE application ADD CONSTRAINT application_name_tenant_id_key UNIQUE (name, tenant_id);
+DROP INDEX IF EXISTS svc_api_example_aid_jid_key;
+ALTER TABLE svc_api_example ADD CONSTRAINT svc_api_example_aid_jid_key UNIQUE (aid, jid);
+DROP INDEX IF EXISTS service_api_sid_path_method_key;
+ALTER TABLE service_api ADD CONSTRAINT service_api_sid_path_method_key UNIQUE (sid, path, method);
+DROP INDEX IF EXISTS service_name_tenant_id_key;
+ALTER TABLE service ADD CONSTRAINT service_name_tenant_id_key UNIQUE (name, tenant_id);
+DROP INDEX IF EXISTS tenant_name_key;
+ALTER TABLE tenant ADD CONSTRAINT tenant_name_key UNIQUE (name);
+
+ALTER TABLE processor DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE app_svc_relation DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE application DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE svc_api_example DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE service_api DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE service DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE tenant DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,23 @@
+ALTER TABLE tenant ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE service ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE service_api ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE svc_api_example ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE application ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE app_svc_relation ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE processor ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+-- 软删除的数据不占用唯一约束
+ALTER TABLE tenant DROP CONSTRAINT IF EXISTS tenant_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS tenant_name_key ON tenant(name) WHERE deleted_at IS NULL;
+ALTER TABLE service DROP CONSTRAINT IF EXISTS service_name_tenant_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS service_name_tenant_id_key ON service(name, tenant_id) WHERE deleted_at IS NULL;
+ALTER TABLE service_api DROP CONSTRAINT IF EXISTS service_api_sid_path_method_key;
+CREATE UNIQUE INDEX IF NOT EXISTS service_api_sid_path_method_key ON service_api(sid, path, method) WHERE deleted_at IS NULL;
+ALTER TABLE svc_api_example DROP CONSTRAINT IF EXISTS svc_api_example_aid_jid_key;
+CREATE UNIQUE INDEX IF NOT EXISTS svc_api_example_aid_jid_key ON svc_api_example(aid, jid) WHERE deleted_at IS NULL;
+ALTER TABLE application DROP CONSTRAINT IF EXISTS application_name_tenant_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS application_name_tenant_id_key ON application(name, tenant_id) WHERE deleted_at IS NULL;
+ALTER TABLE app_svc_relation DROP CONSTRAINT IF EXISTS app_svc_relation_aid_sid_key;
+CREATE UNIQUE INDEX IF NOT EXISTS app_svc_relation_aid_sid_key ON app_svc_relation(aid, sid) WHERE deleted_at IS NULL;
+ALTER TABLE processor DROP CONSTRAINT IF EXISTS processor_addr_aid_key;
+CREATE UNIQUE INDEX IF NOT EXISTS processor_addr_aid_key ON processor(addr, aid) WHERE deleted_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE job DROP COLUMN IF EXISTS trace_id;
+ALTER TABLE job DROP COLUMN IF EXISTS actor;
+DROP TABLE IF EXISTS audit;
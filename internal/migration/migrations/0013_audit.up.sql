@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS audit(
+    uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    tenant_id BIGINT NOT NULL,
+    kind VARCHAR(64) NOT NULL,
+    target BIGINT NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    before JSONB,
+    after JSONB,
+    trace_id VARCHAR(255) NOT NULL DEFAULT '',
+    create_time TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_kind_target_idx ON audit(kind, target, create_time);
+CREATE INDEX IF NOT EXISTS audit_actor_idx ON audit(actor, create_time);
+CREATE INDEX IF NOT EXISTS audit_create_time_idx ON audit(create_time);
+
+-- 后台 job 执行修改时的审计记录使用创建 job 的请求的操作者
+ALTER TABLE job ADD COLUMN IF NOT EXISTS actor VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE job ADD COLUMN IF NOT EXISTS trace_id VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS processor_history ON processor;
+DROP TABLE IF EXISTS processor_history;
+DROP TRIGGER IF EXISTS app_svc_relation_history ON app_svc_relation;
+DROP TABLE IF EXISTS app_svc_relation_history;
+DROP TRIGGER IF EXISTS svc_api_example_history ON svc_api_example;
+DROP TABLE IF EXISTS svc_api_example_history;
+DROP TRIGGER IF EXISTS service_api_history ON service_api;
+DROP TABLE IF EXISTS service_api_history;
+DROP TRIGGER IF EXISTS service_history ON service;
+DROP TABLE IF EXISTS service_history;
+DROP FUNCTION IF EXISTS record_history();
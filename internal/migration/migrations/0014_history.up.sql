@@ -0,0 +1,62 @@
+-- 每次修改写入一个版本, valid_to 为 NULL 时为当前版本.
+-- 使用 clock_timestamp, 同一个事务中的多次修改也有先后顺序
+CREATE OR REPLACE FUNCTION record_history() RETURNS TRIGGER AS $$
+DECLARE
+    ts TIMESTAMPTZ := clock_timestamp();
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD IS NOT DISTINCT FROM NEW THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP <> 'INSERT' THEN
+        EXECUTE format('UPDATE %I SET valid_to = $1 WHERE uuid = $2 AND valid_to IS NULL', TG_TABLE_NAME || '_history')
+        USING ts, OLD.uuid;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        EXECUTE format('INSERT INTO %I SELECT ($1).*, $2, NULL', TG_TABLE_NAME || '_history')
+        USING NEW, ts;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- 历史表的列为原表的列加上 valid_from, valid_to, 原表增加列时历史表需要同时增加.
+-- 已有的数据以最后修改时间作为当前版本的开始时间
+CREATE TABLE IF NOT EXISTS service_history (LIKE service);
+ALTER TABLE service_history ADD COLUMN IF NOT EXISTS valid_from TIMESTAMPTZ NOT NULL;
+ALTER TABLE service_history ADD COLUMN IF NOT EXISTS valid_to TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS service_history_uuid_idx ON service_history(uuid, valid_from);
+INSERT INTO service_history SELECT t.*, COALESCE(GREATEST(t.update_time, t.deleted_at), t.create_time), NULL FROM service t;
+DROP TRIGGER IF EXISTS service_history ON service;
+CREATE TRIGGER service_history AFTER INSERT OR UPDATE OR DELETE ON service FOR EACH ROW EXECUTE FUNCTION record_history();
+
+CREATE TABLE IF NOT EXISTS service_api_history (LIKE service_api);
+ALTER TABLE service_api_history ADD COLUMN IF NOT EXISTS valid_from TIMESTAMPTZ NOT NULL;
+ALTER TABLE service_api_history ADD COLUMN IF NOT EXISTS valid_to TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS service_api_history_uuid_idx ON service_api_history(uuid, valid_from);
+INSERT INTO service_api_history SELECT t.*, COALESCE(GREATEST(t.update_time, t.deleted_at), t.create_time), NULL FROM service_api t;
+DROP TRIGGER IF EXISTS service_api_history ON service_api;
+CREATE TRIGGER service_api_history AFTER INSERT OR UPDATE OR DELETE ON service_api FOR EACH ROW EXECUTE FUNCTION record_history();
+
+CREATE TABLE IF NOT EXISTS svc_api_example_history (LIKE svc_api_example);
+ALTER TABLE svc_api_example_history ADD COLUMN IF NOT EXISTS valid_from TIMESTAMPTZ NOT NULL;
+ALTER TABLE svc_api_example_history ADD COLUMN IF NOT EXISTS valid_to TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS svc_api_example_history_uuid_idx ON svc_api_example_history(uuid, valid_from);
+INSERT INTO svc_api_example_history SELECT t.*, COALESCE(GREATEST(t.update_time, t.deleted_at), t.create_time), NULL FROM svc_api_example t;
+DROP TRIGGER IF EXISTS svc_api_example_history ON svc_api_example;
+CREATE TRIGGER svc_api_example_history AFTER INSERT OR UPDATE OR DELETE ON svc_api_example FOR EACH ROW EXECUTE FUNCTION record_history();
+
+CREATE TABLE IF NOT EXISTS app_svc_relation_history (LIKE app_svc_relation);
+ALTER TABLE app_svc_relation_history ADD COLUMN IF NOT EXISTS valid_from TIMESTAMPTZ NOT NULL;
+ALTER TABLE app_svc_relation_history ADD COLUMN IF NOT EXISTS valid_to TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS app_svc_relation_history_uuid_idx ON app_svc_relation_history(uuid, valid_from);
+INSERT INTO app_svc_relation_history SELECT t.*, COALESCE(GREATEST(t.update_time, t.deleted_at), t.create_time), NULL FROM app_svc_relation t;
+DROP TRIGGER IF EXISTS app_svc_relation_history ON app_svc_relation;
+CREATE TRIGGER app_svc_relation_history AFTER INSERT OR UPDATE OR DELETE ON app_svc_relation FOR EACH ROW EXECUTE FUNCTION record_history();
+
+CREATE TABLE IF NOT EXISTS processor_history (LIKE processor);
+ALTER TABLE processor_history ADD COLUMN IF NOT EXISTS valid_from TIMESTAMPTZ NOT NULL;
+ALTER TABLE processor_history ADD COLUMN IF NOT EXISTS valid_to TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS processor_history_uuid_idx ON processor_history(uuid, valid_from);
+INSERT INTO processor_history SELECT t.*, COALESCE(GREATEST(t.update_time, t.deleted_at), t.create_time), NULL FROM processor t;
+DROP TRIGGER IF EXISTS processor_history ON processor;
+CREATE TRIGGER processor_history AFTER INSERT OR UPDATE OR DELETE ON processor FOR EACH ROW EXECUTE FUNCTION record_history();
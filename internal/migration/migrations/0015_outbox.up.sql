@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS outbox(
+    seq BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    tenant_id BIGINT NOT NULL,
+    target BIGINT NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    trace_id VARCHAR(255) NOT NULL DEFAULT '',
+    create_time TIMESTAMP NOT NULL,
+    publish_time TIMESTAMP
+);
+-- relay 按 seq 读取未发布的事件, 已发布的事件按 publish_time 清理
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox(seq) WHERE publish_time IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_publish_time_idx ON outbox(publish_time);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_key(
+    uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    tenant_id BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    -- key 的前缀, 用于查找
+    prefix VARCHAR(32) UNIQUE NOT NULL,
+    -- key 的 sha256, 不保存 key 本身
+    key_hash VARCHAR(64) NOT NULL,
+    create_time TIMESTAMP(0) NOT NULL,
+    expire_time TIMESTAMP(0),
+    revoke_time TIMESTAMP(0)
+);
+CREATE INDEX IF NOT EXISTS api_key_tenant_id_idx ON api_key(tenant_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS role_binding(
+    uuid BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    -- principal 所属的 tenant
+    tenant_id BIGINT NOT NULL,
+    -- 认证得到的 subject, api key 为 apikey:<name>
+    principal VARCHAR(255) NOT NULL,
+    role VARCHAR(64) NOT NULL,
+    create_time TIMESTAMP(0) NOT NULL,
+    UNIQUE (tenant_id, principal, role)
+);
@@ -0,0 +1,3 @@
+-- 创建 job 的 tenant, 只有该 tenant 可以查询 job
+ALTER TABLE job ADD COLUMN IF NOT EXISTS tenant_id BIGINT NOT NULL DEFAULT 0;
+UPDATE job SET tenant_id = target WHERE kind = 'tenant.delete' AND tenant_id = 0;
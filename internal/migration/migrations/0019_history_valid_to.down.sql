@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS processor_history_valid_to_idx;
+DROP INDEX IF EXISTS app_svc_relation_history_valid_to_idx;
+DROP INDEX IF EXISTS svc_api_example_history_valid_to_idx;
+DROP INDEX IF EXISTS service_api_history_valid_to_idx;
+DROP INDEX IF EXISTS service_history_valid_to_idx;
@@ -0,0 +1,6 @@
+-- 按 valid_to 清理过期的历史版本
+CREATE INDEX IF NOT EXISTS service_history_valid_to_idx ON service_history(valid_to);
+CREATE INDEX IF NOT EXISTS service_api_history_valid_to_idx ON service_api_history(valid_to);
+CREATE INDEX IF NOT EXISTS svc_api_example_history_valid_to_idx ON svc_api_example_history(valid_to);
+CREATE INDEX IF NOT EXISTS app_svc_relation_history_valid_to_idx ON app_svc_relation_history(valid_to);
+CREATE INDEX IF NOT EXISTS processor_history_valid_to_idx ON processor_history(valid_to);
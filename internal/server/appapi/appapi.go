@@ -43,20 +43,42 @@ func (imp *AppapiImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 	}
 	appapi := server.AppapiMeta{
 		Appid:    int(req.Appid),
+		Appname:  req.Appname,
 		Appsvcid: int(req.Appsvcid),
 		Svcid:    int(req.Svcid),
 		Svcname:  req.Svcname,
 		TenantId: tenant.Uuid,
 	}
 
-	var appapis []server.AppapiMeta
-	appapis, err = dao.Select(&appapi)
+	var total int
+	total, err = dao.Count(&appapi)
 	if err != nil {
 		return server.SqlErrResp(&GResp{resp}, err)
 	}
 
+	var appapis []server.AppapiMeta
+	resp.Page = 0
+	resp.Limit = 100
+	if total > 0 {
+		if req.Page > 0 {
+			resp.Page = req.Page
+		}
+		if req.Limit > 0 {
+			resp.Limit = req.Limit
+		}
+		var limitoption *server.LimitOption
+		if int(resp.Limit) < total {
+			limitoption = server.NewLimitOption(int(resp.Page), int(resp.Limit))
+		}
+
+		appapis, err = dao.Select(&appapi, limitoption)
+		if err != nil {
+			return server.SqlErrResp(&GResp{resp}, err)
+		}
+	}
+
 	resp.Count, resp.Appapis, _ = server.Metas2Pbmeta[server.AppapiMeta, pb.AppapiMeta](&appapis)
-	resp.Total = resp.Count
+	resp.Total = int32(total)
 
 	return server.OkResp(&GResp{resp})
 }
@@ -15,8 +15,8 @@ import (
 var _ server.IDao[server.AppapiMeta] = (*AppapiPgDao)(nil)
 
 type AppapiPgDao struct {
-	W      *sqlx.DB
-	R      *sqlx.DB
+	W      server.DB
+	R      server.DB
 	Logger *zap.Logger
 	server.Dao
 	server.DaoLog
@@ -26,54 +26,75 @@ func (d *AppapiPgDao) Insert(meta *server.AppapiMeta) (int, error) {
 	return 0, fmt.Errorf("method not implemented")
 }
 
-func (d *AppapiPgDao) Select(meta *server.AppapiMeta, ops ...server.DaoOption) (objs []server.AppapiMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+// 一个 app_svc_relation 为一组, 查询有 service_api 的组
+func (d *AppapiPgDao) groups(meta *server.AppapiMeta, columns ...string) *server.SelectBuilder {
+	cs := make([]server.Cond, 0)
 	apid := svrapi.SvcapiPgDao{}
 	svcd := svrsvc.ServicePgDao{}
 	appsvcd := svrappsvc.AppsvcPgDao{}
 	appd := svrapp.ApplicationPgDao{}
 
 	if meta.Appid != 0 {
-		k = append(k, d.Field(appsvcd.Table(), "aid"))
-		args = append(args, meta.Appid)
+		cs = append(cs, server.Eq(d.Field(appsvcd.Table(), "aid"), meta.Appid))
+	}
+	if meta.Appname != "" {
+		cs = append(cs, server.Eq(d.Field(appd.Table(), "name"), meta.Appname))
 	}
 	if meta.Appsvcid != 0 {
-		k = append(k, d.Field(appsvcd.Table(), "uuid"))
-		args = append(args, meta.Appsvcid)
+		cs = append(cs, server.Eq(d.Field(appsvcd.Table(), "uuid"), meta.Appsvcid))
 	}
 	if meta.Svcid != 0 {
-		k = append(k, d.Field(svcd.Table(), "uuid"))
-		args = append(args, meta.Svcid)
+		cs = append(cs, server.Eq(d.Field(svcd.Table(), "uuid"), meta.Svcid))
 	}
 	if meta.Svcname != "" {
-		k = append(k, d.Field(svcd.Table(), "name"))
-		args = append(args, meta.Svcname)
+		cs = append(cs, server.Eq(d.Field(svcd.Table(), "name"), meta.Svcname))
 	}
 	if meta.TenantId != 0 {
-		k = append(k, d.Field(svcd.Table(), "tenant_id"))
-		args = append(args, meta.TenantId)
-	}
-
-	optconditions := make([]string, 0)
-	for _, op := range ops {
-		optconditions = append(optconditions, op.Conditions()...)
+		cs = append(cs,
+			server.Eq(d.Field(appd.Table(), "tenant_id"), meta.TenantId),
+			server.Eq(d.Field(svcd.Table(), "tenant_id"), meta.TenantId),
+		)
 	}
-	optconditions = append(optconditions,
+	cs = append(cs, d.Alive(appsvcd.Table())...)
+	cs = append(cs, d.Alive(svcd.Table())...)
+	cs = append(cs, d.Alive(appd.Table())...)
+	cs = append(cs, server.Exists(
+		server.Select("1").
+			From(apid.Table()).
+			Where(server.EqCol(d.Field(apid.Table(), "sid"), d.Field(svcd.Table(), "uuid"))).
+			Where(d.Alive(apid.Table())...),
+	))
+
+	return server.Select(columns...).
+		From(appsvcd.Table()).
 		// app_svc_relation.sid = service.uuid
-		d.Equal(d.Field(appsvcd.Table(), "sid"), d.Field(svcd.Table(), "uuid")),
-		d.Equal(d.Field(appsvcd.Table(), "aid"), d.Field(appd.Table(), "uuid")),
+		Join(svcd.Table(), server.EqCol(d.Field(appsvcd.Table(), "sid"), d.Field(svcd.Table(), "uuid"))).
+		Join(appd.Table(), server.EqCol(d.Field(appsvcd.Table(), "aid"), d.Field(appd.Table(), "uuid"))).
+		Where(cs...)
+}
+
+// ops 作用于组, 分页按组进行
+func (d *AppapiPgDao) Select(meta *server.AppapiMeta, ops ...server.DaoOption) (objs []server.AppapiMeta, err error) {
+	apid := svrapi.SvcapiPgDao{}
+	svcd := svrsvc.ServicePgDao{}
+	appsvcd := svrappsvc.AppsvcPgDao{}
+	appd := svrapp.ApplicationPgDao{}
+
+	groups := d.groups(meta, d.Field(appsvcd.Table(), "uuid")).
+		OrderBy(d.Field(appsvcd.Table(), "uuid")).
+		Options(ops...)
+
+	query, args := server.Select(fields()).
+		With("g", groups).
+		From("g").
+		Join(appsvcd.Table(), server.EqCol(d.Field(appsvcd.Table(), "uuid"), "g.uuid")).
+		Join(svcd.Table(), server.EqCol(d.Field(appsvcd.Table(), "sid"), d.Field(svcd.Table(), "uuid"))).
+		Join(appd.Table(), server.EqCol(d.Field(appsvcd.Table(), "aid"), d.Field(appd.Table(), "uuid"))).
 		// service.uuid = service_api.sid
-		d.Equal(d.Field(svcd.Table(), "uuid"), d.Field(apid.Table(), "sid")),
-	)
-
-	query := d.SelectSQL(
-		"",
-		d.Comma(svcd.Table(), apid.Table(), appsvcd.Table(), appd.Table()),
-		fields(),
-		k,
-		optconditions...,
-	)
+		Join(apid.Table(), server.EqCol(d.Field(svcd.Table(), "uuid"), d.Field(apid.Table(), "sid"))).
+		Where(d.Alive(apid.Table())...).
+		OrderBy(d.Field(appsvcd.Table(), "uuid"), d.Field(apid.Table(), "uuid")).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -83,12 +104,12 @@ func (d *AppapiPgDao) Select(meta *server.AppapiMeta, ops ...server.DaoOption) (
 	}
 
 	var dbobjs []AppapiDB
-	svci := make(map[int]int)
+	groupi := make(map[int]int)
 	err = server.RowsToStructs(&dbobjs, rows, func(t *AppapiDB) error {
-		i, ok := svci[t.aaservice.Uuid]
+		i, ok := groupi[t.Appsvcid]
 		if !ok {
 			i = len(objs)
-			svci[t.aaservice.Uuid] = i
+			groupi[t.Appsvcid] = i
 			objs = append(objs, server.AppapiMeta{
 				Appapi: server.AAapi{
 					Application: t.ToApplicationMeta(),
@@ -106,38 +127,9 @@ func (d *AppapiPgDao) Select(meta *server.AppapiMeta, ops ...server.DaoOption) (
 	return objs, err
 }
 
+// 组的数量
 func (d *AppapiPgDao) Count(meta *server.AppapiMeta) (count int, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-	apid := svrapi.SvcapiPgDao{}
-	svcd := svrsvc.ServicePgDao{}
-	appsvcd := svrappsvc.AppsvcPgDao{}
-
-	if meta.Appid != 0 {
-		k = append(k, d.Field(appsvcd.Table(), "aid"))
-		args = append(args, meta.Appid)
-	}
-	if meta.Appsvcid != 0 {
-		k = append(k, d.Field(appsvcd.Table(), "uuid"))
-		args = append(args, meta.Appsvcid)
-	}
-	if meta.Svcid != 0 {
-		k = append(k, d.Field(svcd.Table(), "uuid"))
-		args = append(args, meta.Svcid)
-	}
-	if meta.Svcname != "" {
-		k = append(k, d.Field(svcd.Table(), "name"))
-		args = append(args, meta.Svcname)
-	}
-
-	query := d.SelectSQL(
-		"",
-		d.Comma(svcd.Table(), apid.Table(), appsvcd.Table()),
-		"count(*)",
-		k,
-		d.Equal(d.Field(appsvcd.Table(), "sid"), d.Field(svcd.Table(), "uuid")),
-		d.Equal(d.Field(svcd.Table(), "uuid"), d.Field(apid.Table(), "sid")),
-	)
+	query, args := d.groups(meta, "count(*)").ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.R.QueryRowx(query, args...).Scan(&count)
@@ -2,9 +2,57 @@ package appapi
 
 import (
 	pb "github.com/crt379/svc-collector-grpc-proto/appapi"
+	"github.com/crt379/svc-collector-grpc/internal/server/outbox"
+
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func RegisterServer(srv *grpc.Server) {
 	pb.RegisterAppapiServer(srv, &AppapiImp{})
 }
+
+// Watch 没有 proto 定义, 请求和消息都使用 google.protobuf.Struct
+type AppapiWatchServer interface {
+	Watch(*structpb.Struct, AppapiWatch_WatchServer) error
+}
+
+type AppapiWatch_WatchServer interface {
+	Send(*structpb.Struct) error
+	grpc.ServerStream
+}
+
+type appapiWatchWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *appapiWatchWatchServer) Send(m *structpb.Struct) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _AppapiWatch_Watch_Handler(srv any, stream grpc.ServerStream) error {
+	m := new(structpb.Struct)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AppapiWatchServer).Watch(m, &appapiWatchWatchServer{stream})
+}
+
+// 接口定义见 proto/appapi/appapi_watch.proto, Metadata 为相对 proto 目录的路径
+var AppapiWatch_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "appapi.AppapiWatch",
+	HandlerType: (*AppapiWatchServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _AppapiWatch_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "appapi/appapi_watch.proto",
+}
+
+func RegisterWatchServer(srv *grpc.Server, hub *outbox.Hub) {
+	srv.RegisterService(&AppapiWatch_ServiceDesc, &AppapiWatchImp{Hub: hub})
+}
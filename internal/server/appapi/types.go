@@ -6,6 +6,7 @@ import (
 	pb "github.com/crt379/svc-collector-grpc-proto/appapi"
 	"github.com/crt379/svc-collector-grpc/internal/server"
 	svrapp "github.com/crt379/svc-collector-grpc/internal/server/application"
+	svrappsvc "github.com/crt379/svc-collector-grpc/internal/server/appsvc"
 	svrsvc "github.com/crt379/svc-collector-grpc/internal/server/service"
 	svrapi "github.com/crt379/svc-collector-grpc/internal/server/svcapi"
 	"github.com/crt379/svc-collector-grpc/internal/types"
@@ -64,7 +65,10 @@ func fields() string {
 		apid := svrapi.SvcapiPgDao{}
 		svcd := svrsvc.ServicePgDao{}
 		appd := svrapp.ApplicationPgDao{}
+		appsvcd := svrappsvc.AppsvcPgDao{}
 		fs := []string{
+			d.FieldAs(appsvcd.Table(), "uuid", "r_uuid"),
+
 			d.Field(appd.Table(), "uuid"),
 			d.Field(appd.Table(), "name"),
 			d.Field(appd.Table(), "describe"),
@@ -95,6 +99,7 @@ func fields() string {
 }
 
 type AppapiDB struct {
+	Appsvcid int `db:"r_uuid"`
 	aaapp
 	aaservice
 	aasvcapi
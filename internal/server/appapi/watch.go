@@ -0,0 +1,168 @@
+package appapi
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	svrapp "github.com/crt379/svc-collector-grpc/internal/server/application"
+	svrappsvc "github.com/crt379/svc-collector-grpc/internal/server/appsvc"
+	"github.com/crt379/svc-collector-grpc/internal/server/outbox"
+	svrapi "github.com/crt379/svc-collector-grpc/internal/server/svcapi"
+	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type AppapiWatchImp struct {
+	Hub *outbox.Hub
+}
+
+var _ AppapiWatchServer = (*AppapiWatchImp)(nil)
+
+// 一个 application 关联的 service 的 service_api. 事件在主库提交后发布, 都从主库读取, 从库延迟时会发送旧数据或丢失事件
+type watch struct {
+	tenantid int
+	appid    int
+	logger   *zap.Logger
+}
+
+type watchService struct {
+	Service server.ServiceMeta  `json:"service"`
+	Svcapis []server.SvcapiMeta `json:"svcapis"`
+}
+
+func (w *watch) snapshot() (map[string]any, error) {
+	appdao := svrapp.ApplicationPgDao{W: storage.WriteDB, R: storage.WriteDB, Logger: w.logger}
+	apps, err := appdao.Select(&server.ApplicationMeta{Uuid: w.appid, TenantId: w.tenantid})
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]watchService, 0)
+	msg := map[string]any{"type": outbox.WatchSnapshot, "application": nil, "services": services}
+	if len(apps) == 0 {
+		return msg, nil
+	}
+	msg["application"] = &apps[0]
+
+	dao := AppapiPgDao{W: storage.WriteDB, R: storage.WriteDB, Logger: w.logger}
+	appapis, err := dao.Select(&server.AppapiMeta{Appid: w.appid, TenantId: w.tenantid})
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range appapis {
+		services = append(services, watchService{Service: m.Appapi.Service, Svcapis: m.Appapi.Svcapis})
+	}
+	msg["services"] = services
+
+	return msg, nil
+}
+
+func (w *watch) handle(e *outbox.Entry) ([]map[string]any, error) {
+	ev := &e.Event
+	if ev.TenantId != w.tenantid {
+		return nil, nil
+	}
+
+	appsvcdao := svrappsvc.AppsvcPgDao{W: storage.WriteDB, R: storage.WriteDB, Logger: w.logger}
+	appsvcdao.ShowDeleted = true
+
+	switch ev.Kind {
+	case "tenant":
+		// tenant 删除或恢复时 application 一起删除或恢复
+		if ev.Action == "update" {
+			return nil, nil
+		}
+	case "application":
+		if ev.Target != w.appid {
+			return nil, nil
+		}
+	case "appsvc":
+		total, err := appsvcdao.Count(&server.AppsvcMeta{Uuid: ev.Target, AppId: w.appid})
+		if err != nil || total == 0 {
+			return nil, err
+		}
+	case "service":
+		// 删除的关联也需要, service 和关联一起恢复时不会遗漏
+		total, err := appsvcdao.Count(&server.AppsvcMeta{AppId: w.appid, SvcId: ev.Target})
+		if err != nil || total == 0 {
+			return nil, err
+		}
+	case "svcapi":
+		return w.svcapi(ev)
+	default:
+		return nil, nil
+	}
+
+	msg, err := w.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return []map[string]any{msg}, nil
+}
+
+func (w *watch) svcapi(ev *server.OutboxEvent) ([]map[string]any, error) {
+	dao := svrapi.SvcapiPgDao{W: storage.WriteDB, R: storage.WriteDB, Logger: w.logger}
+	dao.ShowDeleted = true
+
+	apis, err := dao.Select(&server.SvcapiMeta{Uuid: ev.Target})
+	if err != nil || len(apis) == 0 {
+		return nil, err
+	}
+	api := apis[0]
+
+	appsvcdao := svrappsvc.AppsvcPgDao{W: storage.WriteDB, R: storage.WriteDB, Logger: w.logger}
+	total, err := appsvcdao.Count(&server.AppsvcMeta{AppId: w.appid, SvcId: api.ServiceId})
+	if err != nil || total == 0 {
+		return nil, err
+	}
+
+	// 事件之后又被删除时, 发送的是删除
+	t := outbox.ActionType(ev.Action)
+	if api.DeletedAt != nil {
+		t = outbox.WatchDelete
+	}
+
+	return []map[string]any{{"type": t, "service_id": api.ServiceId, "svcapi": &api}}, nil
+}
+
+// 请求 {"appid": 1, "revision": ""}, 需要 x-access-tenant. revision 为收到的最后一个消息的 revision, 为空时从完整数据开始.
+// 消息 {"type": "snapshot", "revision": "...", "application": {...}, "services": [{"service": {...}, "svcapis": [...]}]},
+// 或 {"type": "add" | "update" | "delete", "revision": "...", "service_id": 1, "svcapi": {...}}
+func (imp *AppapiWatchImp) Watch(req *structpb.Struct, stream AppapiWatch_WatchServer) (err error) {
+	ctx := stream.Context()
+	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
+	logger.Info("AppapiWatchImp Watch")
+
+	var tenant server.TenantMeta
+	tenant, err = svrtenant.CheckByMeta(ctx)
+	if err != nil {
+		return err
+	}
+
+	appid := int(req.GetFields()["appid"].GetNumberValue())
+	if appid <= 0 {
+		return server.InvalidArgumentErr("appid 不能为空")
+	}
+	revision := req.GetFields()["revision"].GetStringValue()
+
+	_, err = svrapp.CheckByMeta(ctx, tenant.Uuid, appid)
+	if err != nil {
+		return err
+	}
+
+	w := watch{tenantid: tenant.Uuid, appid: appid, logger: logger}
+	watcher := outbox.Watcher{
+		Hub:      imp.Hub,
+		Snapshot: w.snapshot,
+		Handle:   w.handle,
+		Send:     stream.Send,
+	}
+	if err = watcher.Run(ctx, revision); err != nil && ctx.Err() == nil {
+		logger.Warn("watch err", zap.String("error", err.Error()))
+		return server.SqlErr(err)
+	}
+
+	return nil
+}
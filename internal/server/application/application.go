@@ -8,10 +8,12 @@ import (
 	pb "github.com/crt379/svc-collector-grpc-proto/application"
 	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
 	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
 	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
 	"github.com/crt379/svc-collector-grpc/internal/storage"
 	"github.com/crt379/svc-collector-grpc/internal/types"
 	"github.com/crt379/svc-collector-grpc/internal/util"
+	"go.uber.org/zap"
 )
 
 type ApplicationImp struct {
@@ -71,10 +73,29 @@ func (imp *ApplicationImp) Create(ctx context.Context, req *pb.CreateRequest) (r
 	}
 	app.UpdateTime = app.CreateTime
 
-	app.Uuid, err = dao.Insert(&app)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	// tenant 在创建提交前不能被删除
+	if err = server.LockAlive(uow.Tx, logger, "tenant", tenant.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	cdao := server.NewCacheDao(&ApplicationPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	if app.Uuid, err = cdao.Insert(&app); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	app.Revision = server.InitRevision
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Created(kind, app.TenantId, app.Uuid, &app)); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, app.Uuid, app.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ := app.ToPbMeta()
 	resp.Application = &pbmeta
@@ -104,10 +125,20 @@ func (imp *ApplicationImp) Get(ctx context.Context, req *pb.GetRequest) (resp *p
 		Logger: logger,
 	}
 
+	if dao.ShowDeleted, err = server.BoolFromMeta(ctx, server.ShowDeletedKey); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	app.Uuid = int(req.Uuid)
 	app.Name = req.Name
 	app.TenantId = tenant.Uuid
 
+	var keyset *server.KeysetOption
+	keyset, err = server.KeysetFromMeta[server.ApplicationMeta](ctx, "")
+	if err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	total, err = dao.Count(&app)
 	if err != nil {
 		return server.SqlErrResp(&GResp{resp}, err)
@@ -122,15 +153,31 @@ func (imp *ApplicationImp) Get(ctx context.Context, req *pb.GetRequest) (resp *p
 		if req.Limit > 0 {
 			resp.Limit = req.Limit
 		}
-		var limitoption *server.LimitOption
-		if int(resp.Limit) < total {
-			limitoption = server.NewLimitOption(int(resp.Page), int(resp.Limit), "row_number")
+		var option server.DaoOption
+		if keyset != nil {
+			keyset.Limit = int(resp.Limit)
+			option = keyset
+		} else if int(resp.Limit) < total {
+			option = server.NewLimitOption(int(resp.Page), int(resp.Limit))
 		}
 
-		apps, err = dao.Select(&app, limitoption)
+		apps, err = dao.Select(&app, option)
 		if err != nil {
 			return server.SqlErrResp(&GResp{resp}, err)
 		}
+
+		var next string
+		apps, next = server.KeysetPage(keyset, apps)
+		if serr := server.SetNextPageToken(ctx, next); serr != nil {
+			logger.Warn("SetNextPageToken err", zap.String("error", serr.Error()))
+		}
+	}
+
+	if serr := server.SetRevisions(ctx, apps); serr != nil {
+		logger.Warn("SetRevisions err", zap.String("error", serr.Error()))
+	}
+	if serr := server.SetDeleted(ctx, apps); serr != nil {
+		logger.Warn("SetDeleted err", zap.String("error", serr.Error()))
 	}
 
 	resp.Count, resp.Applications, _ = server.Metas2Pbmeta[server.ApplicationMeta, pb.ApplicationMete](&apps)
@@ -143,7 +190,7 @@ func (imp *ApplicationImp) Delete(ctx context.Context, req *pb.DeleteRequest) (r
 	var (
 		tenant server.TenantMeta
 		app    server.ApplicationMeta
-		total  int
+		apps   []server.ApplicationMeta
 	)
 	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
 	logger.Info("ApplicationImp Delete")
@@ -168,19 +215,52 @@ func (imp *ApplicationImp) Delete(ctx context.Context, req *pb.DeleteRequest) (r
 	app.Uuid = int(req.Uuid)
 	app.TenantId = tenant.Uuid
 
-	total, err = dao.Count(&app)
+	apps, err = dao.Select(&app)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
 
-	if total == 0 {
+	if len(apps) == 0 {
 		return server.NotFoundResp(&DResp{resp}, fmt.Sprintf("application: %d 不存在", req.Uuid))
 	}
 
-	err = dao.Delete(&app)
+	app = apps[0]
+	if err = server.CheckRevision(ctx, app.Revision); err != nil {
+		return server.StatusResp(&DResp{resp}, err)
+	}
+
+	var cascade bool
+	if cascade, err = server.BoolFromMeta(ctx, server.CascadeKey); err != nil {
+		return server.ParamterResp(&DResp{resp}, err.Error())
+	}
+
+	// 默认有引用时拒绝删除, cascade 时在同一个事务中删除引用的数据
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
+	if err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+	defer uow.End(&err)
+
+	cdao := server.NewCacheDao(&ApplicationPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	record := audit.Cascaded(audit.SourceFromContext(ctx), logger, app.TenantId, kind, app.Uuid)
+
+	var counts []server.TableCount
+	counts, err = server.DeleteWithDependents(uow, table, Dependents(), app.Uuid, cascade, record, func(at types.Time) error {
+		if err := cdao.Delete(&server.ApplicationMeta{Uuid: app.Uuid, Revision: app.Revision, DeletedAt: &at}); err != nil {
+			return err
+		}
+		return audit.Record(ctx, uow.Tx, logger, audit.Deleted(kind, app.TenantId, app.Uuid, &app))
+	})
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
+	if cascade {
+		if serr := server.SetHeader(ctx, server.ImpactKey, server.FormatCounts(counts)); serr != nil {
+			logger.Warn("SetHeader err", zap.String("error", serr.Error()))
+		}
+	}
 
 	return server.OkResp(&DResp{resp})
 }
@@ -225,18 +305,48 @@ func (imp *ApplicationImp) Update(ctx context.Context, req *pb.UpdateRequest) (r
 
 	var newapp server.ApplicationMeta
 	app = apps[0]
+	before := app
+	if err = server.CheckRevision(ctx, app.Revision); err != nil {
+		return server.StatusResp(&UResp{resp}, err)
+	}
+
 	newapp.Name = req.Name
 	newapp.Describe = req.Describe
 
-	if !util.UpdateValueSame(&newapp, &app) {
+	var isupdate bool
+	isupdate, err = server.MergeUpdate(ctx, req, &newapp, &app, "name", "describe")
+	if err != nil {
+		return server.ParamterResp(&UResp{resp}, err.Error())
+	}
+	if !isupdate {
 		return server.ParamterResp(&UResp{resp}, "没有需要修改的内容")
 	}
+	if app.Name == "" {
+		return server.ParamterResp(&UResp{resp}, "name 不能为空")
+	}
+	if util.StrPunctIllegal(app.Name, '-') {
+		return server.ParamterResp(&UResp{resp}, "name 不能含有非'-'的字符")
+	}
 
 	app.UpdateTime = types.Time(time.Now())
-	_, err = dao.Update(&app)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&UResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	cdao := server.NewCacheDao(&ApplicationPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	if app, err = cdao.Update(&app); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Updated(kind, app.TenantId, app.Uuid, &before, &app)); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, app.Uuid, app.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ := app.ToPbMeta()
 	resp.Application = &pbmeta
@@ -19,21 +19,22 @@ func CheckByMeta(ctx context.Context, tenantid, uuid int) (app server.Applicatio
 
 	dao := ApplicationPgDao{
 		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		R:      storage.WriteDB,
 		Logger: logger,
 	}
 
-	var apps []server.ApplicationMeta
-	apps, err = dao.Select(&server.ApplicationMeta{Uuid: uuid, TenantId: tenantid})
+	// 读主库, 从库的旧数据会在删除缓存后写回. 缓存不区分 tenant, 读取后再检查
+	var found bool
+	app, found, err = Cache(logger).Load(uuid, func() ([]server.ApplicationMeta, error) {
+		return dao.Select(&server.ApplicationMeta{Uuid: uuid})
+	})
 	if err != nil {
-		return app, server.InternalErr(err.Error())
+		return app, server.SqlErr(err)
 	}
 
-	if len(apps) == 0 {
-		return app, server.NotFoundErr(fmt.Sprintf("application: %d not found", uuid))
+	if !found || app.TenantId != tenantid {
+		return server.ApplicationMeta{}, server.NotFoundErr(fmt.Sprintf("application: %d not found", uuid))
 	}
 
-	app = apps[0]
-
 	return app, nil
 }
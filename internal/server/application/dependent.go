@@ -0,0 +1,17 @@
+package application
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/server"
+)
+
+func aidCond(aid int) server.Cond {
+	return server.Eq("aid", aid)
+}
+
+// 引用 application 的表, 按删除顺序排列
+func Dependents() []server.Dependent {
+	return []server.Dependent{
+		{Table: "processor", Kind: "processor", Cond: aidCond},
+		{Table: "app_svc_relation", Kind: "appsvc", Cond: aidCond},
+	}
+}
@@ -53,14 +53,35 @@ func (imp *AppprocImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Ge
 		a3proc.Weight = &w
 	}
 
-	var a3procs []server.AppprocMeta
-	a3procs, err = dao.Select(&a3proc)
+	var total int
+	total, err = dao.Count(&a3proc)
 	if err != nil {
 		return server.SqlErrResp(&GResp{resp}, err)
 	}
 
+	var a3procs []server.AppprocMeta
+	resp.Page = 0
+	resp.Limit = 100
+	if total > 0 {
+		if req.Page > 0 {
+			resp.Page = req.Page
+		}
+		if req.Limit > 0 {
+			resp.Limit = req.Limit
+		}
+		var limitoption *server.LimitOption
+		if int(resp.Limit) < total {
+			limitoption = server.NewLimitOption(int(resp.Page), int(resp.Limit))
+		}
+
+		a3procs, err = dao.Select(&a3proc, limitoption)
+		if err != nil {
+			return server.SqlErrResp(&GResp{resp}, err)
+		}
+	}
+
 	resp.Count, resp.Appprocs, _ = server.Metas2Pbmeta[server.AppprocMeta, pb.AppprocMeta](&a3procs)
-	resp.Total = resp.Count
+	resp.Total = int32(total)
 
 	return server.OkResp(&GResp{resp})
 }
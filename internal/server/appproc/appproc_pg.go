@@ -13,8 +13,8 @@ import (
 var _ server.IDao[server.AppprocMeta] = (*AppprocPgDao)(nil)
 
 type AppprocPgDao struct {
-	W      *sqlx.DB
-	R      *sqlx.DB
+	W      server.DB
+	R      server.DB
 	Logger *zap.Logger
 	server.Dao
 	server.DaoLog
@@ -24,49 +24,67 @@ func (d *AppprocPgDao) Insert(meta *server.AppprocMeta) (int, error) {
 	return 0, fmt.Errorf("method not implemented")
 }
 
-func (d *AppprocPgDao) Select(meta *server.AppprocMeta, ops ...server.DaoOption) (objs []server.AppprocMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+func (d *AppprocPgDao) procConditions(meta *server.AppprocMeta) []server.Cond {
+	cs := make([]server.Cond, 0)
+	procd := svrproc.ProcessorPgDao{}
 
+	if meta.Weight != nil {
+		cs = append(cs, server.Eq(d.Field(procd.Table(), "weight"), *meta.Weight))
+	}
+	if meta.State != "" {
+		cs = append(cs, server.Eq(d.Field(procd.Table(), "state"), meta.State))
+	}
+	if meta.TenantId != 0 {
+		cs = append(cs, server.Eq(d.Field(procd.Table(), "tenant_id"), meta.TenantId))
+	}
+	cs = append(cs, d.Alive(procd.Table())...)
+
+	return cs
+}
+
+// 一个 application 为一组, 查询有符合条件的 processor 的组
+func (d *AppprocPgDao) groups(meta *server.AppprocMeta, columns ...string) *server.SelectBuilder {
+	cs := make([]server.Cond, 0)
 	appd := svrapp.ApplicationPgDao{}
 	procd := svrproc.ProcessorPgDao{}
 
 	if meta.Appid != 0 {
-		k = append(k, d.Field(appd.Table(), "uuid"))
-		args = append(args, meta.Appid)
+		cs = append(cs, server.Eq(d.Field(appd.Table(), "uuid"), meta.Appid))
 	}
 	if meta.Appname != "" {
-		k = append(k, d.Field(appd.Table(), "name"))
-		args = append(args, meta.Appname)
-	}
-	if meta.Weight != nil {
-		k = append(k, d.Field(procd.Table(), "weight"))
-		args = append(args, *meta.Weight)
-	}
-	if meta.State != "" {
-		k = append(k, d.Field(procd.Table(), "state"))
-		args = append(args, meta.State)
+		cs = append(cs, server.Eq(d.Field(appd.Table(), "name"), meta.Appname))
 	}
 	if meta.TenantId != 0 {
-		k = append(k, d.Field(appd.Table(), "tenant_id"))
-		args = append(args, meta.TenantId)
+		cs = append(cs, server.Eq(d.Field(appd.Table(), "tenant_id"), meta.TenantId))
 	}
+	cs = append(cs, d.Alive(appd.Table())...)
+	cs = append(cs, server.Exists(
+		server.Select("1").
+			From(procd.Table()).
+			Where(server.EqCol(d.Field(appd.Table(), "uuid"), d.Field(procd.Table(), "aid"))).
+			Where(d.procConditions(meta)...),
+	))
+
+	return server.Select(columns...).From(appd.Table()).Where(cs...)
+}
 
-	optconditions := make([]string, 0)
-	for _, op := range ops {
-		optconditions = append(optconditions, op.Conditions()...)
-	}
-	optconditions = append(optconditions,
-		d.Equal(d.Field(appd.Table(), "uuid"), d.Field(procd.Table(), "aid")),
-	)
-
-	query := d.SelectSQL(
-		"",
-		d.Comma(procd.Table(), appd.Table()),
-		fields(),
-		k,
-		optconditions...,
-	)
+// ops 作用于组, 分页按组进行
+func (d *AppprocPgDao) Select(meta *server.AppprocMeta, ops ...server.DaoOption) (objs []server.AppprocMeta, err error) {
+	appd := svrapp.ApplicationPgDao{}
+	procd := svrproc.ProcessorPgDao{}
+
+	groups := d.groups(meta, d.Field(appd.Table(), "uuid")).
+		OrderBy(d.Field(appd.Table(), "uuid")).
+		Options(ops...)
+
+	query, args := server.Select(fields()).
+		With("g", groups).
+		From("g").
+		Join(appd.Table(), server.EqCol(d.Field(appd.Table(), "uuid"), "g.uuid")).
+		Join(procd.Table(), server.EqCol(d.Field(appd.Table(), "uuid"), d.Field(procd.Table(), "aid"))).
+		Where(d.procConditions(meta)...).
+		OrderBy(d.Field(appd.Table(), "uuid"), d.Field(procd.Table(), "uuid")).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -98,8 +116,14 @@ func (d *AppprocPgDao) Select(meta *server.AppprocMeta, ops ...server.DaoOption)
 	return objs, err
 }
 
+// 组的数量
 func (d *AppprocPgDao) Count(meta *server.AppprocMeta) (count int, err error) {
-	return 0, fmt.Errorf("method not implemented")
+	query, args := d.groups(meta, "count(*)").ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.R.QueryRowx(query, args...).Scan(&count)
+
+	return count, err
 }
 
 func (d *AppprocPgDao) Delete(meta *server.AppprocMeta) error {
@@ -2,9 +2,57 @@ package appproc
 
 import (
 	pb "github.com/crt379/svc-collector-grpc-proto/appproc"
+	"github.com/crt379/svc-collector-grpc/internal/server/outbox"
+
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func RegisterServer(srv *grpc.Server) {
 	pb.RegisterAppprocServer(srv, &AppprocImp{})
 }
+
+// Watch 没有 proto 定义, 请求和消息都使用 google.protobuf.Struct
+type AppprocWatchServer interface {
+	Watch(*structpb.Struct, AppprocWatch_WatchServer) error
+}
+
+type AppprocWatch_WatchServer interface {
+	Send(*structpb.Struct) error
+	grpc.ServerStream
+}
+
+type appprocWatchWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *appprocWatchWatchServer) Send(m *structpb.Struct) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _AppprocWatch_Watch_Handler(srv any, stream grpc.ServerStream) error {
+	m := new(structpb.Struct)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AppprocWatchServer).Watch(m, &appprocWatchWatchServer{stream})
+}
+
+// 接口定义见 proto/appproc/appproc_watch.proto, Metadata 为相对 proto 目录的路径
+var AppprocWatch_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "appproc.AppprocWatch",
+	HandlerType: (*AppprocWatchServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _AppprocWatch_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "appproc/appproc_watch.proto",
+}
+
+func RegisterWatchServer(srv *grpc.Server, hub *outbox.Hub) {
+	srv.RegisterService(&AppprocWatch_ServiceDesc, &AppprocWatchImp{Hub: hub})
+}
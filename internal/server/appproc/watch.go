@@ -0,0 +1,143 @@
+package appproc
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	svrapp "github.com/crt379/svc-collector-grpc/internal/server/application"
+	"github.com/crt379/svc-collector-grpc/internal/server/outbox"
+	svrproc "github.com/crt379/svc-collector-grpc/internal/server/processor"
+	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type AppprocWatchImp struct {
+	Hub *outbox.Hub
+}
+
+var _ AppprocWatchServer = (*AppprocWatchImp)(nil)
+
+// 一个 application 的 processor. 事件在主库提交后发布, 都从主库读取, 从库延迟时会发送旧数据或丢失事件
+type watch struct {
+	tenantid int
+	appid    int
+	logger   *zap.Logger
+}
+
+func (w *watch) snapshot() (map[string]any, error) {
+	appdao := svrapp.ApplicationPgDao{W: storage.WriteDB, R: storage.WriteDB, Logger: w.logger}
+	apps, err := appdao.Select(&server.ApplicationMeta{Uuid: w.appid, TenantId: w.tenantid})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := map[string]any{"type": outbox.WatchSnapshot, "application": nil, "processors": []server.ProcessorMeta{}}
+	if len(apps) == 0 {
+		return msg, nil
+	}
+	msg["application"] = &apps[0]
+
+	procdao := svrproc.ProcessorPgDao{W: storage.WriteDB, R: storage.WriteDB, Logger: w.logger}
+	procs, err := procdao.Select(&server.ProcessorMeta{AppId: w.appid})
+	if err != nil {
+		return nil, err
+	}
+	if len(procs) > 0 {
+		msg["processors"] = procs
+	}
+
+	return msg, nil
+}
+
+func (w *watch) handle(e *outbox.Entry) ([]map[string]any, error) {
+	ev := &e.Event
+	if ev.TenantId != w.tenantid {
+		return nil, nil
+	}
+
+	switch ev.Kind {
+	case "tenant":
+		// tenant 删除或恢复时 application 一起删除或恢复
+		if ev.Action == "update" {
+			return nil, nil
+		}
+	case "application":
+		if ev.Target != w.appid {
+			return nil, nil
+		}
+	case "processor":
+		return w.processor(ev)
+	default:
+		return nil, nil
+	}
+
+	msg, err := w.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return []map[string]any{msg}, nil
+}
+
+func (w *watch) processor(ev *server.OutboxEvent) ([]map[string]any, error) {
+	dao := svrproc.ProcessorPgDao{W: storage.WriteDB, R: storage.WriteDB, Logger: w.logger}
+	dao.ShowDeleted = true
+
+	procs, err := dao.Select(&server.ProcessorMeta{Uuid: ev.Target})
+	if err != nil || len(procs) == 0 {
+		return nil, err
+	}
+	proc := procs[0]
+	if proc.AppId != w.appid {
+		return nil, nil
+	}
+
+	// 事件之后又被删除时, 发送的是删除
+	t := outbox.ActionType(ev.Action)
+	if proc.DeletedAt != nil {
+		t = outbox.WatchDelete
+	}
+
+	return []map[string]any{{"type": t, "processor": &proc}}, nil
+}
+
+// 请求 {"appid": 1, "revision": ""}, 需要 x-access-tenant. revision 为收到的最后一个消息的 revision, 为空时从完整数据开始.
+// 消息 {"type": "snapshot", "revision": "...", "application": {...}, "processors": [...]},
+// 或 {"type": "add" | "update" | "delete", "revision": "...", "processor": {...}}
+func (imp *AppprocWatchImp) Watch(req *structpb.Struct, stream AppprocWatch_WatchServer) (err error) {
+	ctx := stream.Context()
+	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
+	logger.Info("AppprocWatchImp Watch")
+
+	var tenant server.TenantMeta
+	tenant, err = svrtenant.CheckByMeta(ctx)
+	if err != nil {
+		return err
+	}
+
+	appid := int(req.GetFields()["appid"].GetNumberValue())
+	if appid <= 0 {
+		return server.InvalidArgumentErr("appid 不能为空")
+	}
+	revision := req.GetFields()["revision"].GetStringValue()
+
+	_, err = svrapp.CheckByMeta(ctx, tenant.Uuid, appid)
+	if err != nil {
+		return err
+	}
+
+	w := watch{tenantid: tenant.Uuid, appid: appid, logger: logger}
+	watcher := outbox.Watcher{
+		Hub:      imp.Hub,
+		Snapshot: w.snapshot,
+		Handle:   w.handle,
+		Send:     stream.Send,
+	}
+	if err = watcher.Run(ctx, revision); err != nil && ctx.Err() == nil {
+		logger.Warn("watch err", zap.String("error", err.Error()))
+		return server.SqlErr(err)
+	}
+
+	return nil
+}
@@ -9,10 +9,12 @@ import (
 	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
 	"github.com/crt379/svc-collector-grpc/internal/server"
 	svrapp "github.com/crt379/svc-collector-grpc/internal/server/application"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
 	svrsvc "github.com/crt379/svc-collector-grpc/internal/server/service"
 	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
 	"github.com/crt379/svc-collector-grpc/internal/storage"
 	"github.com/crt379/svc-collector-grpc/internal/types"
+	"go.uber.org/zap"
 )
 
 type AppsvcImp struct {
@@ -56,9 +58,16 @@ func (imp *AppsvcImp) Create(ctx context.Context, req *pb.CreateRequest) (resp *
 		return resp, err
 	}
 
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
+	if err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	defer uow.End(&err)
+
 	dao := AppsvcPgDao{
-		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		W:      uow.Tx,
+		R:      uow.Tx,
 		Logger: logger,
 	}
 
@@ -78,8 +87,20 @@ func (imp *AppsvcImp) Create(ctx context.Context, req *pb.CreateRequest) (resp *
 	}
 	appsvc.UpdateTime = appsvc.CreateTime
 
-	appsvc.Uuid, err = dao.Insert(&appsvc)
-	if err != nil {
+	// tenant, application 和 service 在创建提交前不能被删除
+	if err = server.LockAlive(uow.Tx, logger, "tenant", tenant.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if err = server.LockAlive(uow.Tx, logger, "application", app.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if err = server.LockAlive(uow.Tx, logger, "service", svc.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if appsvc.Uuid, err = dao.Insert(&appsvc); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Created(kind, app.TenantId, appsvc.Uuid, &appsvc)); err != nil {
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
 
@@ -108,6 +129,13 @@ func (imp *AppsvcImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 		Logger: logger,
 	}
 
+	if dao.ShowDeleted, err = server.BoolFromMeta(ctx, server.ShowDeletedKey); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+	if dao.AsOf, err = server.AsOfFromMeta(ctx); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	var total int
 	appsvc := server.AppsvcMeta{
 		Uuid:    int(req.Uuid),
@@ -116,6 +144,12 @@ func (imp *AppsvcImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 		SvcName: req.Svcname,
 	}
 
+	var keyset *server.KeysetOption
+	keyset, err = server.KeysetFromMeta[server.AppsvcMeta](ctx, dao.Table())
+	if err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	total, err = dao.Count(&appsvc)
 	if err != nil {
 		return server.SqlErrResp(&GResp{resp}, err)
@@ -131,15 +165,28 @@ func (imp *AppsvcImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 		if req.Limit > 0 {
 			resp.Limit = req.Limit
 		}
-		var limitoption *server.LimitOption
-		if int(resp.Limit) < total {
-			limitoption = server.NewLimitOption(int(resp.Page), int(resp.Limit), "row_number")
+		var option server.DaoOption
+		if keyset != nil {
+			keyset.Limit = int(resp.Limit)
+			option = keyset
+		} else if int(resp.Limit) < total {
+			option = server.NewLimitOption(int(resp.Page), int(resp.Limit))
 		}
 
-		appsvcs, err = dao.SelectAndService(&appsvc, limitoption)
+		appsvcs, err = dao.SelectAndService(&appsvc, option)
 		if err != nil {
 			return server.SqlErrResp(&GResp{resp}, err)
 		}
+
+		var next string
+		appsvcs, next = server.KeysetPage(keyset, appsvcs)
+		if serr := server.SetNextPageToken(ctx, next); serr != nil {
+			logger.Warn("SetNextPageToken err", zap.String("error", serr.Error()))
+		}
+	}
+
+	if serr := server.SetDeleted(ctx, appsvcs); serr != nil {
+		logger.Warn("SetDeleted err", zap.String("error", serr.Error()))
 	}
 
 	resp.Count, resp.Appsvcs, _ = server.Metas2Pbmeta[server.AppsvcMeta, pb.AppsvcMeta](&appsvcs)
@@ -153,7 +200,7 @@ func (imp *AppsvcImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *
 		app server.ApplicationMeta
 	)
 	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
-	logger.Info("AppsvcImp Create")
+	logger.Info("AppsvcImp Delete")
 
 	_, app, err = imp.pre(ctx, int(req.Appid))
 	if err != nil {
@@ -170,19 +217,26 @@ func (imp *AppsvcImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *
 		Uuid:  int(req.Uuid),
 		AppId: app.Uuid,
 	}
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
+	if err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+	defer uow.End(&err)
+
 	dao := AppsvcPgDao{
-		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		W:      uow.Tx,
+		R:      uow.Tx,
 		Logger: logger,
 	}
 
-	var total int
-	total, err = dao.Count(&appsvc)
+	var appsvcs []server.AppsvcMeta
+	appsvcs, err = dao.Select(&appsvc)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
 
-	if total == 0 {
+	if len(appsvcs) == 0 {
 		return server.NotFoundResp(&DResp{resp}, fmt.Sprintf("appsvc: %d 不存在", req.Uuid))
 	}
 
@@ -191,5 +245,10 @@ func (imp *AppsvcImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
 
+	err = audit.Record(ctx, uow.Tx, logger, audit.Deleted(kind, app.TenantId, appsvc.Uuid, &appsvcs[0]))
+	if err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+
 	return server.OkResp(&DResp{resp})
 }
@@ -2,7 +2,6 @@ package appsvc
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/crt379/svc-collector-grpc/internal/server"
 	svrsvc "github.com/crt379/svc-collector-grpc/internal/server/service"
@@ -14,17 +13,17 @@ var _ server.IDao[server.AppsvcMeta] = (*AppsvcPgDao)(nil)
 
 const (
 	table = "app_svc_relation"
+	// 审计记录中的资源类型
+	kind = "appsvc"
 )
 
 var (
-	_fields   = [...]string{"uuid", "aid", "sid", "create_time", "update_time"}
-	_fields_0 = strings.Join(_fields[:], ",")
-	_fields_1 = strings.Join(_fields[1:], ",")
+	_fields = [...]string{"uuid", "aid", "sid", "create_time", "update_time", "deleted_at"}
 )
 
 type AppsvcPgDao struct {
-	W      *sqlx.DB
-	R      *sqlx.DB
+	W      server.DB
+	R      server.DB
 	Logger *zap.Logger
 	server.Dao
 	server.DaoLog
@@ -34,20 +33,12 @@ func (d *AppsvcPgDao) Table() string {
 	return table
 }
 
-func (d *AppsvcPgDao) fieldsStr(s int) string {
-	switch s {
-	case 0:
-		return _fields_0
-	case 1:
-		return _fields_1
-	}
-	return strings.Join(_fields[s:], ",")
-}
-
 func (d *AppsvcPgDao) Insert(meta *server.AppsvcMeta) (uuid int, err error) {
-	args := []any{meta.AppId, meta.SvcId, meta.CreateTime, meta.UpdateTime}
-
-	query := d.InsertSQL(d.Table(), d.fieldsStr(1), len(args), "uuid")
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:]...).
+		Values(meta.AppId, meta.SvcId, meta.CreateTime, meta.UpdateTime, meta.DeletedAt).
+		Returning("uuid").
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).Scan(&uuid)
@@ -56,30 +47,27 @@ func (d *AppsvcPgDao) Insert(meta *server.AppsvcMeta) (uuid int, err error) {
 }
 
 func (d *AppsvcPgDao) Select(meta *server.AppsvcMeta, ops ...server.DaoOption) (objs []server.AppsvcMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
 	if meta.AppId != 0 {
-		k = append(k, "aid")
-		args = append(args, meta.AppId)
+		cs = append(cs, server.Eq("aid", meta.AppId))
 	}
 	if meta.SvcId != 0 {
-		k = append(k, "sid")
-		args = append(args, meta.SvcId)
+		cs = append(cs, server.Eq("sid", meta.SvcId))
 	}
 
-	optconditions := make([]string, 0)
-	for _, op := range ops {
-		optconditions = append(optconditions, op.Conditions()...)
-	}
+	cs = append(cs, d.Alive(d.Table())...)
 
-	query := d.SelectAddRowNumberSQL(d.Table(), d.fieldsStr(0), "uuid", k)
-	query = d.WithSQL("t", query)
-	query = d.SelectSQL(query, "t", d.fieldsStr(0), nil, optconditions...)
+	query, args := server.Select(_fields[:]...).
+		From(d.Table()).
+		Where(cs...).
+		OrderBy("uuid").
+		Options(d.Snapshot(d.Table())).
+		Options(ops...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -93,44 +81,33 @@ func (d *AppsvcPgDao) Select(meta *server.AppsvcMeta, ops ...server.DaoOption) (
 }
 
 func (d *AppsvcPgDao) SelectAndService(meta *server.AppsvcMeta, ops ...server.DaoOption) (objs []server.AppsvcMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, d.Field(d.Table(), "uuid"))
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq(d.Field(d.Table(), "uuid"), meta.Uuid))
 	}
 	if meta.AppId != 0 {
-		k = append(k, d.Field(d.Table(), "aid"))
-		args = append(args, meta.AppId)
+		cs = append(cs, server.Eq(d.Field(d.Table(), "aid"), meta.AppId))
 	}
 	if meta.SvcId != 0 {
-		k = append(k, d.Field(d.Table(), "sid"))
-		args = append(args, meta.SvcId)
+		cs = append(cs, server.Eq(d.Field(d.Table(), "sid"), meta.SvcId))
 	}
 
 	sd := svrsvc.ServicePgDao{}
 	if meta.SvcName != "" {
-		k = append(k, d.Field(sd.Table(), "name"))
-		args = append(args, meta.SvcName)
+		cs = append(cs, server.Eq(d.Field(sd.Table(), "name"), meta.SvcName))
 	}
+	cs = append(cs, d.Alive(d.Table())...)
 
-	optconditions := make([]string, 0)
-	for _, op := range ops {
-		optconditions = append(optconditions, op.Conditions()...)
-	}
-	optconditions = append(optconditions,
+	query, args := server.Select(fields()).
+		From(d.Table()).
 		// t1.sid = t2.uuid
-		d.Equal(d.Field(d.Table(), "sid"), d.Field(sd.Table(), "uuid")),
-	)
-
-	query := d.SelectSQL(
-		"",
-		d.Comma(d.Table(), sd.Table()),
-		fields(),
-		k,
-		optconditions...,
-	)
+		Join(sd.Table(), server.EqCol(d.Field(d.Table(), "sid"), d.Field(sd.Table(), "uuid"))).
+		Where(cs...).
+		OrderBy(d.Field(d.Table(), "uuid")).
+		Options(d.Snapshot(d.Table(), sd.Table())).
+		Options(ops...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -149,23 +126,21 @@ func (d *AppsvcPgDao) SelectAndService(meta *server.AppsvcMeta, ops ...server.Da
 }
 
 func (d *AppsvcPgDao) Count(meta *server.AppsvcMeta) (count int, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
 	if meta.AppId != 0 {
-		k = append(k, "aid")
-		args = append(args, meta.AppId)
+		cs = append(cs, server.Eq("aid", meta.AppId))
 	}
 	if meta.SvcId != 0 {
-		k = append(k, "sid")
-		args = append(args, meta.SvcId)
+		cs = append(cs, server.Eq("sid", meta.SvcId))
 	}
 
-	query := d.SelectSQL("", d.Table(), "count(*)", k)
+	cs = append(cs, d.Alive(d.Table())...)
+
+	query, args := server.Select("count(*)").From(d.Table()).Where(cs...).Options(d.Snapshot(d.Table())).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.R.QueryRowx(query, args...).Scan(&count)
@@ -174,18 +149,21 @@ func (d *AppsvcPgDao) Count(meta *server.AppsvcMeta) (count int, err error) {
 }
 
 func (d *AppsvcPgDao) Delete(meta *server.AppsvcMeta) (err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
-	if len(k) == 0 {
+	if len(cs) == 0 {
 		return nil
 	}
 
-	query := d.DeleteSQL(d.Table(), k)
+	cs = append(cs, server.IsNull(server.DeletedAtCol))
+
+	query, args := server.Update(d.Table()).
+		Set(server.DeletedAtCol, server.DeleteTime(meta.DeletedAt)).
+		Where(cs...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	_, err = d.W.Exec(query, args...)
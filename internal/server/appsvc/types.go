@@ -74,11 +74,12 @@ func (r *DResp) GetPBResp() *pb.DeleteReply {
 // }
 
 type appsvc struct {
-	Uuid       int        `db:"uuid"`
-	AppId      int        `db:"aid"`
-	SvcId      int        `db:"sid"`
-	CreateTime types.Time `db:"create_time"`
-	UpdateTime types.Time `db:"update_time"`
+	Uuid       int         `db:"uuid"`
+	AppId      int         `db:"aid"`
+	SvcId      int         `db:"sid"`
+	CreateTime types.Time  `db:"create_time"`
+	UpdateTime types.Time  `db:"update_time"`
+	DeletedAt  *types.Time `db:"deleted_at"`
 }
 
 type appsvcsvc struct {
@@ -102,6 +103,7 @@ func fields() string {
 			d.Field(d.Table(), "sid"),
 			d.Field(d.Table(), "create_time"),
 			d.Field(d.Table(), "update_time"),
+			d.Field(d.Table(), "deleted_at"),
 			d.FieldAs(sd.Table(), "uuid", "s_uuid"),
 			d.FieldAs(sd.Table(), "name", "s_name"),
 			d.FieldAs(sd.Table(), "describe", "s_describe"),
@@ -126,6 +128,7 @@ func (a AppsvcSvcDB) ToAppsvcMeta() server.AppsvcMeta {
 		SvcId:      a.appsvc.SvcId,
 		CreateTime: a.appsvc.CreateTime,
 		UpdateTime: a.appsvc.UpdateTime,
+		DeletedAt:  a.appsvc.DeletedAt,
 		Service: server.ServiceMeta{
 			Uuid:       a.appsvcsvc.Uuid,
 			Name:       a.appsvcsvc.Name,
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/auth"
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type AuditImp struct {
+	// 请求的 tenant, 为 tenant.CheckByMeta. tenant 引用 audit, 由 main 传入
+	Tenant func(ctx context.Context) (server.TenantMeta, error)
+}
+
+var _ AuditServer = (*AuditImp)(nil)
+
+func parseTime(key string, v *structpb.Value) (t time.Time, err error) {
+	s := v.GetStringValue()
+	if s == "" {
+		return t, nil
+	}
+	if t, err = server.ParseTime(s); err != nil {
+		return t, fmt.Errorf("invalid %s: %s", key, s)
+	}
+	return t, nil
+}
+
+// 请求 {"kind": "service", "target": 1, "actor": "", "tenant_id": 0, "action": "", "start": "", "end": "", "page": 0, "limit": 100},
+// 零值不作为条件, tenant_id 只有 super-admin 可以指定, 其他请求只查询 x-access-tenant 的记录. 响应 {"code": 10000, "message": "success", "total": 1, "audits": [...]}, 按时间倒序
+func (imp *AuditImp) Get(ctx context.Context, req *structpb.Struct) (resp *structpb.Struct, err error) {
+	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
+	logger.Info("AuditImp Get")
+
+	resp = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+
+	fields := req.GetFields()
+	f := Filter{
+		Actor:    fields["actor"].GetStringValue(),
+		TenantId: int(fields["tenant_id"].GetNumberValue()),
+		Kind:     fields["kind"].GetStringValue(),
+		Target:   int(fields["target"].GetNumberValue()),
+		Action:   fields["action"].GetStringValue(),
+	}
+	if !auth.IsSuperAdmin(ctx) {
+		var tenant server.TenantMeta
+		if tenant, err = imp.Tenant(ctx); err != nil {
+			return server.StatusResp(&GResp{resp}, err)
+		}
+		f.TenantId = tenant.Uuid
+	}
+	if f.Start, err = parseTime("start", fields["start"]); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+	if f.End, err = parseTime("end", fields["end"]); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
+	page := int(fields["page"].GetNumberValue())
+	limit := int(fields["limit"].GetNumberValue())
+	if page < 0 {
+		page = 0
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	dao := AuditPgDao{
+		W:      storage.WriteDB,
+		R:      storage.ReadDB,
+		Logger: logger,
+	}
+
+	var total int
+	total, err = dao.Count(&f)
+	if err != nil {
+		return server.SqlErrResp(&GResp{resp}, err)
+	}
+
+	var audits []server.AuditMeta
+	if total > 0 {
+		audits, err = dao.Select(&f, server.NewLimitOption(page, limit))
+		if err != nil {
+			return server.SqlErrResp(&GResp{resp}, err)
+		}
+	}
+
+	values := make([]*structpb.Value, 0, len(audits))
+	for i := range audits {
+		var s *structpb.Struct
+		s, err = audits[i].ToStruct()
+		if err != nil {
+			return server.InternalResp(&GResp{resp}, err)
+		}
+		values = append(values, structpb.NewStructValue(s))
+	}
+	resp.Fields["total"] = structpb.NewNumberValue(float64(total))
+	resp.Fields["audits"] = structpb.NewListValue(&structpb.ListValue{Values: values})
+
+	return server.OkResp(&GResp{resp})
+}
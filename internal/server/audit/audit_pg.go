@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	table = "audit"
+)
+
+var (
+	_fields = [...]string{"uuid", "actor", "tenant_id", "kind", "target", "action", "before", "after", "trace_id", "create_time"}
+)
+
+// 查询条件, 零值不作为条件. 时间范围为 [Start, End)
+type Filter struct {
+	Actor    string
+	TenantId int
+	Kind     string
+	Target   int
+	Action   string
+	Start    time.Time
+	End      time.Time
+}
+
+type AuditPgDao struct {
+	W      server.DB
+	R      server.DB
+	Logger *zap.Logger
+	server.Dao
+	server.DaoLog
+}
+
+func (d *AuditPgDao) Table() string {
+	return table
+}
+
+func (d *AuditPgDao) Insert(meta *server.AuditMeta) (uuid int, err error) {
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:]...).
+		Values(meta.Actor, meta.TenantId, meta.Kind, meta.Target, meta.Action, meta.Before, meta.After, meta.TraceId, meta.CreateTime).
+		Returning("uuid").
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.W.QueryRowx(query, args...).Scan(&uuid)
+
+	return uuid, err
+}
+
+func (d *AuditPgDao) conditions(f *Filter) []server.Cond {
+	cs := make([]server.Cond, 0)
+
+	if f.Actor != "" {
+		cs = append(cs, server.Eq("actor", f.Actor))
+	}
+	if f.TenantId != 0 {
+		cs = append(cs, server.Eq("tenant_id", f.TenantId))
+	}
+	if f.Kind != "" {
+		cs = append(cs, server.Eq("kind", f.Kind))
+	}
+	if f.Target != 0 {
+		cs = append(cs, server.Eq("target", f.Target))
+	}
+	if f.Action != "" {
+		cs = append(cs, server.Eq("action", f.Action))
+	}
+	if !f.Start.IsZero() {
+		cs = append(cs, server.Ge("create_time", types.Time(f.Start)))
+	}
+	if !f.End.IsZero() {
+		cs = append(cs, server.Lt("create_time", types.Time(f.End)))
+	}
+
+	return cs
+}
+
+// 按时间倒序
+func (d *AuditPgDao) Select(f *Filter, ops ...server.DaoOption) (objs []server.AuditMeta, err error) {
+	query, args := server.Select(_fields[:]...).
+		From(d.Table()).
+		Where(d.conditions(f)...).
+		OrderBy("create_time DESC", "uuid DESC").
+		Options(ops...).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var rows *sqlx.Rows
+	rows, err = d.R.Queryx(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	err = server.RowsToStructs(&objs, rows)
+
+	return objs, err
+}
+
+func (d *AuditPgDao) Count(f *Filter) (count int, err error) {
+	query, args := server.Select("count(*)").From(d.Table()).Where(d.conditions(f)...).ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.R.QueryRowx(query, args...).Scan(&count)
+
+	return count, err
+}
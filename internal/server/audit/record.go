@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/server/outbox"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	// 被拒绝的请求, 没有修改数据
+	ActionDenied = "denied"
+)
+
+// 一次修改, Before 和 After 为修改前后的数据, 写入时转换为 json
+type Change struct {
+	Kind     string
+	Action   string
+	TenantId int
+	Target   int
+	Before   any
+	After    any
+}
+
+func Created(kind string, tenantid int, target int, after any) Change {
+	return Change{Kind: kind, Action: ActionCreate, TenantId: tenantid, Target: target, After: after}
+}
+
+func Updated(kind string, tenantid int, target int, before any, after any) Change {
+	return Change{Kind: kind, Action: ActionUpdate, TenantId: tenantid, Target: target, Before: before, After: after}
+}
+
+func Deleted(kind string, tenantid int, target int, before any) Change {
+	return Change{Kind: kind, Action: ActionDelete, TenantId: tenantid, Target: target, Before: before}
+}
+
+// 被拒绝的请求, attempt 为请求的内容
+func Denied(kind string, attempt any) Change {
+	return Change{Kind: kind, Action: ActionDenied, After: attempt}
+}
+
+// 审计记录的操作者和 trace id
+type Source struct {
+	Actor   string
+	TraceId string
+}
+
+func SourceFromContext(ctx context.Context) (src Source) {
+	if actor, ok := (ctxvalue.ActorContext{}).GetValue(ctx); ok {
+		src.Actor = *actor
+	}
+	if traceid, ok := (ctxvalue.TraceContext{}).GetValue(ctx); ok {
+		src.TraceId = *traceid
+	}
+	return src
+}
+
+func marshal(v any) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := string(buf)
+	return &s, nil
+}
+
+// 写入审计记录和变更事件, db 为修改所在的事务
+func Write(db server.DB, logger *zap.Logger, src Source, c Change) (err error) {
+	meta := server.AuditMeta{
+		Actor:      src.Actor,
+		TenantId:   c.TenantId,
+		Kind:       c.Kind,
+		Target:     c.Target,
+		Action:     c.Action,
+		TraceId:    src.TraceId,
+		CreateTime: types.Time(time.Now()),
+	}
+	if meta.Before, err = marshal(c.Before); err != nil {
+		return err
+	}
+	if meta.After, err = marshal(c.After); err != nil {
+		return err
+	}
+
+	dao := AuditPgDao{W: db, R: db, Logger: logger}
+	if _, err = dao.Insert(&meta); err != nil {
+		return err
+	}
+	if c.Action == ActionDenied {
+		return nil
+	}
+
+	return outbox.Append(db, logger, &server.OutboxEvent{
+		Kind:       meta.Kind,
+		Action:     meta.Action,
+		TenantId:   meta.TenantId,
+		Target:     meta.Target,
+		Actor:      meta.Actor,
+		TraceId:    meta.TraceId,
+		CreateTime: meta.CreateTime,
+	})
+}
+
+// 级联修改的数据的来源, 写入审计记录的 after
+type CascadeSource struct {
+	Kind string `json:"kind"`
+	Uuid int    `json:"uuid"`
+}
+
+// 为级联删除或恢复的每一行写入审计记录和变更事件, kind 和 uuid 为直接删除或恢复的数据
+func Cascaded(src Source, logger *zap.Logger, tenantid int, kind string, uuid int) server.CascadeRecorder {
+	from := map[string]CascadeSource{"cascade": {Kind: kind, Uuid: uuid}}
+	return func(db server.DB, dkind string, deleted bool, uuids []int) error {
+		action := ActionRestore
+		if deleted {
+			action = ActionDelete
+		}
+		for _, target := range uuids {
+			c := Change{Kind: dkind, Action: action, TenantId: tenantid, Target: target, After: from}
+			if err := Write(db, logger, src, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// 写入请求的审计记录, 操作者和 trace id 从 ctx 读取
+func Record(ctx context.Context, db server.DB, logger *zap.Logger, c Change) error {
+	return Write(db, logger, SourceFromContext(ctx), c)
+}
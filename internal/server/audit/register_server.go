@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type AuditServer interface {
+	Get(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+func _Audit_Get_Handler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuditServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/audit.Audit/Get",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(AuditServer).Get(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// 接口定义见 proto/audit/audit.proto, Metadata 为相对 proto 目录的路径
+var Audit_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "audit.Audit",
+	HandlerType: (*AuditServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Audit_Get_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "audit/audit.proto",
+}
+
+func RegisterServer(srv *grpc.Server, tenant func(ctx context.Context) (server.TenantMeta, error)) {
+	srv.RegisterService(&Audit_ServiceDesc, &AuditImp{Tenant: tenant})
+}
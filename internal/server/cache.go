@@ -0,0 +1,338 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultCacheTTL     = 10 * time.Minute
+	DefaultCacheMissTTL = 30 * time.Second
+
+	// 负缓存的值, 表示数据不存在
+	cacheMissing = "-"
+
+	CacheLocal  = "local"
+	CacheHit    = "hit"
+	CacheMiss   = "miss"
+	CacheAbsent = "absent"
+	CacheError  = "error"
+)
+
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_requests_total",
+	Help: "Total number of cache lookups, result is local (in-process hit), hit, absent (negative hit), miss or error.",
+}, []string{"cache", "result"})
+
+// 所有 Cache 共用的进程内缓存, 由 Invalidations 删除
+var localCache = NewLocalStore()
+
+func init() {
+	Invalidations.Register(localCache)
+}
+
+// 按 uuid 缓存一种数据, 值为 json. 不存在的数据缓存 MissTTL, 避免重复查询 pg
+type Cache[T any] struct {
+	R *redis.Client
+	W *redis.Client
+	// key 的前缀, 也是指标的 cache 标签
+	Name string
+	// <= 0 时为 DefaultCacheTTL
+	TTL time.Duration
+	// <= 0 时为 DefaultCacheMissTTL
+	MissTTL time.Duration
+	// 进程内缓存的时间, 不超过 TTL 和 MissTTL. <= 0 时只使用 redis
+	Local  time.Duration
+	Logger *zap.Logger
+}
+
+func (c *Cache[T]) Key(uuid int) string {
+	return CacheKey(c.Name, uuid)
+}
+
+// 名称为 name 的 Cache 中 uuid 的 key
+func CacheKey(name string, uuid int) string {
+	return fmt.Sprintf("cache:%s-%d", name, uuid)
+}
+
+// key 的删除次数, 读取数据前记录, 写入时不同说明读取期间被删除过
+func cacheGenKey(key string) string {
+	return key + ":gen"
+}
+
+// 删除次数与 ARGV[1] 相同时写入. KEYS: key, 删除次数; ARGV: 删除次数, 数据, 毫秒
+var cacheSetScript = redis.NewScript(`
+local gen = redis.call('GET', KEYS[2]) or '0'
+if gen ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// 删除 keys 并增加删除次数, 删除次数保留 ARGV[1] 毫秒, 长于一次读取的时间
+var cacheDelScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	redis.call('DEL', key)
+	redis.call('INCR', key .. ':gen')
+	redis.call('PEXPIRE', key .. ':gen', ARGV[1])
+end
+return 1
+`)
+
+func delCache(w *redis.Client, keys []string) error {
+	if w != nil {
+		if err := cacheDelScript.Run(w, keys, DefaultCacheTTL.Milliseconds()).Err(); err != nil {
+			return err
+		}
+	}
+	return Invalidations.Publish(keys...)
+}
+
+// 按名称删除 Cache 中的 uuids, 用于不知道 Cache 类型的场景, 如级联删除的数据. 使用 Invalidations 的 redis
+func EvictCache(name string, uuids ...int) error {
+	if len(uuids) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		keys = append(keys, CacheKey(name, uuid))
+	}
+	return delCache(Invalidations.Redis, keys)
+}
+
+func (c *Cache[T]) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return DefaultCacheTTL
+	}
+	return c.TTL
+}
+
+func (c *Cache[T]) missTTL() time.Duration {
+	if c.MissTTL <= 0 {
+		return DefaultCacheMissTTL
+	}
+	return c.MissTTL
+}
+
+func (c *Cache[T]) localTTL(ttl time.Duration) time.Duration {
+	return min(c.Local, ttl)
+}
+
+// 先读进程内缓存, 再读 redis. 没有缓存时返回 redis.Nil
+func (c *Cache[T]) get(uuid int) (buf []byte, local bool, err error) {
+	key := c.Key(uuid)
+	if c.Local > 0 {
+		if buf, local = localCache.Get(key); local {
+			return buf, local, nil
+		}
+	}
+
+	buf, err = c.R.Get(key).Bytes()
+	if err != nil {
+		return buf, false, err
+	}
+	if c.Local > 0 {
+		ttl := c.ttl()
+		if string(buf) == cacheMissing {
+			ttl = c.missTTL()
+		}
+		localCache.Set(key, buf, c.localTTL(ttl))
+	}
+
+	return buf, false, nil
+}
+
+func (c *Cache[T]) set(uuid int, buf []byte, ttl time.Duration) error {
+	if c.Local > 0 {
+		localCache.Set(c.Key(uuid), buf, c.localTTL(ttl))
+	}
+	return c.W.Set(c.Key(uuid), buf, ttl).Err()
+}
+
+// 读取前的删除次数, 没有记录时为 "0"
+func (c *Cache[T]) gen(uuid int) (string, error) {
+	gen, err := c.W.Get(cacheGenKey(c.Key(uuid))).Result()
+	if err == redis.Nil {
+		return "0", nil
+	}
+	return gen, err
+}
+
+// 读取后没有删除过时写入, 避免读取期间修改的旧数据在删除后写回
+func (c *Cache[T]) setIf(uuid int, gen string, buf []byte, ttl time.Duration) error {
+	key := c.Key(uuid)
+	n, err := cacheSetScript.Run(c.W, []string{key, cacheGenKey(key)}, gen, buf, ttl.Milliseconds()).Int()
+	if err != nil || n == 0 {
+		return err
+	}
+	if c.Local > 0 {
+		localCache.Set(key, buf, c.localTTL(ttl))
+	}
+	return nil
+}
+
+// 没有缓存时返回 redis.Nil, 缓存了不存在时 found 为 false
+func (c *Cache[T]) Get(uuid int) (obj T, found bool, err error) {
+	var buf []byte
+	if buf, _, err = c.get(uuid); err != nil {
+		return obj, false, err
+	}
+	return c.decode(buf)
+}
+
+func (c *Cache[T]) decode(buf []byte) (obj T, found bool, err error) {
+	if string(buf) == cacheMissing {
+		return obj, false, nil
+	}
+
+	err = json.Unmarshal(buf, &obj)
+	return obj, err == nil, err
+}
+
+func (c *Cache[T]) Set(uuid int, obj *T) error {
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return c.set(uuid, buf, c.ttl())
+}
+
+func (c *Cache[T]) SetMissing(uuid int) error {
+	return c.set(uuid, []byte(cacheMissing), c.missTTL())
+}
+
+// 删除 redis 中的缓存, 并通知所有实例删除进程内缓存
+func (c *Cache[T]) Del(uuids ...int) error {
+	if len(uuids) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		keys = append(keys, c.Key(uuid))
+	}
+	return delCache(c.W, keys)
+}
+
+// 先读缓存, 没有缓存时调用 load 读取并写入缓存. load 返回空时缓存不存在.
+// load 期间缓存被删除时不写入; load 需要读主库, 从库延迟时删除后仍可能读到旧数据.
+// redis 的错误只记录日志, 不影响结果
+func (c *Cache[T]) Load(uuid int, load func() ([]T, error)) (obj T, found bool, err error) {
+	var (
+		buf   []byte
+		local bool
+	)
+	if buf, local, err = c.get(uuid); err == nil {
+		obj, found, err = c.decode(buf)
+	}
+	switch {
+	case err == nil && local:
+		cacheRequests.WithLabelValues(c.Name, CacheLocal).Inc()
+		return obj, found, nil
+	case err == nil && found:
+		cacheRequests.WithLabelValues(c.Name, CacheHit).Inc()
+		return obj, found, nil
+	case err == nil:
+		cacheRequests.WithLabelValues(c.Name, CacheAbsent).Inc()
+		return obj, found, nil
+	case err == redis.Nil:
+		cacheRequests.WithLabelValues(c.Name, CacheMiss).Inc()
+	default:
+		cacheRequests.WithLabelValues(c.Name, CacheError).Inc()
+		c.warn("cache get err", err)
+	}
+
+	// 读取删除次数失败时不写入缓存
+	gen, gerr := c.gen(uuid)
+	c.warn("cache gen err", gerr)
+
+	var objs []T
+	objs, err = load()
+	if err != nil {
+		return obj, false, err
+	}
+
+	if len(objs) == 0 {
+		if gerr == nil {
+			c.warn("cache set err", c.setIf(uuid, gen, []byte(cacheMissing), c.missTTL()))
+		}
+		return obj, false, nil
+	}
+
+	obj = objs[0]
+	if gerr == nil {
+		var buf []byte
+		if buf, err = json.Marshal(&obj); err != nil {
+			return obj, false, err
+		}
+		c.warn("cache set err", c.setIf(uuid, gen, buf, c.ttl()))
+	}
+
+	return obj, true, nil
+}
+
+func (c *Cache[T]) warn(msg string, err error) {
+	if err == nil || c.Logger == nil {
+		return
+	}
+	c.Logger.Warn(msg, zap.String("cache", c.Name), zap.String("error", err.Error()))
+}
+
+// 在 IDao 上增加缓存失效: 记录 Insert, Update, Delete 的 uuid, 由 Evict 删除缓存, 其他方法不经过缓存.
+// 在事务中使用时在提交后调用 Evict, 提交前删除时并发读取会把旧数据写回缓存
+type CacheDao[T any] struct {
+	IDao[T]
+	Cache *Cache[T]
+
+	uuid  func(*T) int
+	dirty []int
+}
+
+func NewCacheDao[T any, PT interface {
+	*T
+	revisioned
+}](dao IDao[T], cache *Cache[T]) *CacheDao[T] {
+	return &CacheDao[T]{
+		IDao:  dao,
+		Cache: cache,
+		uuid: func(t *T) int {
+			uuid, _ := PT(t).revision()
+			return uuid
+		},
+	}
+}
+
+// uuid 可能有不存在的负缓存
+func (d *CacheDao[T]) Insert(meta *T) (uuid int, err error) {
+	uuid, err = d.IDao.Insert(meta)
+	if err == nil {
+		d.dirty = append(d.dirty, uuid)
+	}
+	return uuid, err
+}
+
+func (d *CacheDao[T]) Update(meta *T) (obj T, err error) {
+	obj, err = d.IDao.Update(meta)
+	d.dirty = append(d.dirty, d.uuid(meta))
+	return obj, err
+}
+
+func (d *CacheDao[T]) Delete(meta *T) (err error) {
+	err = d.IDao.Delete(meta)
+	d.dirty = append(d.dirty, d.uuid(meta))
+	return err
+}
+
+// 删除修改过的 uuid 的缓存, 事务提交后调用. d 为 nil 时不做任何事, 事务没有执行到创建 dao 时可以直接调用
+func (d *CacheDao[T]) Evict() {
+	if d == nil {
+		return
+	}
+	d.Cache.warn("cache del err", d.Cache.Del(d.dirty...))
+	d.dirty = nil
+}
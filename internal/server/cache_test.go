@@ -0,0 +1,73 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func newTestCache(t *testing.T) *Cache[ServiceMeta] {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return &Cache[ServiceMeta]{R: client, W: client, Name: "service"}
+}
+
+func TestCacheLoad(t *testing.T) {
+	c := newTestCache(t)
+
+	loads := 0
+	load := func() ([]ServiceMeta, error) {
+		loads++
+		return []ServiceMeta{{Uuid: 1, Name: "a"}}, nil
+	}
+	for i := 0; i < 2; i++ {
+		obj, found, err := c.Load(1, load)
+		if err != nil || !found || obj.Name != "a" {
+			t.Fatalf("Load: %+v %v %v", obj, found, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loads: got %d, want 1", loads)
+	}
+}
+
+func TestCacheLoadEvictedDuringLoad(t *testing.T) {
+	c := newTestCache(t)
+
+	// 读取到旧数据后修改提交并删除缓存, 旧数据不写入
+	obj, found, err := c.Load(1, func() ([]ServiceMeta, error) {
+		if err := c.Del(1); err != nil {
+			t.Fatalf("Del: %v", err)
+		}
+		return []ServiceMeta{{Uuid: 1, Name: "old"}}, nil
+	})
+	if err != nil || !found || obj.Name != "old" {
+		t.Fatalf("Load: %+v %v %v", obj, found, err)
+	}
+	if _, _, err = c.Get(1); err != redis.Nil {
+		t.Fatalf("Get: got %v, want redis.Nil", err)
+	}
+
+	// 不存在的数据同样不写入
+	if _, found, err = c.Load(2, func() ([]ServiceMeta, error) {
+		return nil, c.Del(2)
+	}); err != nil || found {
+		t.Fatalf("Load missing: %v %v", found, err)
+	}
+	if _, _, err = c.Get(2); err != redis.Nil {
+		t.Fatalf("Get missing: got %v, want redis.Nil", err)
+	}
+
+	// 之后的读取正常写入
+	if _, _, err = c.Load(1, func() ([]ServiceMeta, error) {
+		return []ServiceMeta{{Uuid: 1, Name: "new"}}, nil
+	}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if obj, found, err = c.Get(1); err != nil || !found || obj.Name != "new" {
+		t.Fatalf("Get: %+v %v %v", obj, found, err)
+	}
+}
@@ -1,8 +1,8 @@
 package server
 
 import (
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
@@ -55,43 +55,11 @@ func RowsToStructs[T TRow](objs *[]T, rows *sqlx.Rows, rowfollow ...func(*T) err
 	return err
 }
 
-type Dao struct{}
-
-func (d *Dao) FieldsP(l int) string {
-	if l <= 0 {
-		return ""
-	}
-	switch l {
-	case 1:
-		return "($1)"
-	case 2:
-		return "($1, $2)"
-	case 3:
-		return "($1, $2, $3)"
-	case 4:
-		return "($1, $2, $3, $4)"
-	case 5:
-		return "($1, $2, $3, $4, $5)"
-	case 6:
-		return "($1, $2, $3, $4, $5, $6)"
-	case 7:
-		return "($1, $2, $3, $4, $5, $6, $7)"
-	case 8:
-		return "($1, $2, $3, $4, $5, $6, $7, $8)"
-	default:
-		var fbuilder strings.Builder
-		fbuilder.WriteRune('(')
-		l := 10
-		for i := range l {
-			fbuilder.WriteString("$")
-			fbuilder.WriteString(strconv.Itoa(i + 1))
-			if i != l-1 {
-				fbuilder.WriteString(",")
-			}
-		}
-		fbuilder.WriteRune(')')
-		return fbuilder.String()
-	}
+type Dao struct {
+	// Select 和 Count 包含已经删除的数据
+	ShowDeleted bool
+	// 不为 nil 时 Select 和 Count 查询该时间的数据, 见 Snapshot
+	AsOf *time.Time
 }
 
 func (d *Dao) As(old, new string) string {
@@ -123,164 +91,6 @@ func (d *Dao) FieldAs(table string, field string, nfield string) string {
 	return f.String()
 }
 
-func (d *Dao) Equal(field1, field2 string) string {
-	var f strings.Builder
-	f.WriteString(field1)
-	f.WriteString(" = ")
-	f.WriteString(field2)
-
-	return f.String()
-}
-
-func (d *Dao) Comma(field1 string, fields ...string) string {
-	if len(fields) == 0 {
-		return field1
-	}
-
-	var f strings.Builder
-	f.WriteString(field1)
-	for _, field := range fields {
-		f.WriteString(", ")
-		f.WriteString(field)
-	}
-
-	return f.String()
-}
-
-func (d *Dao) FieldIndexP(n string, i int) string {
-	var f strings.Builder
-	f.WriteString(n)
-	f.WriteString("=$")
-	f.WriteString(strconv.Itoa(i + 1))
-
-	return f.String()
-}
-
-func (d *Dao) WithSQL(wtable string, query string) string {
-	ql := []string{
-		"WITH", wtable, "AS (",
-		query,
-		")",
-	}
-
-	return strings.Join(ql, " ")
-}
-
-func (d *Dao) SelectSQL(with, table string, fields string, cdtfields []string, conditions ...string) string {
-	p := 0
-	cdtstrs := make([]string, len(cdtfields))
-	for i, c := range cdtfields {
-		cdtstrs[i] = d.FieldIndexP(c, p)
-		p += 1
-	}
-
-	if len(cdtstrs) > 0 {
-		conditions = append(conditions, cdtstrs...)
-	}
-
-	condition := ""
-	if len(conditions) > 0 {
-		cs := [2]string{"WHERE ", strings.Join(conditions, " AND ")}
-		condition = strings.Join(cs[:], "")
-	}
-	ql := []string{
-		with,
-		"SELECT", fields,
-		"FROM", table,
-		condition,
-	}
-
-	return strings.Join(ql, " ")
-}
-
-func (d *Dao) SelectAddRowNumberSQL(table string, fields string, orderbyField string, cdtfields []string, conditions ...string) string {
-	var fbuilder strings.Builder
-	fbuilder.WriteString(fields)
-	fbuilder.WriteString(", ROW_NUMBER() OVER (ORDER BY ")
-	fbuilder.WriteString(orderbyField)
-	fbuilder.WriteString(") as row_number")
-	return d.SelectSQL("", table, fbuilder.String(), cdtfields, conditions...)
-}
-
-func (d *Dao) InsertSQL(table string, fields string, argslen int, returning string) string {
-	ret := ""
-	if returning != "" {
-		ret = "RETURNING " + returning
-	}
-	ql := []string{
-		"INSERT INTO", table,
-		"(", fields, ")",
-		"VALUES", d.FieldsP(argslen),
-		ret,
-	}
-
-	return strings.Join(ql, " ")
-}
-
-func (d *Dao) UpdateSQL(table string, setfields []string, returning string, cdtfields []string, conditions ...string) string {
-	p := 0
-	setstrs := make([]string, len(setfields))
-	for i, f := range setfields {
-		setstrs[i] = d.FieldIndexP(f, p)
-		p += 1
-	}
-
-	cdtstrs := make([]string, len(cdtfields))
-	for i, c := range cdtfields {
-		cdtstrs[i] = d.FieldIndexP(c, p)
-		p += 1
-	}
-
-	if len(cdtstrs) > 0 {
-		conditions = append(conditions, cdtstrs...)
-	}
-
-	condition := ""
-	if len(conditions) > 0 {
-		cs := [2]string{"WHERE ", strings.Join(conditions, " AND ")}
-		condition = strings.Join(cs[:], "")
-	}
-
-	ret := ""
-	if returning != "" {
-		ret = "RETURNING " + returning
-	}
-
-	ql := []string{
-		"UPDATE", table,
-		"SET", strings.Join(setstrs, ", "),
-		condition,
-		ret,
-	}
-
-	return strings.Join(ql, " ")
-}
-
-func (d *Dao) DeleteSQL(table string, cdtfields []string, conditions ...string) string {
-	p := 0
-	cdtstrs := make([]string, len(cdtfields))
-	for i, c := range cdtfields {
-		cdtstrs[i] = d.FieldIndexP(c, p)
-		p += 1
-	}
-
-	if len(cdtstrs) > 0 {
-		conditions = append(conditions, cdtstrs...)
-	}
-
-	condition := ""
-	if len(conditions) > 0 {
-		cs := [2]string{"WHERE ", strings.Join(conditions, " AND ")}
-		condition = strings.Join(cs[:], "")
-	}
-	ql := []string{
-		"DELETE", "FROM", table,
-		condition,
-	}
-
-	return strings.Join(ql, " ")
-}
-
 type IDao[T any] interface {
 	Insert(*T) (int, error)
 	Select(*T, ...DaoOption) ([]T, error)
@@ -289,35 +99,37 @@ type IDao[T any] interface {
 	Update(*T) (T, error)
 }
 
+// 在查询上附加条件, 排序, 分页等
 type DaoOption interface {
-	Conditions() []string
+	Apply(*SelectBuilder)
+}
+
+type lockOption string
+
+func (o lockOption) Apply(b *SelectBuilder) {
+	b.For(string(o))
+}
+
+// 在事务中锁住查询到的行, 如 "SHARE", "UPDATE", "SHARE OF tenant"
+func LockOption(lock string) DaoOption {
+	return lockOption(lock)
 }
 
 type LimitOption struct {
 	page  int
 	limit int
-	field string
 }
 
-func NewLimitOption(page int, limit int, field string) *LimitOption {
+func NewLimitOption(page int, limit int) *LimitOption {
 	return &LimitOption{
 		page:  page,
 		limit: limit,
-		field: field,
 	}
 }
 
-func (o *LimitOption) Left() string {
-	return strconv.Itoa(o.page*o.limit) + " < " + o.field
-}
-
-func (o *LimitOption) Right() string {
-	return o.field + " <= " + strconv.Itoa((o.page+1)*o.limit)
-}
-
-func (o *LimitOption) Conditions() []string {
-	if o == nil || o.field == "" || o.limit < 1 {
-		return nil
+func (o *LimitOption) Apply(b *SelectBuilder) {
+	if o == nil || o.limit < 1 {
+		return
 	}
-	return []string{o.Left(), o.Right()}
+	b.Limit(o.limit).Offset(o.page * o.limit)
 }
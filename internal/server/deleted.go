@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Get 同时返回已经删除的数据. GetRequest 中还没有 show_deleted 字段, 加入 proto 后改为读取字段
+	ShowDeletedKey = "x-show-deleted"
+	// 响应 header, 值为 "uuid=删除时间", 只包含已经删除的数据
+	DeletedKey = "x-deleted"
+)
+
+// 删除时写入删除时间, 为 NULL 时数据没有被删除
+const DeletedAtCol = "deleted_at"
+
+// 恢复没有被删除的数据时返回
+var ErrNotDeleted = errors.New("数据没有被删除")
+
+// 删除时间, at 为 nil 时为当前时间. 级联删除的数据使用相同的删除时间, 恢复时一起恢复
+func DeleteTime(at *types.Time) types.Time {
+	if at != nil {
+		return *at
+	}
+	return types.Time(time.Now())
+}
+
+// 排除已经删除的数据, ShowDeleted 为 true 时不排除
+func (d *Dao) Alive(table string) []Cond {
+	if d.ShowDeleted {
+		return nil
+	}
+	return []Cond{IsNull(d.Field(table, DeletedAtCol))}
+}
+
+type deleted interface {
+	deletedAt() (int, *types.Time)
+}
+
+// 设置 Get 返回的已经删除的 meta 的删除时间
+func SetDeleted[T any, PT interface {
+	*T
+	deleted
+}](ctx context.Context, objs []T) error {
+	kv := make([]string, 0)
+	for i := range objs {
+		uuid, at := PT(&objs[i]).deletedAt()
+		if at != nil {
+			kv = append(kv, DeletedKey, fmt.Sprintf("%d=%s", uuid, at.String()))
+		}
+	}
+	if len(kv) == 0 {
+		return nil
+	}
+
+	return grpc.SetHeader(ctx, metadata.Pairs(kv...))
+}
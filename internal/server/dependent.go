@@ -0,0 +1,217 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	// 删除时同时删除引用它的数据, 否则有引用时拒绝删除
+	CascadeKey = "x-cascade"
+)
+
+type TableCount struct {
+	Table string `json:"table"`
+	Count int    `json:"count"`
+}
+
+// 格式化为 "processor=1,service=2", 用于响应 header 和错误信息
+func FormatCounts(counts []TableCount) string {
+	kv := make([]string, 0, len(counts))
+	for _, c := range counts {
+		kv = append(kv, fmt.Sprintf("%s=%d", c.Table, c.Count))
+	}
+	return strings.Join(kv, ",")
+}
+
+// 有引用时拒绝删除, Counts 为每个引用的表的行数
+type DependentError struct {
+	Counts []TableCount
+}
+
+func (e *DependentError) Error() string {
+	return "仍被引用: " + FormatCounts(e.Counts)
+}
+
+// 引用某一行的表
+type Dependent struct {
+	Table string
+	// 表的数据的审计记录 kind
+	Kind string
+	Cond func(uuid int) Cond
+	// 表的数据的 Cache 名称, 不为空时删除或恢复后由 Evict 删除对应的缓存
+	Cache string
+}
+
+// 在修改所在的事务中记录级联删除 (deleted 为 true) 或恢复的数据, kind 为 Dependent.Kind
+type CascadeRecorder func(db DB, kind string, deleted bool, uuids []int) error
+
+// 按顺序统计, 删除或恢复引用某一行的数据, 前面的表引用后面的表. DB 为事务时所有修改在同一个事务中,
+// 提交后调用 Evict 删除修改过的数据的缓存
+type Dependents struct {
+	DB     DB
+	Logger *zap.Logger
+	List   []Dependent
+	// 每个表修改后调用, 为空时不记录
+	Record CascadeRecorder
+	DaoLog
+
+	// Cache 名称到修改过的 uuid
+	dirty map[string][]int
+}
+
+// 每个表引用 uuid 且没有被删除的行数
+func (d *Dependents) Count(uuid int) (counts []TableCount, err error) {
+	for _, dep := range d.List {
+		query, args := Select("count(*)").From(dep.Table).Where(dep.Cond(uuid), IsNull(DeletedAtCol)).ToSQL()
+		d.Debug(d.Logger, query, args...)
+
+		var n int
+		if err = d.DB.QueryRowx(query, args...).Scan(&n); err != nil {
+			return counts, err
+		}
+		counts = append(counts, TableCount{dep.Table, n})
+	}
+
+	return counts, nil
+}
+
+// 有引用时返回 DependentError
+func (d *Dependents) Check(uuid int) error {
+	counts, err := d.Count(uuid)
+	if err != nil {
+		return err
+	}
+
+	blocking := make([]TableCount, 0)
+	for _, c := range counts {
+		if c.Count > 0 {
+			blocking = append(blocking, c)
+		}
+	}
+	if len(blocking) > 0 {
+		return &DependentError{Counts: blocking}
+	}
+
+	return nil
+}
+
+// 按顺序将引用 uuid 的数据标记为在 at 删除, 每个表最多删除 limit 行, limit <= 0 时不限制.
+// 返回本次删除的行数, done 表示已经全部删除
+func (d *Dependents) Delete(uuid int, limit int, at types.Time) (counts []TableCount, done bool, err error) {
+	for _, dep := range d.List {
+		cond := And(dep.Cond(uuid), IsNull(DeletedAtCol))
+		if limit > 0 {
+			cond = InQuery("uuid", Select("uuid").From(dep.Table).Where(cond).Limit(limit))
+		}
+
+		var n int
+		n, err = d.set(dep, at, true, cond)
+		if err != nil {
+			return counts, false, err
+		}
+		counts = append(counts, TableCount{dep.Table, n})
+
+		// 前面的表没有删完时, 后面的表还被引用
+		if limit > 0 && n >= limit {
+			return counts, false, nil
+		}
+	}
+
+	return counts, true, nil
+}
+
+// 恢复引用 uuid 且在 at 删除的数据, 即和 uuid 一起被级联删除的数据, 被引用的表先恢复
+func (d *Dependents) Restore(uuid int, at types.Time) (counts []TableCount, err error) {
+	for i := len(d.List) - 1; i >= 0; i-- {
+		dep := d.List[i]
+
+		var n int
+		n, err = d.set(dep, nil, false, And(dep.Cond(uuid), Eq(DeletedAtCol, at)))
+		if err != nil {
+			return counts, err
+		}
+		counts = append(counts, TableCount{dep.Table, n})
+	}
+
+	return counts, nil
+}
+
+func (d *Dependents) set(dep Dependent, at any, deleted bool, cond Cond) (n int, err error) {
+	query, args := Update(dep.Table).Set(DeletedAtCol, at).Where(cond).Returning("uuid").ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	uuids := make([]int, 0)
+	if err = sqlx.Select(d.DB, &uuids, query, args...); err != nil {
+		return 0, err
+	}
+	if len(uuids) == 0 {
+		return 0, nil
+	}
+
+	if dep.Cache != "" {
+		if d.dirty == nil {
+			d.dirty = make(map[string][]int)
+		}
+		d.dirty[dep.Cache] = append(d.dirty[dep.Cache], uuids...)
+	}
+	if d.Record != nil {
+		if err = d.Record(d.DB, dep.Kind, deleted, uuids); err != nil {
+			return len(uuids), err
+		}
+	}
+
+	return len(uuids), nil
+}
+
+// 删除 Delete 和 Restore 修改过的数据的缓存, 事务提交后调用
+func (d *Dependents) Evict() {
+	for name, uuids := range d.dirty {
+		if err := EvictCache(name, uuids...); err != nil && d.Logger != nil {
+			d.Logger.Warn("cache del err", zap.String("cache", name), zap.String("error", err.Error()))
+		}
+	}
+	d.dirty = nil
+}
+
+// 在事务中锁住 table 中没有被删除的 uuid 行, 行不存在或已经删除时返回 sql.ErrNoRows.
+// 删除时以 UPDATE 锁住数据本身, 创建引用它的数据时以 SHARE 锁住, 统计引用和写入引用不会交错
+func LockAlive(db DB, logger *zap.Logger, table string, uuid int, lock string) error {
+	query, args := Select("uuid").From(table).Where(Eq("uuid", uuid), IsNull(DeletedAtCol)).For(lock).ToSQL()
+	(&DaoLog{}).Debug(logger, query, args...)
+
+	var n int
+	if err := db.QueryRowx(query, args...).Scan(&n); err != nil {
+		return fmt.Errorf("%s %d: %w", table, uuid, err)
+	}
+
+	return nil
+}
+
+// 在 uow 中删除 table 中的 uuid: cascade 为 false 时有引用则返回 DependentError, 否则先删除引用的数据, 再由 del 删除数据本身.
+// 先锁住数据本身, 引用的数据和数据本身使用相同的删除时间 at, 由 record 记录删除的引用数据, 提交后删除引用的数据的缓存.
+// 返回删除的引用数据的行数
+func DeleteWithDependents(uow *UnitOfWork, table string, list []Dependent, uuid int, cascade bool, record CascadeRecorder, del func(at types.Time) error) (counts []TableCount, err error) {
+	if err = LockAlive(uow.Tx, uow.Logger, table, uuid, "UPDATE"); err != nil {
+		return counts, err
+	}
+
+	at := DeleteTime(nil)
+	deps := &Dependents{DB: uow.Tx, Logger: uow.Logger, List: list, Record: record}
+	uow.AfterCommit(deps.Evict)
+	if cascade {
+		counts, _, err = deps.Delete(uuid, 0, at)
+	} else {
+		err = deps.Check(uuid)
+	}
+	if err != nil {
+		return counts, err
+	}
+
+	return counts, del(at)
+}
@@ -1,7 +1,14 @@
 package server
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/crt379/svc-collector-grpc/internal/code"
+
+	"github.com/jackc/pgx/v5/pgconn"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -30,6 +37,24 @@ func AlreadyExistsErr(msg string) error {
 	return st.Err()
 }
 
+func FailedPreconditionErr(msg string) error {
+	st := status.New(codes.FailedPrecondition, "前置条件不满足: "+msg)
+
+	return st.Err()
+}
+
+func PermissionDeniedErr(msg string) error {
+	st := status.New(codes.PermissionDenied, "没有权限: "+msg)
+
+	return st.Err()
+}
+
+func AbortedErr(msg string) error {
+	st := status.New(codes.Aborted, "并发修改冲突: "+msg)
+
+	return st.Err()
+}
+
 func InternalErr(msg string) error {
 	st := status.New(codes.Internal, "服务内部错误: "+msg)
 
@@ -67,10 +92,69 @@ func AlreadyExistsResp[T PBResp](resp SetResp[T], msg string) (T, error) {
 }
 
 func SqlErrResp[T PBResp](resp SetResp[T], err error) (T, error) {
-	resp.SetCode(code.SQL_EXEC_ERROR)
-	resp.SetMessage(err.Error())
+	c, errf, msg := translateSqlErr(err)
+	resp.SetCode(c)
+	resp.SetMessage(msg)
 
-	return resp.GetPBResp(), InternalErr(resp.GetMessage())
+	return resp.GetPBResp(), errf(resp.GetMessage())
+}
+
+// 将数据库错误转换为 grpc status error, 用于没有 resp 的场景
+func SqlErr(err error) error {
+	_, errf, msg := translateSqlErr(err)
+
+	return errf(msg)
+}
+
+// pg 错误码, 见 https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation      = "23505"
+	pgForeignKeyViolation  = "23503"
+	pgCheckViolation       = "23514"
+	pgNotNullViolation     = "23502"
+	pgDataException        = "22"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// 将数据库错误转换为响应的 code, grpc status 和 message. pg 错误只返回表名和约束名, 不包含 sql
+func translateSqlErr(err error) (int32, func(string) error, string) {
+	var stale *StaleError
+	if errors.As(err, &stale) {
+		return code.REVISION_CONFLICT, AbortedErr, fmt.Sprintf("revision 不匹配, 当前 revision: %d", stale.Current)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return code.PARAMTER_ERROR, NotFoundErr, "数据不存在或已经被删除"
+	}
+	var dep *DependentError
+	if errors.As(err, &dep) {
+		return code.PARAMTER_ERROR, FailedPreconditionErr, dep.Error()
+	}
+	if errors.Is(err, ErrNotDeleted) {
+		return code.PARAMTER_ERROR, FailedPreconditionErr, err.Error()
+	}
+
+	var pgerr *pgconn.PgError
+	if !errors.As(err, &pgerr) {
+		return code.SQL_EXEC_ERROR, InternalErr, err.Error()
+	}
+
+	switch {
+	case pgerr.Code == pgUniqueViolation:
+		return code.PARAMTER_ERROR, AlreadyExistsErr, fmt.Sprintf("%s 已有相同的数据 (%s)", pgerr.TableName, pgerr.ConstraintName)
+	case pgerr.Code == pgForeignKeyViolation:
+		return code.PARAMTER_ERROR, FailedPreconditionErr, fmt.Sprintf("%s 引用的数据不存在或仍被引用 (%s)", pgerr.TableName, pgerr.ConstraintName)
+	case pgerr.Code == pgCheckViolation:
+		return code.PARAMTER_ERROR, InvalidArgumentErr, fmt.Sprintf("%s 的数据不满足约束 (%s)", pgerr.TableName, pgerr.ConstraintName)
+	case pgerr.Code == pgNotNullViolation:
+		return code.PARAMTER_ERROR, InvalidArgumentErr, fmt.Sprintf("%s.%s 不能为空", pgerr.TableName, pgerr.ColumnName)
+	case strings.HasPrefix(pgerr.Code, pgDataException):
+		return code.PARAMTER_ERROR, InvalidArgumentErr, fmt.Sprintf("数据不合法 (SQLSTATE %s)", pgerr.Code)
+	case pgerr.Code == pgSerializationFailure, pgerr.Code == pgDeadlockDetected:
+		return code.SQL_EXEC_ERROR, AbortedErr, "事务冲突, 请重试"
+	}
+
+	return code.SQL_EXEC_ERROR, InternalErr, fmt.Sprintf("数据库执行错误 (SQLSTATE %s)", pgerr.Code)
 }
 
 func InternalResp[T PBResp](resp SetResp[T], err error) (T, error) {
@@ -86,3 +170,21 @@ func NotFoundResp[T PBResp](resp SetResp[T], msg string) (T, error) {
 
 	return resp.GetPBResp(), NotFoundErr(resp.GetMessage())
 }
+
+// 将 CheckRevision 等返回的 status error 写入 resp
+func StatusResp[T PBResp](resp SetResp[T], err error) (T, error) {
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.FailedPrecondition, codes.Aborted:
+		resp.SetCode(code.REVISION_CONFLICT)
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists:
+		resp.SetCode(code.PARAMTER_ERROR)
+	case codes.Unauthenticated, codes.PermissionDenied, codes.ResourceExhausted:
+		resp.SetCode(code.AUTH_ERROR)
+	default:
+		resp.SetCode(code.INTERNAL_ERROR)
+	}
+	resp.SetMessage(st.Message())
+
+	return resp.GetPBResp(), err
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+)
+
+const (
+	// Get 返回该时间的数据, 值为 RFC3339 或 "2006-01-02 15:04:05".
+	// proto 的 GetRequest 有 google.protobuf.Timestamp as_of 字段后改用字段
+	AsOfKey = "x-as-of"
+)
+
+const (
+	// 历史表为原表加上后缀, 由触发器在每次修改时写入一个版本
+	HistorySuffix = "_history"
+	ValidFromCol  = "valid_from"
+	ValidToCol    = "valid_to"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// 某个版本的有效时间, ValidTo 为 nil 时为当前版本
+type Validity struct {
+	ValidFrom types.Time  `json:"valid_from" db:"valid_from"`
+	ValidTo   *types.Time `json:"valid_to,omitempty" db:"valid_to"`
+}
+
+// 时间为 RFC3339 或 "2006-01-02 15:04:05", 后者为本地时间
+func ParseTime(s string) (t time.Time, err error) {
+	if t, err = time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(timeLayout, s, time.Local)
+}
+
+// 从 grpc meta 读取 AsOfKey, 没有时返回 nil
+func AsOfFromMeta(ctx context.Context) (*time.Time, error) {
+	md, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	values := md.Get(AsOfKey)
+	if len(values) == 0 || values[0] == "" {
+		return nil, nil
+	}
+
+	t, err := ParseTime(values[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", AsOfKey, values[0])
+	}
+
+	return &t, nil
+}
+
+// at 时有效的版本
+func ValidAt(at time.Time) Cond {
+	return And(Le(ValidFromCol, at), Or(IsNull(ValidToCol), Gt(ValidToCol, at)))
+}
+
+type snapshotOption struct {
+	at     time.Time
+	tables []string
+}
+
+// 用同名的 CTE 将 tables 替换为历史表中 at 时有效的版本
+func (o *snapshotOption) Apply(b *SelectBuilder) {
+	if o == nil {
+		return
+	}
+	for _, table := range o.tables {
+		b.With(table, Select("*").From(table+HistorySuffix).Where(ValidAt(o.at)))
+	}
+}
+
+// AsOf 不为 nil 时查询 tables 在 AsOf 时的数据, tables 需要有历史表
+func (d *Dao) Snapshot(tables ...string) DaoOption {
+	if d.AsOf == nil {
+		return nil
+	}
+	return &snapshotOption{at: *d.AsOf, tables: tables}
+}
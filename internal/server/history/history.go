@@ -0,0 +1,93 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type HistoryImp struct{}
+
+var _ HistoryServer = (*HistoryImp)(nil)
+
+func kindNames() string {
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// 请求 {"kind": "service", "uuid": 1, "page": 0, "limit": 100}, 需要 x-access-tenant.
+// 响应 {"code": 10000, "message": "success", "total": 2, "revisions": [...]}, 每个版本为当时的数据和 valid_from, valid_to, 按时间倒序
+func (imp *HistoryImp) ListRevisions(ctx context.Context, req *structpb.Struct) (resp *structpb.Struct, err error) {
+	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
+	logger.Info("HistoryImp ListRevisions")
+
+	resp = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+
+	fields := req.GetFields()
+	name := fields["kind"].GetStringValue()
+	k, ok := kinds[name]
+	if !ok {
+		return server.ParamterResp(&LResp{resp}, fmt.Sprintf("kind 只能为: %s", kindNames()))
+	}
+
+	uuid := int(fields["uuid"].GetNumberValue())
+	if uuid <= 0 {
+		return server.ParamterResp(&LResp{resp}, "uuid 不能为空")
+	}
+
+	page := int(fields["page"].GetNumberValue())
+	limit := int(fields["limit"].GetNumberValue())
+	if page < 0 {
+		page = 0
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var tenant server.TenantMeta
+	tenant, err = svrtenant.CheckByMeta(ctx)
+	if err != nil {
+		return resp, err
+	}
+
+	var (
+		total int
+		objs  any
+	)
+	total, objs, err = k.revisions(storage.ReadDB, logger, tenant.Uuid, uuid, page, limit)
+	if err != nil {
+		return server.SqlErrResp(&LResp{resp}, err)
+	}
+
+	revisions := make([]any, 0)
+	if objs != nil {
+		var buf []byte
+		if buf, err = json.Marshal(objs); err != nil {
+			return server.InternalResp(&LResp{resp}, err)
+		}
+		if err = json.Unmarshal(buf, &revisions); err != nil {
+			return server.InternalResp(&LResp{resp}, err)
+		}
+	}
+
+	var v *structpb.Value
+	if v, err = structpb.NewValue(revisions); err != nil {
+		return server.InternalResp(&LResp{resp}, err)
+	}
+	resp.Fields["total"] = structpb.NewNumberValue(float64(total))
+	resp.Fields["revisions"] = v
+
+	return server.OkResp(&LResp{resp})
+}
@@ -0,0 +1,48 @@
+package history
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type HistoryServer interface {
+	ListRevisions(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+func _History_ListRevisions_Handler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HistoryServer).ListRevisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/history.History/ListRevisions",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(HistoryServer).ListRevisions(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// 接口定义见 proto/history/history.proto, Metadata 为相对 proto 目录的路径
+var History_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "history.History",
+	HandlerType: (*HistoryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRevisions",
+			Handler:    _History_ListRevisions_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "history/history.proto",
+}
+
+func RegisterServer(srv *grpc.Server) {
+	srv.RegisterService(&History_ServiceDesc, &HistoryImp{})
+}
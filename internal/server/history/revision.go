@@ -0,0 +1,138 @@
+package history
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"go.uber.org/zap"
+)
+
+type serviceRevision struct {
+	server.ServiceMeta
+	server.Validity
+}
+
+type svcapiRevision struct {
+	server.SvcapiMeta
+	server.Validity
+}
+
+type svcapiegRevision struct {
+	server.SvcapiegMeta
+	Sid int `json:"-" db:"sid"`
+	server.Validity
+}
+
+// AppsvcMeta 中的 service 在历史版本中没有
+type appsvcRevision struct {
+	Uuid       int         `json:"uuid" db:"uuid"`
+	AppId      int         `json:"appid" db:"aid"`
+	SvcId      int         `json:"svcid" db:"sid"`
+	CreateTime types.Time  `json:"create_time" db:"create_time"`
+	UpdateTime types.Time  `json:"update_time" db:"update_time"`
+	DeletedAt  *types.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	server.Validity
+}
+
+type processorRevision struct {
+	server.ProcessorMeta
+	server.Validity
+}
+
+// 有历史表的数据
+type kind struct {
+	table string
+	// 限定数据属于 tenant, 历史版本可能引用已经删除的父数据, 不检查父数据
+	scope func(htable string, tenantid int) server.Cond
+	list  func(db server.DB, logger *zap.Logger, q *server.SelectBuilder) (any, error)
+}
+
+func tenantIdCond(htable string, tenantid int) server.Cond {
+	return server.Eq(htable+".tenant_id", tenantid)
+}
+
+var kinds = map[string]kind{
+	"service": {
+		table: "service",
+		scope: tenantIdCond,
+		list:  list[serviceRevision],
+	},
+	"svcapi": {
+		table: "service_api",
+		scope: tenantIdCond,
+		list:  list[svcapiRevision],
+	},
+	"svcapieg": {
+		table: "svc_api_example",
+		scope: tenantIdCond,
+		list:  listExamples,
+	},
+	"appsvc": {
+		table: "app_svc_relation",
+		scope: func(htable string, tenantid int) server.Cond {
+			return server.InQuery(htable+".aid", server.Select("uuid").From("application").Where(server.Eq("tenant_id", tenantid)))
+		},
+		list: list[appsvcRevision],
+	},
+	"processor": {
+		table: "processor",
+		scope: tenantIdCond,
+		list:  list[processorRevision],
+	},
+}
+
+func list[T any](db server.DB, logger *zap.Logger, q *server.SelectBuilder) (any, error) {
+	return query[T](db, logger, q)
+}
+
+func query[T any](db server.DB, logger *zap.Logger, q *server.SelectBuilder, rowfollow ...func(*T) error) (objs []T, err error) {
+	var dl server.DaoLog
+
+	query, args := q.ToSQL()
+	dl.Debug(logger, query, args...)
+
+	rows, err := db.Queryx(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	err = server.RowsToStructs(&objs, rows, rowfollow...)
+
+	return objs, err
+}
+
+// 同时返回 jdata 中的数据和 svcapi 所属的 service
+func listExamples(db server.DB, logger *zap.Logger, q *server.SelectBuilder) (any, error) {
+	htable := "svc_api_example" + server.HistorySuffix
+	q.Columns("jdata.data", "service_api.sid").
+		LeftJoin("jdata", server.EqCol(htable+".jid", "jdata.uuid")).
+		LeftJoin("service_api", server.EqCol(htable+".aid", "service_api.uuid"))
+
+	return query(db, logger, q, func(r *svcapiegRevision) error {
+		r.ServiceId = r.Sid
+		return r.DataToMap()
+	})
+}
+
+// 按 valid_from 倒序返回 uuid 的版本, 和版本的总数
+func (k *kind) revisions(db server.DB, logger *zap.Logger, tenantid int, uuid int, page int, limit int) (total int, objs any, err error) {
+	var dl server.DaoLog
+
+	htable := k.table + server.HistorySuffix
+	cs := []server.Cond{server.Eq(htable+".uuid", uuid), k.scope(htable, tenantid)}
+
+	query, args := server.Select("count(*)").From(htable).Where(cs...).ToSQL()
+	dl.Debug(logger, query, args...)
+
+	if err = db.QueryRowx(query, args...).Scan(&total); err != nil || total == 0 {
+		return total, nil, err
+	}
+
+	q := server.Select(htable + ".*").
+		From(htable).
+		Where(cs...).
+		OrderBy(htable + "." + server.ValidFromCol + " DESC").
+		Options(server.NewLimitOption(page, limit))
+	objs, err = k.list(db, logger, q)
+
+	return total, objs, err
+}
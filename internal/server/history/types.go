@@ -0,0 +1,29 @@
+package history
+
+import (
+	jsoniter "github.com/json-iterator/go"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// history 服务没有 proto 定义, 请求和响应都使用 google.protobuf.Struct
+type LResp struct {
+	*structpb.Struct
+}
+
+func (r *LResp) SetCode(code int32) {
+	r.Fields["code"] = structpb.NewNumberValue(float64(code))
+}
+
+func (r *LResp) SetMessage(msg string) {
+	r.Fields["message"] = structpb.NewStringValue(msg)
+}
+
+func (r *LResp) GetMessage() string {
+	return r.Fields["message"].GetStringValue()
+}
+
+func (r *LResp) GetPBResp() *structpb.Struct {
+	return r.Struct
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultInvalidateChannel = "svc-collector:invalidate"
+
+	invalidateReceive = 5 * time.Second
+	invalidateRetry   = time.Second
+	// 进程内缓存的最大数量, 超过时先清理过期的, 仍然超过时全部清空
+	localMaxEntries = 10000
+)
+
+var (
+	invalidateLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cache_invalidation_lag_seconds",
+		Help:    "Seconds between publishing a cache invalidation and evicting the keys on a replica.",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+	})
+	invalidateResets = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cache_local_resets_total",
+		Help: "Total number of times local caches were cleared because invalidations may have been lost.",
+	})
+)
+
+// 进程内的一层缓存, 收到失效消息时删除 key, 可能丢失消息时全部清空
+type LocalLayer interface {
+	Evict(keys ...string)
+	Reset()
+}
+
+// 广播失效消息的 key, 与 redis 中缓存的 key 相同
+type invalidation struct {
+	Keys []string `json:"keys"`
+	// 发布时间, unix 纳秒
+	At int64 `json:"at"`
+}
+
+// 通过 redis pub/sub 在所有实例之间广播缓存失效, 每个实例收到后删除进程内缓存.
+// pub/sub 不保证送达, 订阅断开重连后清空进程内缓存, 进程内缓存的 ttl 限制最长的不一致时间
+type Bus struct {
+	// 为 nil 时只删除本实例的进程内缓存
+	Redis *redis.Client
+	// 为空时为 DefaultInvalidateChannel
+	Channel string
+	Logger  *zap.Logger
+
+	mu     sync.RWMutex
+	layers []LocalLayer
+}
+
+// 所有实例共用的失效广播, 由 main 设置 Redis 并运行
+var Invalidations = &Bus{}
+
+func (b *Bus) channel() string {
+	if b.Channel == "" {
+		return DefaultInvalidateChannel
+	}
+	return b.Channel
+}
+
+func (b *Bus) Register(l LocalLayer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.layers = append(b.layers, l)
+}
+
+func (b *Bus) evict(keys []string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, l := range b.layers {
+		l.Evict(keys...)
+	}
+}
+
+func (b *Bus) reset() {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	invalidateResets.Inc()
+	for _, l := range b.layers {
+		l.Reset()
+	}
+}
+
+// 删除本实例的 keys 并通知其他实例
+func (b *Bus) Publish(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	b.evict(keys)
+	if b.Redis == nil {
+		return nil
+	}
+
+	buf, err := json.Marshal(&invalidation{Keys: keys, At: time.Now().UnixNano()})
+	if err != nil {
+		return err
+	}
+	return b.Redis.Publish(b.channel(), buf).Err()
+}
+
+func (b *Bus) receive(msg *redis.Message) {
+	var inv invalidation
+	if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+		b.Logger.Warn("invalidation unmarshal err", zap.String("error", err.Error()))
+		return
+	}
+
+	b.evict(inv.Keys)
+	if inv.At > 0 {
+		invalidateLag.Observe(time.Since(time.Unix(0, inv.At)).Seconds())
+	}
+}
+
+func (b *Bus) Run(ctx context.Context) error {
+	ps := b.Redis.Subscribe(b.channel())
+	defer ps.Close()
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		m, err := ps.ReceiveTimeout(invalidateReceive)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			// 连接断开期间的消息已经丢失
+			b.Logger.Warn("invalidation receive err", zap.String("error", err.Error()))
+			b.reset()
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(invalidateRetry):
+			}
+			continue
+		}
+
+		switch m := m.(type) {
+		case *redis.Subscription:
+			// 第一次订阅或重连后重新订阅, 之前可能有丢失的消息
+			b.reset()
+		case *redis.Message:
+			b.receive(m)
+		}
+	}
+}
+
+type localEntry struct {
+	buf    []byte
+	expire time.Time
+}
+
+// 进程内的 key -> value, 每个值有自己的过期时间
+type LocalStore struct {
+	mu sync.Mutex
+	m  map[string]localEntry
+}
+
+var _ LocalLayer = (*LocalStore)(nil)
+
+func NewLocalStore() *LocalStore {
+	return &LocalStore{m: make(map[string]localEntry)}
+}
+
+func (s *LocalStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.m[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expire) {
+		delete(s.m, key)
+		return nil, false
+	}
+	return e.buf, true
+}
+
+func (s *LocalStore) Set(key string, buf []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.m) >= localMaxEntries {
+		now := time.Now()
+		for k, e := range s.m {
+			if now.After(e.expire) {
+				delete(s.m, k)
+			}
+		}
+		if len(s.m) >= localMaxEntries {
+			s.m = make(map[string]localEntry)
+		}
+	}
+	s.m[key] = localEntry{buf: buf, expire: time.Now().Add(ttl)}
+}
+
+func (s *LocalStore) Evict(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.m, key)
+	}
+}
+
+func (s *LocalStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.m = make(map[string]localEntry)
+}
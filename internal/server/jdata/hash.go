@@ -0,0 +1,156 @@
+package jdata
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/crt379/svc-collector-grpc/internal/config"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	DefaultHashType = "sha256"
+)
+
+var hashers = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha256": sha256.New,
+	"xxhash": func() hash.Hash { return xxhash.New() },
+}
+
+// 配置的 hash 算法, 没有配置或不支持时使用 DefaultHashType
+func HashType() string {
+	if _, ok := hashers[config.AppConfig.Jdata.HashType]; ok {
+		return config.AppConfig.Jdata.HashType
+	}
+	return DefaultHashType
+}
+
+func HashTypes() []string {
+	ts := make([]string, 0, len(hashers))
+	for t := range hashers {
+		ts = append(ts, t)
+	}
+	sort.Strings(ts)
+
+	return ts
+}
+
+func Hash(hashtype string, data []byte) (string, error) {
+	f, ok := hashers[hashtype]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash type: %s", hashtype)
+	}
+
+	h := f()
+	h.Write(data)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 将 json 转换为规范形式: object 的 key 排序, 数字规范化, 去掉空白.
+// 语义相同的 json 转换后的结果相同
+func Canonical(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid json: trailing data")
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	case string:
+		writeString(buf, v)
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected json type %T", v)
+	}
+
+	return nil
+}
+
+// 整数(包括 1.0, 1e2 这种形式)输出为不带小数点和指数的形式, 其他输出为最短的 float64 形式
+func canonicalNumber(n json.Number) (string, error) {
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return "", fmt.Errorf("invalid number: %s", n)
+	}
+
+	if r.IsInt() {
+		return r.Num().String(), nil
+	}
+
+	f, _ := r.Float64()
+
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode 会在末尾添加换行
+	buf.Truncate(buf.Len() - 1)
+}
@@ -1,8 +1,8 @@
 package jdata
 
 import (
+	"database/sql"
 	"fmt"
-	"strings"
 
 	"github.com/crt379/svc-collector-grpc/internal/server"
 	"github.com/crt379/svc-collector-grpc/internal/types"
@@ -14,17 +14,19 @@ var _ server.IDao[server.Jdata] = (*JdataPgDao)(nil)
 
 const (
 	table = "jdata"
+
+	// 引用 jdata 的表, svcapieg 依赖本包, 这里不能引用 svcapieg
+	reftable = "svc_api_example"
+	reffield = "jid"
 )
 
 var (
-	_fields   = [...]string{"uuid", "data", "create_time", "update_time", "hash_type", "hash_value"}
-	_fields_0 = strings.Join(_fields[:], ",")
-	_fields_1 = strings.Join(_fields[1:], ",")
+	_fields = [...]string{"uuid", "data", "create_time", "update_time", "hash_type", "hash_value"}
 )
 
 type JdataPgDao struct {
-	W      *sqlx.DB
-	R      *sqlx.DB
+	W      server.DB
+	R      server.DB
 	Logger *zap.Logger
 	server.Dao
 	server.DaoLog
@@ -34,20 +36,15 @@ func (d *JdataPgDao) Table() string {
 	return table
 }
 
-func (d *JdataPgDao) fieldsStr(s int) string {
-	switch s {
-	case 0:
-		return _fields_0
-	case 1:
-		return _fields_1
-	}
-	return strings.Join(_fields[s:], ",")
-}
-
+// 相同 hash 的数据已经存在时返回已有的 uuid, 并发写入相同的数据不会违反唯一约束
 func (d *JdataPgDao) Insert(meta *server.Jdata) (uuid int, err error) {
-	args := []any{meta.Data, meta.CreateTime, meta.UpdateTime, meta.HashType, meta.HashValue}
-
-	query := d.InsertSQL(d.Table(), d.fieldsStr(1), len(args), "uuid")
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:]...).
+		Values(meta.Data, meta.CreateTime, meta.UpdateTime, meta.HashType, meta.HashValue).
+		OnConflict("hash_type", "hash_value").
+		DoUpdate("hash_value").
+		Returning("uuid").
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).Scan(&uuid)
@@ -55,31 +52,29 @@ func (d *JdataPgDao) Insert(meta *server.Jdata) (uuid int, err error) {
 	return uuid, err
 }
 
-func (d *JdataPgDao) Select(meta *server.Jdata, ops ...server.DaoOption) (objs []server.Jdata, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+func (d *JdataPgDao) conditions(meta *server.Jdata) []server.Cond {
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
 	if meta.HashType != "" {
-		k = append(k, "hash_type")
-		args = append(args, meta.HashType)
+		cs = append(cs, server.Eq("hash_type", meta.HashType))
 	}
 	if meta.HashValue != "" {
-		k = append(k, "hash_value")
-		args = append(args, meta.HashValue)
+		cs = append(cs, server.Eq("hash_value", meta.HashValue))
 	}
 
-	optconditions := make([]string, 0)
-	for _, op := range ops {
-		optconditions = append(optconditions, op.Conditions()...)
-	}
+	return cs
+}
 
-	query := d.SelectAddRowNumberSQL(d.Table(), d.fieldsStr(0), "uuid", k)
-	query = d.WithSQL("t", query)
-	query = d.SelectSQL(query, "t", d.fieldsStr(0), nil, optconditions...)
+func (d *JdataPgDao) Select(meta *server.Jdata, ops ...server.DaoOption) (objs []server.Jdata, err error) {
+	query, args := server.Select(_fields[:]...).
+		From(d.Table()).
+		Where(d.conditions(meta)...).
+		OrderBy("uuid").
+		Options(ops...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -97,26 +92,12 @@ func (d *JdataPgDao) Count(*server.Jdata) (int, error) {
 }
 
 func (d *JdataPgDao) Delete(meta *server.Jdata) (err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-
-	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
-	}
-	if meta.HashType != "" {
-		k = append(k, "hash_type")
-		args = append(args, meta.HashType)
-	}
-	if meta.HashValue != "" {
-		k = append(k, "hash_value")
-		args = append(args, meta.HashValue)
-	}
-	if len(k) == 0 {
+	cs := d.conditions(meta)
+	if len(cs) == 0 {
 		return nil
 	}
 
-	query := d.DeleteSQL(d.Table(), k)
+	query, args := server.Delete(d.Table()).Where(cs...).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	_, err = d.W.Exec(query, args...)
@@ -125,36 +106,186 @@ func (d *JdataPgDao) Delete(meta *server.Jdata) (err error) {
 }
 
 func (d *JdataPgDao) Update(meta *server.Jdata) (obj server.Jdata, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-
 	if meta.Uuid == 0 {
 		return obj, fmt.Errorf("uuid is 0")
 	}
 
-	k = append(k, "data")
-	args = append(args, meta.Data)
-
+	b := server.Update(d.Table()).Set("data", meta.Data)
 	if meta.HashType != "" {
-		k = append(k, "hash_type")
-		args = append(args, meta.HashType)
+		b.Set("hash_type", meta.HashType)
 	}
 	if meta.HashValue != "" {
-		k = append(k, "hash_value")
-		args = append(args, meta.HashValue)
+		b.Set("hash_value", meta.HashValue)
 	}
 
 	var zerotime types.Time
 	if meta.UpdateTime != zerotime {
-		k = append(k, "update_time")
-		args = append(args, meta.UpdateTime)
+		b.Set("update_time", meta.UpdateTime)
 	}
 
-	args = append(args, meta.Uuid)
-	query := d.UpdateSQL(d.Table(), k, d.fieldsStr(0), []string{"uuid"})
+	query, args := b.Where(server.Eq("uuid", meta.Uuid)).Returning(_fields[:]...).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).StructScan(&obj)
 
 	return obj, err
 }
+
+// 没有被 svc_api_example 和它的历史版本引用的 jdata
+func (d *JdataPgDao) orphanCondition() server.Cond {
+	cs := make([]server.Cond, 0, 2)
+	for _, t := range []string{reftable, reftable + server.HistorySuffix} {
+		cs = append(cs, server.NotExists(
+			server.Select("1").From(t).Where(server.EqCol(d.Field(t, reffield), d.Field(d.Table(), "uuid"))),
+		))
+	}
+	return server.And(cs...)
+}
+
+// uuid 对应的 jdata 没有被引用时删除, 被其他事务锁住的行会跳过, 由 Sweeper 之后清理
+func (d *JdataPgDao) DeleteIfOrphan(uuid int) (deleted bool, err error) {
+	if uuid == 0 {
+		return false, nil
+	}
+
+	sub := server.Select("uuid").
+		From(d.Table()).
+		Where(server.Eq("uuid", uuid), d.orphanCondition()).
+		For("UPDATE SKIP LOCKED")
+	query, args := server.Delete(d.Table()).Where(server.InQuery("uuid", sub)).ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var result sql.Result
+	result, err = d.W.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	var n int64
+	n, err = result.RowsAffected()
+
+	return n > 0, err
+}
+
+func (d *JdataPgDao) CountOrphans() (count int, err error) {
+	query, args := server.Select("count(*)").From(d.Table()).Where(d.orphanCondition()).ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.R.QueryRowx(query, args...).Scan(&count)
+
+	return count, err
+}
+
+// 查询最多 limit 个没有被引用的 jdata, 不包含 data
+func (d *JdataPgDao) SelectOrphans(limit int) (objs []server.Jdata, err error) {
+	query, args := server.Select("uuid", "create_time", "update_time", "hash_type", "hash_value").
+		From(d.Table()).
+		Where(d.orphanCondition()).
+		OrderBy("uuid").
+		Limit(limit).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var rows *sqlx.Rows
+	rows, err = d.R.Queryx(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	err = server.RowsToStructs(&objs, rows)
+
+	return objs, err
+}
+
+// 删除最多 limit 个没有被引用的 jdata, 返回删除的 uuid
+func (d *JdataPgDao) DeleteOrphans(limit int) (uuids []int, err error) {
+	sub := server.Select("uuid").
+		From(d.Table()).
+		Where(d.orphanCondition()).
+		OrderBy("uuid").
+		Limit(limit).
+		For("UPDATE SKIP LOCKED")
+	query, args := server.Delete(d.Table()).Where(server.InQuery("uuid", sub)).Returning("uuid").ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var rows *sqlx.Rows
+	rows, err = d.W.Queryx(query, args...)
+	if err != nil {
+		return uuids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uuid int
+		if err = rows.Scan(&uuid); err != nil {
+			return uuids, err
+		}
+		uuids = append(uuids, uuid)
+	}
+
+	return uuids, rows.Err()
+}
+
+// 按 uuid 顺序查询 uuid 大于 after 的最多 limit 个 jdata, data 为 json 文本
+func (d *JdataPgDao) SelectAfter(after int, limit int) (objs []server.Jdata, err error) {
+	query, args := server.Select("uuid", "data::text AS data", "create_time", "update_time", "hash_type", "hash_value").
+		From(d.Table()).
+		Where(server.Gt("uuid", after)).
+		OrderBy("uuid").
+		Limit(limit).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var rows *sqlx.Rows
+	rows, err = d.R.Queryx(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	err = server.RowsToStructs(&objs, rows)
+
+	return objs, err
+}
+
+// 将引用 dup 的 svc_api_example 及其历史版本改为引用 survivor, 同一个 svcapi 已经引用 survivor 的直接删除, 返回删除的数量.
+// 已经删除的 svc_api_example 不占用唯一约束, 只修改引用
+func (d *JdataPgDao) Merge(dup int, survivor int) (removed int, err error) {
+	query, args := server.Delete(reftable+" e").
+		Where(
+			server.Eq(d.Field("e", reffield), dup),
+			server.IsNull(d.Field("e", "deleted_at")),
+			server.Exists(
+				server.Select("1").
+					From(reftable+" s").
+					Where(
+						server.Eq(d.Field("s", reffield), survivor),
+						server.EqCol("s.aid", "e.aid"),
+						server.IsNull(d.Field("s", "deleted_at")),
+					),
+			),
+		).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var result sql.Result
+	result, err = d.W.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	n, err = result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// 历史版本的内容相同, 同样改为引用 survivor
+	for _, t := range []string{reftable, reftable + server.HistorySuffix} {
+		query, args = server.Update(t).Set(reffield, survivor).Where(server.Eq(reffield, dup)).ToSQL()
+		d.Debug(d.Logger, query, args...)
+
+		if _, err = d.W.Exec(query, args...); err != nil {
+			return int(n), err
+		}
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,147 @@
+package jdata
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+type RehashResult struct {
+	Scanned  int
+	Rehashed int
+	// 与已有 jdata 重复而被合并删除的 jdata 数量
+	Merged int
+	// 合并时因重复而删除的 svc_api_example 数量
+	Removed int
+}
+
+// 使用规范 json 和 HashType 重新计算 jdata 的 hash, 合并 hash 相同的 jdata
+type Rehasher struct {
+	DB       *sqlx.DB
+	HashType string
+	Batch    int
+	DryRun   bool
+	Logger   *zap.Logger
+}
+
+func (r *Rehasher) Rehash(ctx context.Context) (result RehashResult, err error) {
+	if _, ok := hashers[r.HashType]; !ok {
+		return result, fmt.Errorf("unsupported hash type: %s", r.HashType)
+	}
+
+	batch := r.Batch
+	if batch <= 0 {
+		batch = defaultSweepBatch
+	}
+
+	rdao := JdataPgDao{W: r.DB, R: r.DB, Logger: r.Logger}
+	// DryRun 时不会写入新的 hash, 记录已经计算过的 hash 用于统计合并
+	seen := make(map[string]int)
+	after := 0
+	for {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+
+		var jdatas []server.Jdata
+		jdatas, err = rdao.SelectAfter(after, batch)
+		if err != nil {
+			return result, err
+		}
+		if len(jdatas) == 0 {
+			return result, nil
+		}
+
+		for _, jdata := range jdatas {
+			after = jdata.Uuid
+			result.Scanned++
+
+			err = r.rehash(ctx, jdata, seen, &result)
+			if err != nil {
+				return result, fmt.Errorf("jdata %d: %w", jdata.Uuid, err)
+			}
+		}
+	}
+}
+
+func (r *Rehasher) rehash(ctx context.Context, jdata server.Jdata, seen map[string]int, result *RehashResult) (err error) {
+	data, ok := jdata.Data.(string)
+	if !ok {
+		return fmt.Errorf("unexpected data type %T", jdata.Data)
+	}
+
+	canonical, err := Canonical([]byte(data))
+	if err != nil {
+		return err
+	}
+
+	hashvalue, err := Hash(r.HashType, canonical)
+	if err != nil {
+		return err
+	}
+
+	if jdata.HashType == r.HashType && jdata.HashValue == hashvalue {
+		return nil
+	}
+
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, r.DB, r.Logger)
+	if err != nil {
+		return err
+	}
+	defer uow.End(&err)
+
+	dao := JdataPgDao{W: uow.Tx, R: uow.Tx, Logger: r.Logger}
+
+	// 锁住已有的数据, 合并前不会被 Sweeper 删除
+	survivors, err := dao.Select(&server.Jdata{HashType: r.HashType, HashValue: hashvalue}, server.LockOption("SHARE"))
+	if err != nil {
+		return err
+	}
+
+	survivor, ok := seen[hashvalue]
+	if len(survivors) > 0 {
+		survivor, ok = survivors[0].Uuid, true
+	}
+	if r.DryRun && !ok {
+		seen[hashvalue] = jdata.Uuid
+	}
+
+	if ok && survivor != jdata.Uuid {
+		r.Logger.Info("jdata merge", zap.Int("uuid", jdata.Uuid), zap.Int("into", survivor), zap.Bool("dry_run", r.DryRun))
+		result.Merged++
+		if r.DryRun {
+			return nil
+		}
+
+		removed, err := dao.Merge(jdata.Uuid, survivor)
+		if err != nil {
+			return err
+		}
+		result.Removed += removed
+
+		return dao.Delete(&server.Jdata{Uuid: jdata.Uuid})
+	}
+
+	r.Logger.Debug("jdata rehash", zap.Int("uuid", jdata.Uuid), zap.String(r.HashType, hashvalue))
+	result.Rehashed++
+	if r.DryRun {
+		return nil
+	}
+
+	_, err = dao.Update(&server.Jdata{
+		Uuid:       jdata.Uuid,
+		Data:       string(canonical),
+		UpdateTime: types.Time(time.Now()),
+		HashType:   r.HashType,
+		HashValue:  hashvalue,
+	})
+
+	return err
+}
@@ -0,0 +1,109 @@
+package jdata
+
+import (
+	"context"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSweepInterval = time.Hour
+	defaultSweepBatch    = 500
+)
+
+type SweepResult struct {
+	Orphans int
+	Purged  int
+	// DryRun 时最多 Batch 个待清理的 jdata
+	Sample []server.Jdata
+}
+
+// 定期清理没有被 svc_api_example 引用的 jdata, DryRun 时只报告不删除
+type Sweeper struct {
+	Dao      *JdataPgDao
+	Interval time.Duration
+	Batch    int
+	DryRun   bool
+	Logger   *zap.Logger
+}
+
+func (s *Sweeper) interval() time.Duration {
+	if s.Interval <= 0 {
+		return defaultSweepInterval
+	}
+	return s.Interval
+}
+
+func (s *Sweeper) batch() int {
+	if s.Batch <= 0 {
+		return defaultSweepBatch
+	}
+	return s.Batch
+}
+
+func (s *Sweeper) Sweep(ctx context.Context) (result SweepResult, err error) {
+	result.Orphans, err = s.Dao.CountOrphans()
+	if err != nil {
+		return result, err
+	}
+
+	if s.DryRun {
+		result.Sample, err = s.Dao.SelectOrphans(s.batch())
+		return result, err
+	}
+
+	for result.Purged < result.Orphans {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+
+		var uuids []int
+		uuids, err = s.Dao.DeleteOrphans(s.batch())
+		if err != nil {
+			return result, err
+		}
+		if len(uuids) == 0 {
+			break
+		}
+		result.Purged += len(uuids)
+		s.Logger.Debug("jdata orphans purged", zap.Ints("uuids", uuids))
+	}
+
+	return result, nil
+}
+
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval())
+	defer ticker.Stop()
+
+	for {
+		result, err := s.Sweep(ctx)
+		if err != nil {
+			s.Logger.Warn("jdata sweep err", zap.String("error", err.Error()))
+		} else {
+			for _, o := range result.Sample {
+				s.Logger.Info(
+					"jdata orphan",
+					zap.Int("uuid", o.Uuid),
+					zap.String("hash_type", o.HashType),
+					zap.String("hash_value", o.HashValue),
+				)
+			}
+			s.Logger.Info(
+				"jdata sweep",
+				zap.Bool("dry_run", s.DryRun),
+				zap.Int("orphans", result.Orphans),
+				zap.Int("purged", result.Purged),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/crt379/svc-collector-grpc/internal/auth"
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type JobImp struct{}
+
+var _ JobServer = (*JobImp)(nil)
+
+// x-access-tenant 的 tenant uuid. 没有同名的 tenant 时返回最后删除的, 删除 tenant 的 job 完成后仍然可以查询
+func accessTenant(ctx context.Context, db server.DB) (uuid int, err error) {
+	md, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if !ok {
+		return 0, server.InternalErr("grpc mete not in context")
+	}
+	getvalue := md.Get("x-access-tenant")
+	if len(getvalue) == 0 {
+		return 0, server.InvalidArgumentErr("grpc mete not found x-access-tenant")
+	}
+
+	query, args := server.Select("uuid").
+		From("tenant").
+		Where(server.Eq("name", getvalue[0])).
+		OrderBy(server.DeletedAtCol + " DESC NULLS FIRST").
+		Limit(1).
+		ToSQL()
+	err = db.QueryRowx(query, args...).Scan(&uuid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, server.SqlErr(err)
+	}
+
+	return uuid, nil
+}
+
+// 只返回 x-access-tenant 创建的 job, super-admin 可以查询所有 job.
+// 请求 {"uuid": 1}, 响应 {"code": 10000, "message": "success", "job": {...}}
+func (imp *JobImp) Get(ctx context.Context, req *structpb.Struct) (resp *structpb.Struct, err error) {
+	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
+	logger.Info("JobImp Get")
+
+	resp = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+
+	uuid := int(req.GetFields()["uuid"].GetNumberValue())
+	if uuid <= 0 {
+		return server.NotFoundResp(&GResp{resp}, fmt.Sprintf("job: %d 不存在", uuid))
+	}
+
+	// 进度由执行的实例频繁写入, 从主库读取避免延迟
+	dao := JobPgDao{
+		W:      storage.WriteDB,
+		R:      storage.WriteDB,
+		Logger: logger,
+	}
+
+	var jobs []server.JobMeta
+	jobs, err = dao.Select(&server.JobMeta{Uuid: uuid})
+	if err != nil {
+		return server.SqlErrResp(&GResp{resp}, err)
+	}
+	if len(jobs) > 0 && !auth.IsSuperAdmin(ctx) {
+		var tenantid int
+		tenantid, err = accessTenant(ctx, storage.WriteDB)
+		if err != nil {
+			return server.StatusResp(&GResp{resp}, err)
+		}
+		if jobs[0].TenantId != tenantid {
+			jobs = nil
+		}
+	}
+	if len(jobs) == 0 {
+		return server.NotFoundResp(&GResp{resp}, fmt.Sprintf("job: %d 不存在", uuid))
+	}
+
+	var job *structpb.Struct
+	job, err = jobs[0].ToStruct()
+	if err != nil {
+		return server.InternalResp(&GResp{resp}, err)
+	}
+	resp.Fields["job"] = structpb.NewStructValue(job)
+
+	return server.OkResp(&GResp{resp})
+}
@@ -0,0 +1,146 @@
+package job
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	table = "job"
+)
+
+var (
+	_fields = [...]string{"uuid", "kind", "target", "state", "progress", "error", "create_time", "update_time", "actor", "trace_id", "tenant_id"}
+)
+
+type JobPgDao struct {
+	W      server.DB
+	R      server.DB
+	Logger *zap.Logger
+	server.Dao
+	server.DaoLog
+}
+
+func (d *JobPgDao) Table() string {
+	return table
+}
+
+func (d *JobPgDao) Insert(meta *server.JobMeta) (uuid int, err error) {
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:]...).
+		Values(meta.Kind, meta.Target, meta.State, meta.Progress, meta.Error, meta.CreateTime, meta.UpdateTime, meta.Actor, meta.TraceId, meta.TenantId).
+		Returning("uuid").
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.W.QueryRowx(query, args...).Scan(&uuid)
+
+	return uuid, err
+}
+
+func (d *JobPgDao) Select(meta *server.JobMeta, ops ...server.DaoOption) (objs []server.JobMeta, err error) {
+	cs := make([]server.Cond, 0)
+
+	if meta.Uuid != 0 {
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
+	}
+	if meta.Kind != "" {
+		cs = append(cs, server.Eq("kind", meta.Kind))
+	}
+	if meta.Target != 0 {
+		cs = append(cs, server.Eq("target", meta.Target))
+	}
+	if meta.State != "" {
+		cs = append(cs, server.Eq("state", meta.State))
+	}
+	if meta.TenantId != 0 {
+		cs = append(cs, server.Eq("tenant_id", meta.TenantId))
+	}
+
+	query, args := server.Select(_fields[:]...).
+		From(d.Table()).
+		Where(cs...).
+		OrderBy("uuid").
+		Options(ops...).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var rows *sqlx.Rows
+	rows, err = d.R.Queryx(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	err = server.RowsToStructs(&objs, rows)
+
+	return objs, err
+}
+
+// 领取一个待执行的 job, 或者 update_time 早于 stale 之前的 running job (执行它的实例可能已经退出).
+// 没有可执行的 job 时返回 sql.ErrNoRows
+func (d *JobPgDao) Claim(kinds []string, stale time.Duration) (obj server.JobMeta, err error) {
+	now := time.Now()
+	sub := server.Select("uuid").
+		From(d.Table()).
+		Where(
+			server.In("kind", kinds...),
+			server.Or(
+				server.Eq("state", server.JobPending),
+				server.And(server.Eq("state", server.JobRunning), server.Lt("update_time", types.Time(now.Add(-stale)))),
+			),
+		).
+		OrderBy("uuid").
+		Limit(1).
+		For("UPDATE SKIP LOCKED")
+
+	query, args := server.Update(d.Table()).
+		Set("state", server.JobRunning).
+		Set("update_time", types.Time(now)).
+		Where(server.InQuery("uuid", sub)).
+		Returning(_fields[:]...).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.W.QueryRowx(query, args...).StructScan(&obj)
+
+	return obj, err
+}
+
+// 更新进度, 同时刷新 update_time 表示 job 仍在执行
+func (d *JobPgDao) Progress(uuid int, progress string) (err error) {
+	query, args := server.Update(d.Table()).
+		Set("progress", progress).
+		Set("update_time", types.Time(time.Now())).
+		Where(server.Eq("uuid", uuid)).
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	_, err = d.W.Exec(query, args...)
+
+	return
+}
+
+func (d *JobPgDao) Finish(uuid int, jerr error) (err error) {
+	if uuid == 0 {
+		return fmt.Errorf("uuid is 0")
+	}
+
+	b := server.Update(d.Table()).Set("update_time", types.Time(time.Now()))
+	if jerr != nil {
+		b.Set("state", server.JobFailed).Set("error", jerr.Error())
+	} else {
+		b.Set("state", server.JobDone)
+	}
+
+	query, args := b.Where(server.Eq("uuid", uuid)).ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	_, err = d.W.Exec(query, args...)
+
+	return
+}
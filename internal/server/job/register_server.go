@@ -0,0 +1,48 @@
+package job
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type JobServer interface {
+	Get(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+func _Job_Get_Handler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JobServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/job.Job/Get",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(JobServer).Get(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// 接口定义见 proto/job/job.proto, Metadata 为相对 proto 目录的路径
+var Job_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "job.Job",
+	HandlerType: (*JobServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Job_Get_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "job/job.proto",
+}
+
+func RegisterServer(srv *grpc.Server) {
+	srv.RegisterService(&Job_ServiceDesc, &JobImp{})
+}
@@ -0,0 +1,112 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRunInterval = 5 * time.Second
+	defaultStale       = 5 * time.Minute
+)
+
+// 执行 job, 通过 progress 报告进度. 执行中的实例退出后 job 会被重新领取, 所以处理函数需要能够重复执行
+type Handler func(ctx context.Context, job *server.JobMeta, progress func(v any) error) error
+
+// 轮询 job 表并执行, 多个实例同时运行时每个 job 只会被一个实例领取
+type Runner struct {
+	Dao      *JobPgDao
+	Handlers map[string]Handler
+	Interval time.Duration
+	// running 状态的 job 超过 Stale 没有报告进度时认为执行它的实例已经退出
+	Stale  time.Duration
+	Logger *zap.Logger
+}
+
+func (r *Runner) interval() time.Duration {
+	if r.Interval <= 0 {
+		return defaultRunInterval
+	}
+	return r.Interval
+}
+
+func (r *Runner) stale() time.Duration {
+	if r.Stale <= 0 {
+		return defaultStale
+	}
+	return r.Stale
+}
+
+func (r *Runner) kinds() []string {
+	kinds := make([]string, 0, len(r.Handlers))
+	for k := range r.Handlers {
+		kinds = append(kinds, k)
+	}
+	return kinds
+}
+
+// 领取并执行一个 job, 没有可执行的 job 时 ran 为 false
+func (r *Runner) RunOnce(ctx context.Context) (ran bool, err error) {
+	var job server.JobMeta
+	job, err = r.Dao.Claim(r.kinds(), r.stale())
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	logger := r.Logger.With(zap.Int("job", job.Uuid), zap.String("kind", job.Kind), zap.Int("target", job.Target))
+	logger.Info("job start")
+
+	progress := func(v any) error {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return r.Dao.Progress(job.Uuid, string(buf))
+	}
+
+	jerr := r.Handlers[job.Kind](ctx, &job, progress)
+	if jerr != nil && ctx.Err() != nil {
+		// 退出时不标记失败, 由其他实例重新领取
+		return true, jerr
+	}
+	if jerr != nil {
+		logger.Warn("job failed", zap.String("error", jerr.Error()))
+	} else {
+		logger.Info("job done")
+	}
+
+	return true, r.Dao.Finish(job.Uuid, jerr)
+}
+
+func (r *Runner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		// 有 job 时连续执行, 直到没有可执行的 job
+		for {
+			ran, err := r.RunOnce(ctx)
+			if err != nil {
+				r.Logger.Warn("job run err", zap.String("error", err.Error()))
+			}
+			if !ran || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
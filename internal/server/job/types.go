@@ -0,0 +1,29 @@
+package job
+
+import (
+	jsoniter "github.com/json-iterator/go"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// job 服务没有 proto 定义, 请求和响应都使用 google.protobuf.Struct
+type GResp struct {
+	*structpb.Struct
+}
+
+func (r *GResp) SetCode(code int32) {
+	r.Fields["code"] = structpb.NewNumberValue(float64(code))
+}
+
+func (r *GResp) SetMessage(msg string) {
+	r.Fields["message"] = structpb.NewStringValue(msg)
+}
+
+func (r *GResp) GetMessage() string {
+	return r.Fields["message"].GetStringValue()
+}
+
+func (r *GResp) GetPBResp() *structpb.Struct {
+	return r.Struct
+}
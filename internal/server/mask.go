@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/util"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const (
+	// Update 请求写入的字段, 如 "describe,weight", 等同于 google.protobuf.FieldMask 的 paths.
+	// svc-collector-grpc-proto v0.0.20 的 UpdateRequest 还没有 update_mask 字段, 加入后改为读取字段
+	UpdateMaskKey = "x-update-mask"
+)
+
+// 从 grpc meta 读取 update mask, 路径必须是 req 的字段且在 mutable 中. 没有 mask 时返回 nil
+func UpdateMaskFromMeta(ctx context.Context, req proto.Message, mutable ...string) (*fieldmaskpb.FieldMask, error) {
+	md, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	values := md.Get(UpdateMaskKey)
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	paths := make([]string, 0)
+	for _, v := range values {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				paths = append(paths, p)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s 为空", UpdateMaskKey)
+	}
+
+	mask, err := fieldmaskpb.New(req, paths...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", UpdateMaskKey, err.Error())
+	}
+	mask.Normalize()
+
+	for _, p := range mask.GetPaths() {
+		if !slices.Contains(mutable, p) {
+			return nil, fmt.Errorf("%s: 字段 %s 不能修改", UpdateMaskKey, p)
+		}
+	}
+
+	return mask, nil
+}
+
+// 将 newobj 合并到 obj: 有 update mask 时只写入 mask 中的字段, 零值也会写入;
+// 没有 mask 时忽略 newobj 中的零值. 返回 obj 是否有变化
+func MergeUpdate[T any](ctx context.Context, req proto.Message, newobj *T, obj *T, mutable ...string) (bool, error) {
+	mask, err := UpdateMaskFromMeta(ctx, req, mutable...)
+	if err != nil {
+		return false, err
+	}
+
+	if mask == nil {
+		return util.UpdateValueSame(newobj, obj), nil
+	}
+
+	return util.UpdateValueMask(newobj, obj, mask.GetPaths()), nil
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// 只返回将要删除的数据, 不执行删除
+	DryRunKey = "x-dry-run"
+	// 创建后台 job 执行, 响应 header JobIdKey 返回 job uuid
+	AsyncKey = "x-async"
+	// 响应 header, 每个表删除或将要删除的行数, 如 "service=1,service_api=3"
+	ImpactKey = "x-impact"
+	JobIdKey  = "x-job-id"
+)
+
+// 从 grpc meta 读取 bool 值, 没有时返回 false
+func BoolFromMeta(ctx context.Context, key string) (bool, error) {
+	md, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 || values[0] == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %s", key, values[0])
+	}
+
+	return b, nil
+}
+
+// 设置响应 header
+func SetHeader(ctx context.Context, key string, value string) error {
+	return grpc.SetHeader(ctx, metadata.Pairs(key, value))
+}
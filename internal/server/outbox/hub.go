@@ -0,0 +1,203 @@
+package outbox
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+)
+
+const (
+	hubBlock  = 5 * time.Second
+	hubCount  = 100
+	hubBuffer = 256
+	hubRetry  = time.Second
+)
+
+// stream 中的一个事件, Id 为 stream 的 entry id
+type Entry struct {
+	Id    string
+	Event server.OutboxEvent
+}
+
+func parseEntry(msg redis.XMessage) (e Entry) {
+	e.Id = msg.ID
+
+	str := func(key string) string {
+		s, _ := msg.Values[key].(string)
+		return s
+	}
+	num := func(key string) int {
+		n, _ := strconv.Atoi(str(key))
+		return n
+	}
+
+	e.Event.Seq, _ = strconv.ParseInt(str("seq"), 10, 64)
+	e.Event.Kind = str("kind")
+	e.Event.Action = str("action")
+	e.Event.TenantId = num("tenant_id")
+	e.Event.Target = num("target")
+	e.Event.Actor = str("actor")
+	e.Event.TraceId = str("trace_id")
+	if t, err := server.ParseTime(str("create_time")); err == nil {
+		e.Event.CreateTime = types.Time(t)
+	}
+
+	return e
+}
+
+// entry id 为 "毫秒-序号", 比较 a 是否在 b 之后
+func After(a string, b string) bool {
+	ams, aseq := splitId(a)
+	bms, bseq := splitId(b)
+	if ams != bms {
+		return ams > bms
+	}
+	return aseq > bseq
+}
+
+func splitId(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(ms, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return m, s
+}
+
+// 读取 stream 中的新事件并分发给所有订阅者, 每个实例共用一个连接读取 stream
+type Hub struct {
+	Redis *redis.Client
+	// 为空时为 DefaultStream
+	Stream string
+	Logger *zap.Logger
+
+	mu   sync.Mutex
+	subs map[chan Entry]struct{}
+}
+
+func (h *Hub) stream() string {
+	if h.Stream == "" {
+		return DefaultStream
+	}
+	return h.Stream
+}
+
+// 订阅之后的新事件. 订阅者处理不及时时 channel 会被关闭, 需要重新订阅并用 Range 补齐
+func (h *Hub) Subscribe() chan Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs == nil {
+		h.subs = make(map[chan Entry]struct{})
+	}
+	c := make(chan Entry, hubBuffer)
+	h.subs[c] = struct{}{}
+
+	return c
+}
+
+func (h *Hub) Unsubscribe(c chan Entry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[c]; ok {
+		delete(h.subs, c)
+		close(c)
+	}
+}
+
+func (h *Hub) broadcast(e Entry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.subs {
+		select {
+		case c <- e:
+		default:
+			delete(h.subs, c)
+			close(c)
+		}
+	}
+}
+
+// id 之后的最多 count 个事件
+func (h *Hub) Range(id string, count int64) (entries []Entry, err error) {
+	// XRANGE 包含 id 本身, 多读一个
+	msgs, err := h.Redis.XRangeN(h.stream(), id, "+", count+1).Result()
+	if err != nil {
+		return entries, err
+	}
+
+	for _, msg := range msgs {
+		if msg.ID == id {
+			continue
+		}
+		entries = append(entries, parseEntry(msg))
+	}
+	if int64(len(entries)) > count {
+		entries = entries[:count]
+	}
+
+	return entries, nil
+}
+
+// stream 中最后一个事件的 id, stream 为空时为 "0-0"
+func (h *Hub) Last() (string, error) {
+	msgs, err := h.Redis.XRevRangeN(h.stream(), "+", "-", 1).Result()
+	if err != nil || len(msgs) == 0 {
+		return "0-0", err
+	}
+	return msgs[0].ID, nil
+}
+
+// id 之后的事件是否都还在 stream 中, 被裁剪掉时需要重新读取完整数据
+func (h *Hub) Retained(id string) (bool, error) {
+	msgs, err := h.Redis.XRangeN(h.stream(), "-", "+", 1).Result()
+	if err != nil {
+		return false, err
+	}
+	if len(msgs) == 0 {
+		return false, nil
+	}
+	return !After(msgs[0].ID, id), nil
+}
+
+func (h *Hub) Run(ctx context.Context) error {
+	last := "$"
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		streams, err := h.Redis.XRead(&redis.XReadArgs{
+			Streams: []string{h.stream(), last},
+			Count:   hubCount,
+			Block:   hubBlock,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			h.Logger.Warn("outbox hub read err", zap.String("error", err.Error()))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(hubRetry):
+			}
+			continue
+		}
+
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				h.broadcast(parseEntry(msg))
+				last = msg.ID
+			}
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package outbox
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	"go.uber.org/zap"
+)
+
+// 写入变更事件, db 为修改所在的事务, 事务提交后事件才会被发布
+func Append(db server.DB, logger *zap.Logger, e *server.OutboxEvent) (err error) {
+	dao := OutboxPgDao{W: db, R: db, Logger: logger}
+	e.Seq, err = dao.Insert(e)
+
+	return err
+}
@@ -0,0 +1,99 @@
+package outbox
+
+import (
+	"database/sql"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	table = "outbox"
+)
+
+var (
+	_fields = [...]string{"seq", "kind", "action", "tenant_id", "target", "actor", "trace_id", "create_time", "publish_time"}
+)
+
+type OutboxPgDao struct {
+	W      server.DB
+	R      server.DB
+	Logger *zap.Logger
+	server.Dao
+	server.DaoLog
+}
+
+func (d *OutboxPgDao) Table() string {
+	return table
+}
+
+func (d *OutboxPgDao) Insert(meta *server.OutboxEvent) (seq int64, err error) {
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:8]...).
+		Values(meta.Kind, meta.Action, meta.TenantId, meta.Target, meta.Actor, meta.TraceId, meta.CreateTime).
+		Returning("seq").
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	err = d.W.QueryRowx(query, args...).Scan(&seq)
+
+	return seq, err
+}
+
+// 按 seq 顺序锁住最多 limit 个未发布的事件
+func (d *OutboxPgDao) SelectUnpublished(limit int) (objs []server.OutboxEvent, err error) {
+	query, args := server.Select(_fields[:]...).
+		From(d.Table()).
+		Where(server.IsNull("publish_time")).
+		OrderBy("seq").
+		Limit(limit).
+		For("UPDATE").
+		ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var rows *sqlx.Rows
+	rows, err = d.W.Queryx(query, args...)
+	if err != nil {
+		return objs, err
+	}
+	err = server.RowsToStructs(&objs, rows)
+
+	return objs, err
+}
+
+func (d *OutboxPgDao) Published(seqs []int64, at types.Time) (err error) {
+	if len(seqs) == 0 {
+		return nil
+	}
+
+	query, args := server.Update(d.Table()).Set("publish_time", at).Where(server.In("seq", seqs...)).ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	_, err = d.W.Exec(query, args...)
+
+	return err
+}
+
+// 删除在 before 之前发布的事件, 最多 limit 个, 返回删除的数量
+func (d *OutboxPgDao) DeletePublished(before types.Time, limit int) (n int, err error) {
+	sub := server.Select("seq").
+		From(d.Table()).
+		Where(server.Lt("publish_time", before)).
+		Limit(limit)
+	query, args := server.Delete(d.Table()).Where(server.InQuery("seq", sub)).ToSQL()
+	d.Debug(d.Logger, query, args...)
+
+	var result sql.Result
+	result, err = d.W.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	affected, err = result.RowsAffected()
+
+	return int(affected), err
+}
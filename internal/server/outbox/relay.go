@@ -0,0 +1,174 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/go-redis/redis"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultStream = "svc-collector:changes"
+
+	defaultRelayInterval  = time.Second
+	defaultRelayBatch     = 500
+	defaultRelayRetention = 24 * time.Hour
+	cleanInterval         = time.Hour
+
+	// pg_try_advisory_xact_lock 的 key, 同一时间只有一个实例发布, 保持事件的顺序
+	lockKey = 379_0002
+)
+
+// 将 outbox 中未发布的事件按 seq 顺序发布到 redis stream. 发布后才标记为已发布,
+// 标记失败时会重复发布, 消费者按事件中的 seq 去重.
+// seq 在写入时分配, 较晚提交的事务中较小的 seq 会在较大的 seq 之后发布, 不能作为读取位置;
+// 读取位置为 stream 的 entry id, 由发布时的 XADD 分配, 与发布顺序一致, 见 Hub.Range 和 Watcher
+type Relay struct {
+	DB    *sqlx.DB
+	Redis *redis.Client
+	// 为空时为 DefaultStream
+	Stream string
+	// stream 的近似最大长度, <= 0 时不限制
+	MaxLen   int64
+	Interval time.Duration
+	Batch    int
+	// 已发布的事件保留的时间
+	Retention time.Duration
+	Logger    *zap.Logger
+}
+
+func (r *Relay) stream() string {
+	if r.Stream == "" {
+		return DefaultStream
+	}
+	return r.Stream
+}
+
+func (r *Relay) interval() time.Duration {
+	if r.Interval <= 0 {
+		return defaultRelayInterval
+	}
+	return r.Interval
+}
+
+func (r *Relay) batch() int {
+	if r.Batch <= 0 {
+		return defaultRelayBatch
+	}
+	return r.Batch
+}
+
+func (r *Relay) retention() time.Duration {
+	if r.Retention <= 0 {
+		return defaultRelayRetention
+	}
+	return r.Retention
+}
+
+// 发布一批事件, 返回发布的数量. 其他实例正在发布时返回 0
+func (r *Relay) Publish(ctx context.Context) (n int, err error) {
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, r.DB, r.Logger)
+	if err != nil {
+		return 0, err
+	}
+	defer uow.End(&err)
+
+	var locked bool
+	if err = uow.Tx.QueryRowx("SELECT pg_try_advisory_xact_lock($1)", lockKey).Scan(&locked); err != nil || !locked {
+		return 0, err
+	}
+
+	dao := OutboxPgDao{W: uow.Tx, R: uow.Tx, Logger: r.Logger}
+	var events []server.OutboxEvent
+	events, err = dao.SelectUnpublished(r.batch())
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	// MULTI 中执行, 一批事件要么都写入 stream, 要么都没有写入
+	_, err = r.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		for i := range events {
+			pipe.XAdd(&redis.XAddArgs{
+				Stream:       r.stream(),
+				MaxLenApprox: r.MaxLen,
+				Values:       events[i].StreamValues(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	seqs := make([]int64, 0, len(events))
+	for _, e := range events {
+		seqs = append(seqs, e.Seq)
+	}
+	if err = dao.Published(seqs, types.Time(time.Now())); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// 删除超过 Retention 的已发布事件, 返回删除的数量
+func (r *Relay) Clean(ctx context.Context) (n int, err error) {
+	before := types.Time(time.Now().Add(-r.retention()))
+	dao := OutboxPgDao{W: r.DB, R: r.DB, Logger: r.Logger}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+
+		var deleted int
+		deleted, err = dao.DeletePublished(before, r.batch())
+		n += deleted
+		if err != nil || deleted < r.batch() {
+			return n, err
+		}
+	}
+}
+
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	cleaned := time.Time{}
+	for {
+		n, err := r.Publish(ctx)
+		if err != nil {
+			r.Logger.Warn("outbox publish err", zap.String("error", err.Error()))
+		} else if n > 0 {
+			r.Logger.Debug("outbox publish", zap.Int("count", n), zap.String("stream", r.stream()))
+		}
+
+		if time.Since(cleaned) >= cleanInterval {
+			cleaned = time.Now()
+			if deleted, cerr := r.Clean(ctx); cerr != nil {
+				r.Logger.Warn("outbox clean err", zap.String("error", cerr.Error()))
+			} else if deleted > 0 {
+				r.Logger.Info("outbox clean", zap.Int("count", deleted))
+			}
+		}
+
+		// 一批没有发布完时立即发布下一批
+		if err == nil && n >= r.batch() {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
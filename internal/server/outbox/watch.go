@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"context"
+
+	jsoniter "github.com/json-iterator/go"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	// 发送给客户端的消息类型
+	WatchSnapshot = "snapshot"
+	WatchAdd      = "add"
+	WatchUpdate   = "update"
+	WatchDelete   = "delete"
+
+	watchRange = 500
+)
+
+// 审计记录的 action 对应的消息类型: 创建和恢复时 add, 删除时 delete, 修改时 update
+func ActionType(action string) string {
+	switch action {
+	case "create", "restore":
+		return WatchAdd
+	case "delete":
+		return WatchDelete
+	default:
+		return WatchUpdate
+	}
+}
+
+// 先发送完整数据, 再按顺序发送之后的事件. 每个消息带有 revision, 从某个 revision 恢复时只发送之后的事件,
+// revision 之后的事件已经被裁剪掉时重新发送完整数据. 同一个事件可能发送多次, 消息中的数据为读取时的数据
+type Watcher struct {
+	Hub *Hub
+	// 读取完整数据, 消息的 type 为 WatchSnapshot
+	Snapshot func() (map[string]any, error)
+	// 处理一个事件, 返回需要发送的消息, 与订阅的数据无关时返回 nil
+	Handle func(e *Entry) ([]map[string]any, error)
+	Send   func(msg *structpb.Struct) error
+}
+
+// msg 中的数据按 json 转换为 Struct
+func (w *Watcher) send(msg map[string]any, revision string) error {
+	msg["revision"] = revision
+
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var s structpb.Struct
+	if err = s.UnmarshalJSON(buf); err != nil {
+		return err
+	}
+
+	return w.Send(&s)
+}
+
+func (w *Watcher) snapshot() (revision string, err error) {
+	// 先读取 revision, 读取完整数据期间的事件会在之后再次发送
+	if revision, err = w.Hub.Last(); err != nil {
+		return revision, err
+	}
+
+	var msg map[string]any
+	if msg, err = w.Snapshot(); err != nil {
+		return revision, err
+	}
+
+	return revision, w.send(msg, revision)
+}
+
+func (w *Watcher) handle(e *Entry) error {
+	msgs, err := w.Handle(e)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if err = w.send(msg, e.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 发送 revision 之后已经在 stream 中的事件, 返回最后一个事件的 id
+func (w *Watcher) catchUp(revision string) (string, error) {
+	for {
+		entries, err := w.Hub.Range(revision, watchRange)
+		if err != nil {
+			return revision, err
+		}
+		for i := range entries {
+			if err = w.handle(&entries[i]); err != nil {
+				return revision, err
+			}
+			revision = entries[i].Id
+		}
+		if len(entries) < watchRange {
+			return revision, nil
+		}
+	}
+}
+
+// revision 为空时从完整数据开始, ctx 结束时返回 nil
+func (w *Watcher) Run(ctx context.Context, revision string) (err error) {
+	// 先订阅, 补发期间的新事件在 channel 中, 按 id 去重
+	c := w.Hub.Subscribe()
+	defer func() {
+		w.Hub.Unsubscribe(c)
+	}()
+
+	if revision != "" {
+		var ok bool
+		if ok, err = w.Hub.Retained(revision); err != nil {
+			return err
+		}
+		if !ok {
+			revision = ""
+		}
+	}
+	if revision == "" {
+		if revision, err = w.snapshot(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if revision, err = w.catchUp(revision); err != nil {
+			return err
+		}
+
+	live:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case e, ok := <-c:
+				if !ok {
+					// 处理不及时被取消订阅, 重新订阅后补发
+					c = w.Hub.Subscribe()
+					break live
+				}
+				if !After(e.Id, revision) {
+					continue
+				}
+				if err = w.handle(&e); err != nil {
+					return err
+				}
+				revision = e.Id
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// 请求中带有 PageTokenKey 或 OrderByKey 时使用游标分页, PageTokenKey 为空表示第一页
+	PageTokenKey = "x-page-token"
+	// 排序列, 如 "create_time" 或 "create_time desc", 默认为 uuid
+	OrderByKey = "x-order-by"
+	// 响应 header, 还有下一页时返回. GetRequest/GetReply 中有 page_token/next_page_token 字段后改用字段
+	NextPageTokenKey = "x-next-page-token"
+
+	// 带时区, token 的值不依赖服务的时区
+	pageTimeFormat = "2006-01-02 15:04:05.999999Z07:00"
+)
+
+// 上一页最后一行的排序列和 uuid, 编码后返回给客户端
+type PageToken struct {
+	Field string `json:"f"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v,omitempty"`
+	Uuid  int    `json:"u"`
+}
+
+func (t PageToken) Encode() string {
+	buf, _ := json.Marshal(&t)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func DecodePageToken(s string) (t PageToken, err error) {
+	var buf []byte
+	buf, err = base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, fmt.Errorf("invalid page token")
+	}
+	if err = json.Unmarshal(buf, &t); err != nil || t.Field == "" {
+		return t, fmt.Errorf("invalid page token")
+	}
+
+	return t, nil
+}
+
+// 游标分页: 按 (Field, uuid) 排序, 从 After 之后开始取 Limit 行.
+// 比 LimitOption 的 OFFSET 稳定, 翻页时插入的数据不会导致重复或遗漏
+type KeysetOption struct {
+	// join 查询时用于限定列名
+	Table string
+	Field string
+	Desc  bool
+	After *PageToken
+	Limit int
+}
+
+func (o *KeysetOption) col(field string) string {
+	if o.Table == "" {
+		return field
+	}
+	return o.Table + "." + field
+}
+
+func (o *KeysetOption) Apply(b *SelectBuilder) {
+	if o == nil {
+		return
+	}
+
+	field, uuid := o.col(o.Field), o.col("uuid")
+	cmp, order := Gt, ""
+	if o.Desc {
+		cmp, order = Lt, " DESC"
+	}
+
+	if o.Field == "uuid" {
+		b.SetOrderBy(uuid + order)
+	} else {
+		b.SetOrderBy(field+order, uuid+order)
+	}
+
+	if o.After != nil {
+		if o.Field == "uuid" {
+			b.Where(cmp(uuid, o.After.Uuid))
+		} else {
+			b.Where(Or(
+				cmp(field, o.After.Value),
+				And(Eq(field, o.After.Value), cmp(uuid, o.After.Uuid)),
+			))
+		}
+	}
+
+	if o.Limit > 0 {
+		// 多取一行用于判断是否还有下一页
+		b.Limit(o.Limit + 1)
+	}
+}
+
+// 从 grpc meta 读取游标分页参数, 没有使用游标分页时返回 nil.
+// 排序列必须是 T 中 db tag 对应的 int, string 或时间字段
+func KeysetFromMeta[T any](ctx context.Context, table string) (*KeysetOption, error) {
+	md, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	tokens, orderbys := md.Get(PageTokenKey), md.Get(OrderByKey)
+	if len(tokens) == 0 && len(orderbys) == 0 {
+		return nil, nil
+	}
+
+	o := &KeysetOption{Table: table, Field: "uuid"}
+	if len(orderbys) > 0 && orderbys[0] != "" {
+		f := strings.Fields(strings.ToLower(orderbys[0]))
+		switch {
+		case len(f) == 1:
+		case len(f) == 2 && (f[1] == "asc" || f[1] == "desc"):
+			o.Desc = f[1] == "desc"
+		default:
+			return nil, fmt.Errorf("invalid %s: %s", OrderByKey, orderbys[0])
+		}
+		o.Field = f[0]
+	}
+
+	if len(tokens) > 0 && tokens[0] != "" {
+		token, err := DecodePageToken(tokens[0])
+		if err != nil {
+			return nil, err
+		}
+		// 翻页时以 token 中的排序为准
+		o.Field, o.Desc, o.After = token.Field, token.Desc, &token
+	}
+
+	var t T
+	if _, ok := sortValue(reflect.ValueOf(t), o.Field); !ok {
+		return nil, fmt.Errorf("unsupported sort field: %s", o.Field)
+	}
+
+	return o, nil
+}
+
+// 去掉多取的一行, 还有下一页时返回下一页的 token
+func KeysetPage[T any](o *KeysetOption, objs []T) ([]T, string) {
+	if o == nil || o.Limit <= 0 || len(objs) <= o.Limit {
+		return objs, ""
+	}
+
+	objs = objs[:o.Limit]
+	last := reflect.ValueOf(objs[o.Limit-1])
+
+	token := PageToken{Field: o.Field, Desc: o.Desc}
+	uuid, _ := sortValue(last, "uuid")
+	token.Uuid, _ = strconv.Atoi(uuid)
+	if o.Field != "uuid" {
+		token.Value, _ = sortValue(last, o.Field)
+	}
+
+	return objs, token.Encode()
+}
+
+// 设置响应 header NextPageTokenKey
+func SetNextPageToken(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	return grpc.SetHeader(ctx, metadata.Pairs(NextPageTokenKey, token))
+}
+
+var timeType = reflect.TypeOf(types.Time{})
+
+// 按 db tag 查找字段, 返回可以作为 sql 参数的文本. 时间转换为 UTC
+func sortValue(v reflect.Value, field string) (string, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if s, ok := sortValue(fv, field); ok {
+				return s, ok
+			}
+			continue
+		}
+		// db:"-" 的字段不是表中的列
+		if tag := sf.Tag.Get("db"); tag == "-" || tag != field {
+			continue
+		}
+
+		switch {
+		case sf.Type == timeType:
+			return time.Time(fv.Interface().(types.Time)).UTC().Format(pageTimeFormat), true
+		case fv.CanInt():
+			return strconv.FormatInt(fv.Int(), 10), true
+		case sf.Type.Kind() == reflect.String:
+			return fv.String(), true
+		}
+		return "", false
+	}
+
+	return "", false
+}
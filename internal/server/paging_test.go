@@ -0,0 +1,29 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/types"
+)
+
+func TestSortValue(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	eg := SvcapiegMeta{Uuid: 3, ServiceId: 5}
+	eg.CreateTime = types.Time(time.Date(2024, 1, 2, 11, 4, 5, 0, loc))
+	v := reflect.ValueOf(eg)
+
+	if s, ok := sortValue(v, "uuid"); !ok || s != "3" {
+		t.Errorf("uuid: %q %v", s, ok)
+	}
+	if s, ok := sortValue(v, "create_time"); !ok || s != "2024-01-02 03:04:05Z" {
+		t.Errorf("create_time: %q %v", s, ok)
+	}
+	// db:"-" 不是表中的列
+	for _, f := range []string{"-", "service_id"} {
+		if s, ok := sortValue(v, f); ok {
+			t.Errorf("%s: %q", f, s)
+		}
+	}
+}
@@ -9,10 +9,11 @@ import (
 	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
 	"github.com/crt379/svc-collector-grpc/internal/server"
 	svrapp "github.com/crt379/svc-collector-grpc/internal/server/application"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
 	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
 	"github.com/crt379/svc-collector-grpc/internal/storage"
 	"github.com/crt379/svc-collector-grpc/internal/types"
-	"github.com/crt379/svc-collector-grpc/internal/util"
+	"go.uber.org/zap"
 )
 
 type ProcessorImp struct {
@@ -67,7 +68,7 @@ func (imp *ProcessorImp) Create(ctx context.Context, req *pb.CreateRequest) (res
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
 	if len(procs) > 0 {
-		return server.AlreadyExistsResp(&CResp{resp}, fmt.Sprintf("addr为 %s 的 processor 已经存在", req.Addr))
+		return server.AlreadyExistsResp(&CResp{resp}, fmt.Sprintf("addr为 %s 的 processor 已经存在", proc.Addr))
 	}
 
 	proc.Weight = int(req.Weight)
@@ -79,10 +80,31 @@ func (imp *ProcessorImp) Create(ctx context.Context, req *pb.CreateRequest) (res
 	proc.CreateTime = types.Time(time.Now())
 	proc.UpdateTime = proc.CreateTime
 
-	proc.Uuid, err = dao.Insert(&proc)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	// tenant 和 application 在创建提交前不能被删除
+	if err = server.LockAlive(uow.Tx, logger, "tenant", tenant.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if err = server.LockAlive(uow.Tx, logger, "application", app.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	txdao := ProcessorPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}
+	if proc.Uuid, err = txdao.Insert(&proc); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	proc.Revision = server.InitRevision
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Created(kind, proc.TanantId, proc.Uuid, &proc)); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, proc.Uuid, proc.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ := proc.ToPbMeta()
 	resp.Processor = &pbmeta
@@ -109,6 +131,13 @@ func (imp *ProcessorImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.
 		Logger: logger,
 	}
 
+	if dao.ShowDeleted, err = server.BoolFromMeta(ctx, server.ShowDeletedKey); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+	if dao.AsOf, err = server.AsOfFromMeta(ctx); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	var total int
 	proc := server.ProcessorMeta{
 		Uuid:   int(req.Uuid),
@@ -118,6 +147,12 @@ func (imp *ProcessorImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.
 		AppId:  app.Uuid,
 	}
 
+	var keyset *server.KeysetOption
+	keyset, err = server.KeysetFromMeta[server.ProcessorMeta](ctx, "")
+	if err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	total, err = dao.Count(&proc)
 	if err != nil {
 		return server.SqlErrResp(&GResp{resp}, err)
@@ -133,15 +168,31 @@ func (imp *ProcessorImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.
 		if req.Limit > 0 {
 			resp.Limit = req.Limit
 		}
-		var limitoption *server.LimitOption
-		if int(resp.Limit) < total {
-			limitoption = server.NewLimitOption(int(resp.Page), int(resp.Limit), "row_number")
+		var option server.DaoOption
+		if keyset != nil {
+			keyset.Limit = int(resp.Limit)
+			option = keyset
+		} else if int(resp.Limit) < total {
+			option = server.NewLimitOption(int(resp.Page), int(resp.Limit))
 		}
 
-		procs, err = dao.Select(&proc, limitoption)
+		procs, err = dao.Select(&proc, option)
 		if err != nil {
 			return server.SqlErrResp(&GResp{resp}, err)
 		}
+
+		var next string
+		procs, next = server.KeysetPage(keyset, procs)
+		if serr := server.SetNextPageToken(ctx, next); serr != nil {
+			logger.Warn("SetNextPageToken err", zap.String("error", serr.Error()))
+		}
+	}
+
+	if serr := server.SetRevisions(ctx, procs); serr != nil {
+		logger.Warn("SetRevisions err", zap.String("error", serr.Error()))
+	}
+	if serr := server.SetDeleted(ctx, procs); serr != nil {
+		logger.Warn("SetDeleted err", zap.String("error", serr.Error()))
 	}
 
 	resp.Count, resp.Processors, _ = server.Metas2Pbmeta[server.ProcessorMeta, pb.ProcessorMeta](&procs)
@@ -178,19 +229,35 @@ func (imp *ProcessorImp) Delete(ctx context.Context, req *pb.DeleteRequest) (res
 		Logger: logger,
 	}
 
-	var total int
-	total, err = dao.Count(&proc)
+	var procs []server.ProcessorMeta
+	procs, err = dao.Select(&proc)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
-	if total == 0 {
+
+	if len(procs) == 0 {
 		return server.NotFoundResp(&DResp{resp}, fmt.Sprintf("processor: %d 不存在", req.Uuid))
 	}
 
-	err = dao.Delete(&proc)
+	proc = procs[0]
+	if err = server.CheckRevision(ctx, proc.Revision); err != nil {
+		return server.StatusResp(&DResp{resp}, err)
+	}
+
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	txdao := ProcessorPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}
+	if err = txdao.Delete(&server.ProcessorMeta{Uuid: proc.Uuid, Revision: proc.Revision}); err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Deleted(kind, proc.TanantId, proc.Uuid, &proc)); err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
 
 	return server.OkResp(&DResp{resp})
 }
@@ -234,29 +301,56 @@ func (imp *ProcessorImp) Update(ctx context.Context, req *pb.UpdateRequest) (res
 
 	var newproc server.ProcessorMeta
 	proc = procs[0]
+	before := proc
+	if err = server.CheckRevision(ctx, proc.Revision); err != nil {
+		return server.StatusResp(&UResp{resp}, err)
+	}
+
+	addr := proc.Addr
 	newproc.Addr = req.Addr
 	newproc.Weight = int(req.Weight)
 	newproc.State = req.State
 
-	if !util.UpdateValueSame(&newproc, &proc) {
+	var isupdate bool
+	isupdate, err = server.MergeUpdate(ctx, req, &newproc, &proc, "addr", "weight", "state")
+	if err != nil {
+		return server.ParamterResp(&UResp{resp}, err.Error())
+	}
+	if !isupdate {
 		return server.ParamterResp(&UResp{resp}, "没有需要修改的内容")
 	}
+	if proc.Addr == "" {
+		return server.ParamterResp(&UResp{resp}, "addr 不能为空")
+	}
 
-	if req.Addr != "" {
-		procs, err = dao.Select(&server.ProcessorMeta{Addr: req.Addr, AppId: app.Uuid})
+	if proc.Addr != addr {
+		procs, err = dao.Select(&server.ProcessorMeta{Addr: proc.Addr, AppId: app.Uuid})
 		if err != nil {
 			return server.SqlErrResp(&UResp{resp}, err)
 		}
 		if len(procs) > 0 {
-			return server.NotFoundResp(&UResp{resp}, fmt.Sprintf("addr为 %s 的 processor 已经存在", req.Addr))
+			return server.NotFoundResp(&UResp{resp}, fmt.Sprintf("addr为 %s 的 processor 已经存在", proc.Addr))
 		}
 	}
 
 	proc.UpdateTime = types.Time(time.Now())
-	_, err = dao.Update(&proc)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&UResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	txdao := ProcessorPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}
+	if proc, err = txdao.Update(&proc); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Updated(kind, proc.TanantId, proc.Uuid, &before, &proc)); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, proc.Uuid, proc.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ := proc.ToPbMeta()
 	resp.Processor = &pbmeta
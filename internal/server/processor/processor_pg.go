@@ -1,8 +1,9 @@
 package processor
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/crt379/svc-collector-grpc/internal/server"
 	"github.com/crt379/svc-collector-grpc/internal/types"
@@ -14,17 +15,17 @@ var _ server.IDao[server.ProcessorMeta] = (*ProcessorPgDao)(nil)
 
 const (
 	table = "processor"
+	// 审计记录中的资源类型
+	kind = "processor"
 )
 
 var (
-	_fields   = [...]string{"uuid", "addr", "weight", "state", "create_time", "update_time", "aid", "tenant_id"}
-	_fields_0 = strings.Join(_fields[:], ",")
-	_fields_1 = strings.Join(_fields[1:], ",")
+	_fields = [...]string{"uuid", "addr", "weight", "state", "create_time", "update_time", "aid", "tenant_id", "revision", "deleted_at"}
 )
 
 type ProcessorPgDao struct {
-	W      *sqlx.DB
-	R      *sqlx.DB
+	W      server.DB
+	R      server.DB
 	Logger *zap.Logger
 	server.Dao
 	server.DaoLog
@@ -34,20 +35,12 @@ func (d *ProcessorPgDao) Table() string {
 	return table
 }
 
-func (d *ProcessorPgDao) fieldsStr(s int) string {
-	switch s {
-	case 0:
-		return _fields_0
-	case 1:
-		return _fields_1
-	}
-	return strings.Join(_fields[s:], ",")
-}
-
 func (d *ProcessorPgDao) Insert(meta *server.ProcessorMeta) (uuid int, err error) {
-	args := []any{meta.Addr, meta.Weight, meta.State, meta.CreateTime, meta.UpdateTime, meta.AppId, meta.TanantId}
-
-	query := d.InsertSQL(d.Table(), d.fieldsStr(1), len(args), "uuid")
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:]...).
+		Values(meta.Addr, meta.Weight, meta.State, meta.CreateTime, meta.UpdateTime, meta.AppId, meta.TanantId, server.InitRevision, meta.DeletedAt).
+		Returning("uuid").
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).Scan(&uuid)
@@ -56,42 +49,36 @@ func (d *ProcessorPgDao) Insert(meta *server.ProcessorMeta) (uuid int, err error
 }
 
 func (d *ProcessorPgDao) Select(meta *server.ProcessorMeta, ops ...server.DaoOption) (objs []server.ProcessorMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
 	if meta.Addr != "" {
-		k = append(k, "addr")
-		args = append(args, meta.Addr)
+		cs = append(cs, server.Eq("addr", meta.Addr))
 	}
 	if meta.Weight != 0 {
-		k = append(k, "weight")
-		args = append(args, meta.Weight)
+		cs = append(cs, server.Eq("weight", meta.Weight))
 	}
 	if meta.State != "" {
-		k = append(k, "state")
-		args = append(args, meta.State)
+		cs = append(cs, server.Eq("state", meta.State))
 	}
 	if meta.AppId != 0 {
-		k = append(k, "aid")
-		args = append(args, meta.AppId)
+		cs = append(cs, server.Eq("aid", meta.AppId))
 	}
 	if meta.TanantId != 0 {
-		k = append(k, "tenant_id")
-		args = append(args, meta.TanantId)
+		cs = append(cs, server.Eq("tenant_id", meta.TanantId))
 	}
 
-	optconditions := make([]string, 0)
-	for _, op := range ops {
-		optconditions = append(optconditions, op.Conditions()...)
-	}
+	cs = append(cs, d.Alive(d.Table())...)
 
-	query := d.SelectAddRowNumberSQL(d.Table(), d.fieldsStr(0), "uuid", k)
-	query = d.WithSQL("t", query)
-	query = d.SelectSQL(query, "t", d.fieldsStr(0), nil, optconditions...)
+	query, args := server.Select(_fields[:]...).
+		From(d.Table()).
+		Where(cs...).
+		OrderBy("uuid").
+		Options(d.Snapshot(d.Table())).
+		Options(ops...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -105,35 +92,30 @@ func (d *ProcessorPgDao) Select(meta *server.ProcessorMeta, ops ...server.DaoOpt
 }
 
 func (d *ProcessorPgDao) Count(meta *server.ProcessorMeta) (count int, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
 	if meta.Addr != "" {
-		k = append(k, "addr")
-		args = append(args, meta.Addr)
+		cs = append(cs, server.Eq("addr", meta.Addr))
 	}
 	if meta.Weight != 0 {
-		k = append(k, "weight")
-		args = append(args, meta.Weight)
+		cs = append(cs, server.Eq("weight", meta.Weight))
 	}
 	if meta.State != "" {
-		k = append(k, "state")
-		args = append(args, meta.State)
+		cs = append(cs, server.Eq("state", meta.State))
 	}
 	if meta.AppId != 0 {
-		k = append(k, "aid")
-		args = append(args, meta.AppId)
+		cs = append(cs, server.Eq("aid", meta.AppId))
 	}
 	if meta.TanantId != 0 {
-		k = append(k, "tenant_id")
-		args = append(args, meta.TanantId)
+		cs = append(cs, server.Eq("tenant_id", meta.TanantId))
 	}
 
-	query := d.SelectSQL("", d.Table(), "count(*)", k)
+	cs = append(cs, d.Alive(d.Table())...)
+
+	query, args := server.Select("count(*)").From(d.Table()).Where(cs...).Options(d.Snapshot(d.Table())).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.R.QueryRowx(query, args...).Scan(&count)
@@ -142,57 +124,67 @@ func (d *ProcessorPgDao) Count(meta *server.ProcessorMeta) (count int, err error
 }
 
 func (d *ProcessorPgDao) Delete(meta *server.ProcessorMeta) (err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
+	}
+	if meta.Revision != 0 {
+		cs = append(cs, server.Eq("revision", meta.Revision))
 	}
-	if len(k) == 0 {
+	if len(cs) == 0 {
 		return nil
 	}
 
-	query := d.DeleteSQL(d.Table(), k)
+	cs = append(cs, server.IsNull(server.DeletedAtCol))
+
+	query, args := server.Update(d.Table()).
+		Set(server.DeletedAtCol, server.DeleteTime(meta.DeletedAt)).
+		Where(cs...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
-	_, err = d.W.Exec(query, args...)
+	var result sql.Result
+	result, err = d.W.Exec(query, args...)
+	if err != nil || meta.Revision == 0 {
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		err = server.StaleErr(d.W, d.Table(), meta.Uuid)
+	}
 
 	return
 }
 
 func (d *ProcessorPgDao) Update(meta *server.ProcessorMeta) (obj server.ProcessorMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-
 	if meta.Uuid == 0 {
 		return obj, fmt.Errorf("uuid is 0")
 	}
 
-	if meta.Addr != "" {
-		k = append(k, "addr")
-		args = append(args, meta.Addr)
-	}
-	if meta.Weight != 0 {
-		k = append(k, "weight")
-		args = append(args, meta.Weight)
-	}
-	if meta.State != "" {
-		k = append(k, "state")
-		args = append(args, meta.State)
-	}
+	// 可修改的列总是写入, 调用方传入完整的对象
+	b := server.Update(d.Table())
+	b.Set("addr", meta.Addr)
+	b.Set("weight", meta.Weight)
+	b.Set("state", meta.State)
 
 	var zerotime types.Time
 	if meta.UpdateTime != zerotime {
-		k = append(k, "update_time")
-		args = append(args, meta.UpdateTime)
+		b.Set("update_time", meta.UpdateTime)
 	}
+	b.Incr("revision", 1)
 
-	args = append(args, meta.Uuid)
-	query := d.UpdateSQL(d.Table(), k, d.fieldsStr(0), []string{"uuid"})
+	cs := []server.Cond{server.Eq("uuid", meta.Uuid), server.IsNull(server.DeletedAtCol)}
+	if meta.Revision != 0 {
+		cs = append(cs, server.Eq("revision", meta.Revision))
+	}
+
+	query, args := b.Where(cs...).Returning(_fields[:]...).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).StructScan(&obj)
+	if errors.Is(err, sql.ErrNoRows) && meta.Revision != 0 {
+		err = server.StaleErr(d.W, d.Table(), meta.Uuid)
+	}
 
 	return obj, err
 }
@@ -0,0 +1,563 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 拼接 sql 语句, 所有的值都作为参数按 $n 绑定
+type sqlWriter struct {
+	strings.Builder
+	args []any
+}
+
+func (w *sqlWriter) arg(v any) {
+	w.args = append(w.args, v)
+	w.WriteByte('$')
+	w.WriteString(strconv.Itoa(len(w.args)))
+}
+
+func (w *sqlWriter) list(items []string) {
+	w.WriteString(strings.Join(items, ", "))
+}
+
+func (w *sqlWriter) where(cs []Cond) {
+	if len(cs) == 0 {
+		return
+	}
+	w.WriteString(" WHERE ")
+	And(cs...).writeTo(w)
+}
+
+func (w *sqlWriter) returning(cols []string) {
+	if len(cols) == 0 {
+		return
+	}
+	w.WriteString(" RETURNING ")
+	w.list(cols)
+}
+
+type Builder interface {
+	ToSQL() (string, []any)
+}
+
+// where 条件, 列名由代码给出不做转义, 值全部作为参数绑定
+type Cond interface {
+	writeTo(w *sqlWriter)
+}
+
+type compare struct {
+	col string
+	op  string
+	v   any
+}
+
+func (c compare) writeTo(w *sqlWriter) {
+	w.WriteString(c.col)
+	w.WriteByte(' ')
+	w.WriteString(c.op)
+	w.WriteByte(' ')
+	w.arg(c.v)
+}
+
+func Eq(col string, v any) Cond    { return compare{col, "=", v} }
+func Ne(col string, v any) Cond    { return compare{col, "<>", v} }
+func Gt(col string, v any) Cond    { return compare{col, ">", v} }
+func Ge(col string, v any) Cond    { return compare{col, ">=", v} }
+func Lt(col string, v any) Cond    { return compare{col, "<", v} }
+func Le(col string, v any) Cond    { return compare{col, "<=", v} }
+func Like(col string, v any) Cond  { return compare{col, "LIKE", v} }
+func ILike(col string, v any) Cond { return compare{col, "ILIKE", v} }
+
+type colCompare struct {
+	col1 string
+	op   string
+	col2 string
+}
+
+func (c colCompare) writeTo(w *sqlWriter) {
+	w.WriteString(c.col1)
+	w.WriteByte(' ')
+	w.WriteString(c.op)
+	w.WriteByte(' ')
+	w.WriteString(c.col2)
+}
+
+// 两列相等, 用于 join
+func EqCol(col1, col2 string) Cond { return colCompare{col1, "=", col2} }
+
+type in struct {
+	col string
+	vs  []any
+}
+
+func (c in) writeTo(w *sqlWriter) {
+	if len(c.vs) == 0 {
+		w.WriteString("FALSE")
+		return
+	}
+	w.WriteString(c.col)
+	w.WriteString(" IN (")
+	for i, v := range c.vs {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.arg(v)
+	}
+	w.WriteByte(')')
+}
+
+// vs 为空时条件为 FALSE
+func In[T any](col string, vs ...T) Cond {
+	c := in{col: col, vs: make([]any, len(vs))}
+	for i, v := range vs {
+		c.vs[i] = v
+	}
+	return c
+}
+
+type inQuery struct {
+	col string
+	q   *SelectBuilder
+}
+
+func (c inQuery) writeTo(w *sqlWriter) {
+	w.WriteString(c.col)
+	w.WriteString(" IN (")
+	c.q.writeTo(w)
+	w.WriteByte(')')
+}
+
+func InQuery(col string, q *SelectBuilder) Cond { return inQuery{col, q} }
+
+type between struct {
+	col    string
+	lo, hi any
+}
+
+func (c between) writeTo(w *sqlWriter) {
+	w.WriteString(c.col)
+	w.WriteString(" BETWEEN ")
+	w.arg(c.lo)
+	w.WriteString(" AND ")
+	w.arg(c.hi)
+}
+
+func Between(col string, lo, hi any) Cond { return between{col, lo, hi} }
+
+type isNull struct {
+	col string
+	not bool
+}
+
+func (c isNull) writeTo(w *sqlWriter) {
+	w.WriteString(c.col)
+	if c.not {
+		w.WriteString(" IS NOT NULL")
+	} else {
+		w.WriteString(" IS NULL")
+	}
+}
+
+func IsNull(col string) Cond    { return isNull{col, false} }
+func IsNotNull(col string) Cond { return isNull{col, true} }
+
+type exists struct {
+	q   *SelectBuilder
+	not bool
+}
+
+func (c exists) writeTo(w *sqlWriter) {
+	if c.not {
+		w.WriteString("NOT ")
+	}
+	w.WriteString("EXISTS (")
+	c.q.writeTo(w)
+	w.WriteByte(')')
+}
+
+func Exists(q *SelectBuilder) Cond    { return exists{q, false} }
+func NotExists(q *SelectBuilder) Cond { return exists{q, true} }
+
+type not struct {
+	c Cond
+}
+
+func (c not) writeTo(w *sqlWriter) {
+	w.WriteString("NOT (")
+	c.c.writeTo(w)
+	w.WriteByte(')')
+}
+
+func Not(c Cond) Cond { return not{c} }
+
+type group struct {
+	op string
+	cs []Cond
+}
+
+func (c group) writeTo(w *sqlWriter) {
+	switch len(c.cs) {
+	case 0:
+		// 空的 AND 恒为真, 空的 OR 恒为假
+		if c.op == "AND" {
+			w.WriteString("TRUE")
+		} else {
+			w.WriteString("FALSE")
+		}
+		return
+	case 1:
+		c.cs[0].writeTo(w)
+		return
+	}
+
+	w.WriteByte('(')
+	for i, cc := range c.cs {
+		if i > 0 {
+			w.WriteByte(' ')
+			w.WriteString(c.op)
+			w.WriteByte(' ')
+		}
+		cc.writeTo(w)
+	}
+	w.WriteByte(')')
+}
+
+func And(cs ...Cond) Cond { return group{"AND", cs} }
+func Or(cs ...Cond) Cond  { return group{"OR", cs} }
+
+type cte struct {
+	name string
+	q    *SelectBuilder
+}
+
+type join struct {
+	kind  string
+	table string
+	on    []Cond
+}
+
+type SelectBuilder struct {
+	ctes    []cte
+	columns []string
+	from    string
+	joins   []join
+	where   []Cond
+	groupBy []string
+	orderBy []string
+	limit   int
+	offset  int
+	lock    string
+}
+
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+func (b *SelectBuilder) With(name string, q *SelectBuilder) *SelectBuilder {
+	b.ctes = append(b.ctes, cte{name, q})
+	return b
+}
+
+func (b *SelectBuilder) Columns(columns ...string) *SelectBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.from = table
+	return b
+}
+
+func (b *SelectBuilder) Join(table string, on ...Cond) *SelectBuilder {
+	b.joins = append(b.joins, join{"JOIN", table, on})
+	return b
+}
+
+func (b *SelectBuilder) LeftJoin(table string, on ...Cond) *SelectBuilder {
+	b.joins = append(b.joins, join{"LEFT JOIN", table, on})
+	return b
+}
+
+// 多次调用的条件之间为 AND
+func (b *SelectBuilder) Where(cs ...Cond) *SelectBuilder {
+	b.where = append(b.where, cs...)
+	return b
+}
+
+func (b *SelectBuilder) GroupBy(columns ...string) *SelectBuilder {
+	b.groupBy = append(b.groupBy, columns...)
+	return b
+}
+
+// columns 可以带 ASC/DESC, 如 "uuid DESC"
+func (b *SelectBuilder) OrderBy(columns ...string) *SelectBuilder {
+	b.orderBy = append(b.orderBy, columns...)
+	return b
+}
+
+// 替换已有的排序
+func (b *SelectBuilder) SetOrderBy(columns ...string) *SelectBuilder {
+	b.orderBy = columns
+	return b
+}
+
+// n <= 0 时不限制
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+func (b *SelectBuilder) Offset(n int) *SelectBuilder {
+	b.offset = n
+	return b
+}
+
+// 行锁, 如 "UPDATE", "UPDATE SKIP LOCKED"
+func (b *SelectBuilder) For(lock string) *SelectBuilder {
+	b.lock = lock
+	return b
+}
+
+func (b *SelectBuilder) Options(ops ...DaoOption) *SelectBuilder {
+	for _, op := range ops {
+		if op != nil {
+			op.Apply(b)
+		}
+	}
+	return b
+}
+
+func (b *SelectBuilder) writeTo(w *sqlWriter) {
+	if len(b.ctes) > 0 {
+		w.WriteString("WITH ")
+		for i, c := range b.ctes {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(c.name)
+			w.WriteString(" AS (")
+			c.q.writeTo(w)
+			w.WriteByte(')')
+		}
+		w.WriteByte(' ')
+	}
+
+	w.WriteString("SELECT ")
+	w.list(b.columns)
+	w.WriteString(" FROM ")
+	w.WriteString(b.from)
+
+	for _, j := range b.joins {
+		w.WriteByte(' ')
+		w.WriteString(j.kind)
+		w.WriteByte(' ')
+		w.WriteString(j.table)
+		w.WriteString(" ON ")
+		And(j.on...).writeTo(w)
+	}
+
+	w.where(b.where)
+
+	if len(b.groupBy) > 0 {
+		w.WriteString(" GROUP BY ")
+		w.list(b.groupBy)
+	}
+	if len(b.orderBy) > 0 {
+		w.WriteString(" ORDER BY ")
+		w.list(b.orderBy)
+	}
+	if b.limit > 0 {
+		w.WriteString(" LIMIT ")
+		w.arg(b.limit)
+	}
+	if b.offset > 0 {
+		w.WriteString(" OFFSET ")
+		w.arg(b.offset)
+	}
+	if b.lock != "" {
+		w.WriteString(" FOR ")
+		w.WriteString(b.lock)
+	}
+}
+
+func (b *SelectBuilder) ToSQL() (string, []any) {
+	var w sqlWriter
+	b.writeTo(&w)
+	return w.String(), w.args
+}
+
+type InsertBuilder struct {
+	table     string
+	columns   []string
+	rows      [][]any
+	conflict  []string
+	updates   []string
+	returning []string
+}
+
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+func (b *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	b.columns = append(b.columns, columns...)
+	return b
+}
+
+// 每次调用添加一行
+func (b *InsertBuilder) Values(vs ...any) *InsertBuilder {
+	b.rows = append(b.rows, vs)
+	return b
+}
+
+// ON CONFLICT (columns), 没有 DoUpdate 时为 DO NOTHING
+func (b *InsertBuilder) OnConflict(columns ...string) *InsertBuilder {
+	b.conflict = append(b.conflict, columns...)
+	return b
+}
+
+// DO UPDATE SET col = EXCLUDED.col, 冲突时 RETURNING 返回已经存在的行
+func (b *InsertBuilder) DoUpdate(columns ...string) *InsertBuilder {
+	b.updates = append(b.updates, columns...)
+	return b
+}
+
+func (b *InsertBuilder) Returning(columns ...string) *InsertBuilder {
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+func (b *InsertBuilder) ToSQL() (string, []any) {
+	var w sqlWriter
+	w.WriteString("INSERT INTO ")
+	w.WriteString(b.table)
+	w.WriteString(" (")
+	w.list(b.columns)
+	w.WriteString(") VALUES ")
+	for i, row := range b.rows {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteByte('(')
+		for j, v := range row {
+			if j > 0 {
+				w.WriteString(", ")
+			}
+			w.arg(v)
+		}
+		w.WriteByte(')')
+	}
+	if len(b.conflict) > 0 && len(b.updates) == 0 {
+		w.WriteString(" ON CONFLICT (")
+		w.list(b.conflict)
+		w.WriteString(") DO NOTHING")
+	}
+	if len(b.conflict) > 0 && len(b.updates) > 0 {
+		w.WriteString(" ON CONFLICT (")
+		w.list(b.conflict)
+		w.WriteString(") DO UPDATE SET ")
+		for i, col := range b.updates {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(col)
+			w.WriteString(" = EXCLUDED.")
+			w.WriteString(col)
+		}
+	}
+	w.returning(b.returning)
+
+	return w.String(), w.args
+}
+
+type set struct {
+	col  string
+	v    any
+	incr bool
+}
+
+type UpdateBuilder struct {
+	table     string
+	sets      []set
+	where     []Cond
+	returning []string
+}
+
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+func (b *UpdateBuilder) Set(col string, v any) *UpdateBuilder {
+	b.sets = append(b.sets, set{col, v, false})
+	return b
+}
+
+// col = col + v
+func (b *UpdateBuilder) Incr(col string, v any) *UpdateBuilder {
+	b.sets = append(b.sets, set{col, v, true})
+	return b
+}
+
+func (b *UpdateBuilder) Where(cs ...Cond) *UpdateBuilder {
+	b.where = append(b.where, cs...)
+	return b
+}
+
+func (b *UpdateBuilder) Returning(columns ...string) *UpdateBuilder {
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+func (b *UpdateBuilder) ToSQL() (string, []any) {
+	var w sqlWriter
+	w.WriteString("UPDATE ")
+	w.WriteString(b.table)
+	w.WriteString(" SET ")
+	for i, s := range b.sets {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(s.col)
+		w.WriteString(" = ")
+		if s.incr {
+			w.WriteString(s.col)
+			w.WriteString(" + ")
+		}
+		w.arg(s.v)
+	}
+	w.where(b.where)
+	w.returning(b.returning)
+
+	return w.String(), w.args
+}
+
+type DeleteBuilder struct {
+	table     string
+	where     []Cond
+	returning []string
+}
+
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+func (b *DeleteBuilder) Where(cs ...Cond) *DeleteBuilder {
+	b.where = append(b.where, cs...)
+	return b
+}
+
+func (b *DeleteBuilder) Returning(columns ...string) *DeleteBuilder {
+	b.returning = append(b.returning, columns...)
+	return b
+}
+
+func (b *DeleteBuilder) ToSQL() (string, []any) {
+	var w sqlWriter
+	w.WriteString("DELETE FROM ")
+	w.WriteString(b.table)
+	w.where(b.where)
+	w.returning(b.returning)
+
+	return w.String(), w.args
+}
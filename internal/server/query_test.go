@@ -0,0 +1,117 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToSQL(t *testing.T) {
+	cases := []struct {
+		name  string
+		b     Builder
+		query string
+		args  []any
+	}{
+		{
+			name: "cte where limit offset",
+			b: Select("uuid", "name").
+				With("recent", Select("*").From("service").Where(Ge("create_time", 1), Lt("create_time", 1))).
+				From("recent").
+				Where(Eq("tenant_id", 7), Like("name", "a%")).
+				OrderBy("uuid").
+				Limit(10).
+				Offset(20),
+			query: "WITH recent AS (SELECT * FROM service WHERE (create_time >= $1 AND create_time < $2)) " +
+				"SELECT uuid, name FROM recent WHERE (tenant_id = $3 AND name LIKE $4) ORDER BY uuid LIMIT $5 OFFSET $6",
+			args: []any{1, 1, 7, "a%", 10, 20},
+		},
+		{
+			name:  "empty in",
+			b:     Select("uuid").From("service").Where(Eq("tenant_id", 1), In[int]("uuid")),
+			query: "SELECT uuid FROM service WHERE (tenant_id = $1 AND FALSE)",
+			args:  []any{1},
+		},
+		{
+			name:  "in",
+			b:     Select("uuid").From("service").Where(In("uuid", 3, 4, 5)),
+			query: "SELECT uuid FROM service WHERE uuid IN ($1, $2, $3)",
+			args:  []any{3, 4, 5},
+		},
+		{
+			name: "nested or and",
+			b: Select("uuid").From("t").Where(
+				Or(
+					And(Eq("a", 1), Gt("b", 2)),
+					And(Eq("a", 1), Eq("b", 2), Lt("c", 3)),
+					IsNull("d"),
+				),
+				Not(Or(Eq("e", 4))),
+				Or(),
+				And(),
+			),
+			query: "SELECT uuid FROM t WHERE (((a = $1 AND b > $2) OR (a = $3 AND b = $4 AND c < $5) OR d IS NULL) AND NOT (e = $6) AND FALSE AND TRUE)",
+			args:  []any{1, 2, 1, 2, 3, 4},
+		},
+		{
+			name: "in query",
+			b: Delete("jdata").Where(InQuery("uuid",
+				Select("uuid").From("jdata").Where(Eq("uuid", 9), NotExists(
+					Select("1").From("svc_api_example").Where(EqCol("svc_api_example.jid", "jdata.uuid")),
+				)).For("UPDATE SKIP LOCKED"),
+			)).Returning("uuid"),
+			query: "DELETE FROM jdata WHERE uuid IN (SELECT uuid FROM jdata WHERE (uuid = $1 AND NOT EXISTS " +
+				"(SELECT 1 FROM svc_api_example WHERE svc_api_example.jid = jdata.uuid)) FOR UPDATE SKIP LOCKED) RETURNING uuid",
+			args: []any{9},
+		},
+		{
+			name: "for",
+			b: Select("uuid").From("service").
+				Join("tenant", EqCol("service.tenant_id", "tenant.uuid")).
+				Where(Eq("service.uuid", 1)).
+				Options(LockOption("SHARE OF service")),
+			query: "SELECT uuid FROM service JOIN tenant ON service.tenant_id = tenant.uuid WHERE service.uuid = $1 FOR SHARE OF service",
+			args:  []any{1},
+		},
+		{
+			name: "on conflict",
+			b: Insert("jdata").
+				Columns("data", "hash_type", "hash_value").
+				Values("{}", "sha256", "x").
+				Values("[]", "sha256", "y").
+				OnConflict("hash_type", "hash_value").
+				DoUpdate("hash_value").
+				Returning("uuid"),
+			query: "INSERT INTO jdata (data, hash_type, hash_value) VALUES ($1, $2, $3), ($4, $5, $6) " +
+				"ON CONFLICT (hash_type, hash_value) DO UPDATE SET hash_value = EXCLUDED.hash_value RETURNING uuid",
+			args: []any{"{}", "sha256", "x", "[]", "sha256", "y"},
+		},
+		{
+			name:  "on conflict without update",
+			b:     Insert("t").Columns("a").Values(1).OnConflict("a"),
+			query: "INSERT INTO t (a) VALUES ($1) ON CONFLICT (a) DO NOTHING",
+			args:  []any{1},
+		},
+		{
+			name: "update",
+			b: Update("service").
+				Set("name", "s").
+				Incr("tenant_id", 1).
+				Where(Eq("uuid", 2), Eq("tenant_id", 3), Between("update_time", 4, 5)).
+				Returning("update_time"),
+			query: "UPDATE service SET name = $1, tenant_id = tenant_id + $2 WHERE (uuid = $3 AND tenant_id = $4 AND update_time BETWEEN $5 AND $6) RETURNING update_time",
+			args:  []any{"s", 1, 2, 3, 4, 5},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query, args := c.b.ToSQL()
+			if query != c.query {
+				t.Errorf("query:\n got: %s\nwant: %s", query, c.query)
+			}
+			if !reflect.DeepEqual(args, c.args) {
+				t.Errorf("args: got %v, want %v", args, c.args)
+			}
+		})
+	}
+}
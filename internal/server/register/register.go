@@ -197,6 +197,7 @@ func ToPbRegisterInfo(_ context.Context, service string, add string) *pb.Registe
 
 type RegisterImp struct {
 	pb.UnimplementedRegisterServer
+	Verifier *Verifier
 }
 
 func (imp *RegisterImp) GetRegister(ctx context.Context, req *pb.GetRegisterRequest) (resp *pb.GetRegisterReply, err error) {
@@ -216,8 +217,8 @@ func (imp *RegisterImp) Register(ctx context.Context, req *pb.RegisterRequest) (
 
 	resp = new(pb.RegisterReply)
 
-	if req.Verify != config.AppConfig.Addr {
-		return server.ParamterResp(&CResp{resp}, "verify 校验不通过")
+	if err = imp.Verifier.Verify(ctx, "register", req.Service, req.Verify); err != nil {
+		return server.StatusResp(&CResp{resp}, err)
 	}
 	if req.Service == "" {
 		return server.ParamterResp(&CResp{resp}, "service 不能为空")
@@ -239,8 +240,8 @@ func (imp *RegisterImp) Unregister(ctx context.Context, req *pb.UnregisterReques
 
 	resp = new(pb.UnregisterReply)
 
-	if req.Verify != config.AppConfig.Addr {
-		return server.ParamterResp(&DResp{resp}, "verify 校验不通过")
+	if err = imp.Verifier.Verify(ctx, "unregister", req.Service, req.Verify); err != nil {
+		return server.StatusResp(&DResp{resp}, err)
 	}
 
 	resp.Infos = InternalUnregister(req.Service, ToPbRegisterInfo)
@@ -5,6 +5,6 @@ import (
 	"google.golang.org/grpc"
 )
 
-func RegisterServer(srv *grpc.Server) {
-	pb.RegisterRegisterServer(srv, &RegisterImp{})
+func RegisterServer(srv *grpc.Server, v *Verifier) {
+	pb.RegisterRegisterServer(srv, &RegisterImp{Verifier: v})
 }
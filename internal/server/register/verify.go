@@ -0,0 +1,139 @@
+package register
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	kind = "register"
+
+	defaultMaxFailures = 5
+	defaultWindow      = time.Minute
+)
+
+type failure struct {
+	count int
+	first time.Time
+}
+
+// 比较请求的 verify 和配置的 secret, secret 为空时拒绝所有请求.
+// 同一个地址在 Window 内失败 MaxFailures 次后, 到 Window 结束前拒绝该地址的所有请求, 不再比较 secret
+type Verifier struct {
+	Secret      string
+	MaxFailures int
+	Window      time.Duration
+	Logger      *zap.Logger
+
+	mu    sync.Mutex
+	fails map[string]*failure
+}
+
+func (v *Verifier) maxFailures() int {
+	if v.MaxFailures <= 0 {
+		return defaultMaxFailures
+	}
+	return v.MaxFailures
+}
+
+func (v *Verifier) window() time.Duration {
+	if v.Window <= 0 {
+		return defaultWindow
+	}
+	return v.Window
+}
+
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func (v *Verifier) limited(host string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	f, ok := v.fails[host]
+	if !ok {
+		return false
+	}
+	if now.Sub(f.first) >= v.window() {
+		delete(v.fails, host)
+		return false
+	}
+	return f.count >= v.maxFailures()
+}
+
+func (v *Verifier) fail(host string, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.fails == nil {
+		v.fails = make(map[string]*failure)
+	}
+	// 删除过期的记录, 避免一直增长
+	for h, f := range v.fails {
+		if now.Sub(f.first) >= v.window() {
+			delete(v.fails, h)
+		}
+	}
+
+	f, ok := v.fails[host]
+	if !ok {
+		f = &failure{first: now}
+		v.fails[host] = f
+	}
+	f.count++
+}
+
+// 拒绝的请求计数并写入审计记录, reason 为 verify 或 limited
+func (v *Verifier) deny(ctx context.Context, host string, now time.Time, reason string, action string, service string) {
+	v.fail(host, now)
+	v.Logger.Warn("register verify denied", zap.String("action", action), zap.String("peer", host), zap.String("service", service), zap.String("reason", reason))
+
+	attempt := map[string]string{
+		"action":  action,
+		"service": service,
+		"peer":    host,
+		"reason":  reason,
+	}
+	if err := audit.Write(storage.WriteDB, v.Logger, audit.SourceFromContext(ctx), audit.Denied(kind, attempt)); err != nil {
+		v.Logger.Warn("register audit err", zap.String("error", err.Error()))
+	}
+}
+
+// 拒绝时写入审计记录, 返回 Unauthenticated 或 ResourceExhausted
+func (v *Verifier) Verify(ctx context.Context, action string, service string, verify string) error {
+	host := peerHost(ctx)
+	now := time.Now()
+
+	// 限制期间不比较 secret, 正确的 secret 也被拒绝
+	if v.limited(host, now) {
+		v.deny(ctx, host, now, "limited", action, service)
+		return status.Error(codes.ResourceExhausted, "校验失败次数过多, 请稍后再试")
+	}
+
+	if v.Secret != "" && subtle.ConstantTimeCompare([]byte(verify), []byte(v.Secret)) == 1 {
+		return nil
+	}
+
+	v.deny(ctx, host, now, "verify", action, service)
+	return status.Error(codes.Unauthenticated, "verify 校验不通过")
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Update 和 Delete 的前置条件, 与当前 revision 不一致时拒绝修改
+	IfRevisionKey = "x-if-revision"
+	// 响应 header, 值为 "uuid=revision", Get 返回多个时每行一个.
+	// 两个 header 都是 proto 的 meta 消息和 Update/Delete 请求加入 revision 字段之前的替代
+	RevisionKey = "x-revision"
+)
+
+// 新建数据的 revision
+const InitRevision int64 = 1
+
+// 每次修改 revision 加一, 带 revision 条件的修改或删除没有命中时返回, 说明数据已经被其他请求修改
+type StaleError struct {
+	Table   string
+	Uuid    int
+	Current int64
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("%s %d 已经被修改, 当前 revision: %d", e.Table, e.Uuid, e.Current)
+}
+
+// 查询当前 revision 并返回 StaleError, 数据已经被删除时返回 sql.ErrNoRows
+func StaleErr(db DB, table string, uuid int) error {
+	var current int64
+	query, args := Select("revision").From(table).Where(Eq("uuid", uuid), IsNull(DeletedAtCol)).ToSQL()
+	if err := db.QueryRowx(query, args...).Scan(&current); err != nil {
+		return err
+	}
+
+	return &StaleError{Table: table, Uuid: uuid, Current: current}
+}
+
+// 从 grpc meta 读取 IfRevisionKey, 没有时返回 0
+func IfRevisionFromMeta(ctx context.Context) (int64, error) {
+	md, ok := ctxvalue.GrpcMetaContext{}.GetValue(ctx)
+	if !ok {
+		return 0, nil
+	}
+
+	values := md.Get(IfRevisionKey)
+	if len(values) == 0 || values[0] == "" {
+		return 0, nil
+	}
+
+	rev, err := strconv.ParseInt(strings.TrimSpace(values[0]), 10, 64)
+	if err != nil || rev <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", IfRevisionKey, values[0])
+	}
+
+	return rev, nil
+}
+
+// 检查请求的前置条件, 返回 grpc status error
+func CheckRevision(ctx context.Context, current int64) error {
+	rev, err := IfRevisionFromMeta(ctx)
+	if err != nil {
+		return InvalidArgumentErr(err.Error())
+	}
+	if rev != 0 && rev != current {
+		return FailedPreconditionErr(fmt.Sprintf("revision 不匹配, 当前 revision: %d", current))
+	}
+
+	return nil
+}
+
+type revisioned interface {
+	revision() (int, int64)
+}
+
+// 设置响应 header RevisionKey
+func SetRevision(ctx context.Context, uuid int, revision int64) error {
+	return grpc.SetHeader(ctx, metadata.Pairs(RevisionKey, fmt.Sprintf("%d=%d", uuid, revision)))
+}
+
+// 设置 Get 返回的每个 meta 的 revision
+func SetRevisions[T any, PT interface {
+	*T
+	revisioned
+}](ctx context.Context, objs []T) error {
+	if len(objs) == 0 {
+		return nil
+	}
+
+	kv := make([]string, 0, len(objs)*2)
+	for i := range objs {
+		uuid, rev := PT(&objs[i]).revision()
+		kv = append(kv, RevisionKey, fmt.Sprintf("%d=%d", uuid, rev))
+	}
+
+	return grpc.SetHeader(ctx, metadata.Pairs(kv...))
+}
@@ -19,21 +19,22 @@ func CheckByMeta(ctx context.Context, tenantid, uuid int) (service server.Servic
 
 	dao := ServicePgDao{
 		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		R:      storage.WriteDB,
 		Logger: logger,
 	}
 
-	var services []server.ServiceMeta
-	services, err = dao.Select(&server.ServiceMeta{Uuid: uuid, TenantId: tenantid})
+	// 读主库, 从库的旧数据会在删除缓存后写回. 缓存不区分 tenant, 读取后再检查
+	var found bool
+	service, found, err = Cache(logger).Load(uuid, func() ([]server.ServiceMeta, error) {
+		return dao.Select(&server.ServiceMeta{Uuid: uuid})
+	})
 	if err != nil {
-		return service, server.InternalErr(err.Error())
+		return service, server.SqlErr(err)
 	}
 
-	if len(services) == 0 {
-		return service, server.NotFoundErr(fmt.Sprintf("service: %d not found", uuid))
+	if !found || service.TenantId != tenantid {
+		return server.ServiceMeta{}, server.NotFoundErr(fmt.Sprintf("service: %d not found", uuid))
 	}
 
-	service = services[0]
-
 	return service, nil
 }
@@ -0,0 +1,20 @@
+package service
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/server"
+)
+
+func sidCond(sid int) server.Cond {
+	return server.Eq("sid", sid)
+}
+
+// 引用 service 的表, 按删除顺序排列
+func Dependents() []server.Dependent {
+	return []server.Dependent{
+		{Table: "app_svc_relation", Kind: "appsvc", Cond: sidCond},
+		{Table: "svc_api_example", Kind: "svcapieg", Cond: func(sid int) server.Cond {
+			return server.InQuery("aid", server.Select("uuid").From("service_api").Where(sidCond(sid)))
+		}},
+		{Table: "service_api", Kind: "svcapi", Cond: sidCond, Cache: "svcapi"},
+	}
+}
@@ -8,10 +8,12 @@ import (
 	pb "github.com/crt379/svc-collector-grpc-proto/service"
 	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
 	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
 	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
 	"github.com/crt379/svc-collector-grpc/internal/storage"
 	"github.com/crt379/svc-collector-grpc/internal/types"
 	"github.com/crt379/svc-collector-grpc/internal/util"
+	"go.uber.org/zap"
 )
 
 type ServiceImp struct {
@@ -71,10 +73,29 @@ func (imp *ServiceImp) Create(ctx context.Context, req *pb.CreateRequest) (resp
 	}
 	service.UpdateTime = service.CreateTime
 
-	service.Uuid, err = dao.Insert(&service)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	// tenant 在创建提交前不能被删除
+	if err = server.LockAlive(uow.Tx, logger, "tenant", tenant.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	cdao := server.NewCacheDao(&ServicePgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	if service.Uuid, err = cdao.Insert(&service); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	service.Revision = server.InitRevision
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Created(kind, tenant.Uuid, service.Uuid, &service)); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, service.Uuid, service.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ := service.ToPbMeta()
 	resp.Service = &pbmeta
@@ -105,10 +126,23 @@ func (imp *ServiceImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Ge
 		Logger: logger,
 	}
 
+	if dao.ShowDeleted, err = server.BoolFromMeta(ctx, server.ShowDeletedKey); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+	if dao.AsOf, err = server.AsOfFromMeta(ctx); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	service.Uuid = int(req.Uuid)
 	service.Name = req.Name
 	service.TenantId = tenant.Uuid
 
+	var keyset *server.KeysetOption
+	keyset, err = server.KeysetFromMeta[server.ServiceMeta](ctx, "")
+	if err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	total, err = dao.Count(&service)
 	if err != nil {
 		return server.SqlErrResp(&GResp{resp}, err)
@@ -123,15 +157,31 @@ func (imp *ServiceImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Ge
 		if req.Limit > 0 {
 			resp.Limit = req.Limit
 		}
-		var limitoption *server.LimitOption
-		if int(resp.Limit) < total {
-			limitoption = server.NewLimitOption(int(resp.Page), int(resp.Limit), "row_number")
+		var option server.DaoOption
+		if keyset != nil {
+			keyset.Limit = int(resp.Limit)
+			option = keyset
+		} else if int(resp.Limit) < total {
+			option = server.NewLimitOption(int(resp.Page), int(resp.Limit))
 		}
 
-		services, err = dao.Select(&service, limitoption)
+		services, err = dao.Select(&service, option)
 		if err != nil {
 			return server.SqlErrResp(&GResp{resp}, err)
 		}
+
+		var next string
+		services, next = server.KeysetPage(keyset, services)
+		if serr := server.SetNextPageToken(ctx, next); serr != nil {
+			logger.Warn("SetNextPageToken err", zap.String("error", serr.Error()))
+		}
+	}
+
+	if serr := server.SetRevisions(ctx, services); serr != nil {
+		logger.Warn("SetRevisions err", zap.String("error", serr.Error()))
+	}
+	if serr := server.SetDeleted(ctx, services); serr != nil {
+		logger.Warn("SetDeleted err", zap.String("error", serr.Error()))
 	}
 
 	resp.Count, resp.Services, _ = server.Metas2Pbmeta[server.ServiceMeta, pb.ServiceMeta](&services)
@@ -142,9 +192,9 @@ func (imp *ServiceImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Ge
 
 func (imp *ServiceImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *pb.DeleteReply, err error) {
 	var (
-		tenant  server.TenantMeta
-		service server.ServiceMeta
-		total   int
+		tenant   server.TenantMeta
+		service  server.ServiceMeta
+		services []server.ServiceMeta
 	)
 
 	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
@@ -170,19 +220,52 @@ func (imp *ServiceImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp
 	service.Uuid = int(req.Uuid)
 	service.TenantId = tenant.Uuid
 
-	total, err = dao.Count(&service)
+	services, err = dao.Select(&service)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
 
-	if total == 0 {
+	if len(services) == 0 {
 		return server.NotFoundResp(&DResp{resp}, fmt.Sprintf("service: %d 不存在", req.Uuid))
 	}
 
-	err = dao.Delete(&service)
+	service = services[0]
+	if err = server.CheckRevision(ctx, service.Revision); err != nil {
+		return server.StatusResp(&DResp{resp}, err)
+	}
+
+	var cascade bool
+	if cascade, err = server.BoolFromMeta(ctx, server.CascadeKey); err != nil {
+		return server.ParamterResp(&DResp{resp}, err.Error())
+	}
+
+	// 默认有引用时拒绝删除, cascade 时在同一个事务中删除引用的数据
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	cdao := server.NewCacheDao(&ServicePgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	record := audit.Cascaded(audit.SourceFromContext(ctx), logger, tenant.Uuid, kind, service.Uuid)
+
+	var counts []server.TableCount
+	counts, err = server.DeleteWithDependents(uow, table, Dependents(), service.Uuid, cascade, record, func(at types.Time) error {
+		if err := cdao.Delete(&server.ServiceMeta{Uuid: service.Uuid, Revision: service.Revision, DeletedAt: &at}); err != nil {
+			return err
+		}
+		return audit.Record(ctx, uow.Tx, logger, audit.Deleted(kind, tenant.Uuid, service.Uuid, &service))
+	})
+	if err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+	if cascade {
+		if serr := server.SetHeader(ctx, server.ImpactKey, server.FormatCounts(counts)); serr != nil {
+			logger.Warn("SetHeader err", zap.String("error", serr.Error()))
+		}
+	}
 
 	return server.OkResp(&DResp{resp})
 }
@@ -228,18 +311,48 @@ func (imp *ServiceImp) Update(ctx context.Context, req *pb.UpdateRequest) (resp
 
 	var newservice server.ServiceMeta
 	service = services[0]
+	before := service
+	if err = server.CheckRevision(ctx, service.Revision); err != nil {
+		return server.StatusResp(&UResp{resp}, err)
+	}
+
 	newservice.Name = req.Name
 	newservice.Describe = req.Describe
 
-	if !util.UpdateValueSame(&newservice, &service) {
+	var isupdate bool
+	isupdate, err = server.MergeUpdate(ctx, req, &newservice, &service, "name", "describe")
+	if err != nil {
+		return server.ParamterResp(&UResp{resp}, err.Error())
+	}
+	if !isupdate {
 		return server.ParamterResp(&UResp{resp}, "没有需要修改的内容")
 	}
+	if service.Name == "" {
+		return server.ParamterResp(&UResp{resp}, "name 不能为空")
+	}
+	if util.StrPunctIllegal(service.Name, '-') {
+		return server.ParamterResp(&UResp{resp}, "name 不能含有非'-'的字符")
+	}
 
 	service.UpdateTime = types.Time(time.Now())
-	_, err = dao.Update(&service)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&UResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	cdao := server.NewCacheDao(&ServicePgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	if service, err = cdao.Update(&service); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Updated(kind, tenant.Uuid, service.Uuid, &before, &service)); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, service.Uuid, service.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ := service.ToPbMeta()
 	resp.Service = &pbmeta
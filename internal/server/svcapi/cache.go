@@ -0,0 +1,22 @@
+package svcapi
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/config"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// 按 uuid 缓存 svcapi, CheckByMeta 读取, 修改和删除时失效
+func Cache(logger *zap.Logger) *server.Cache[server.SvcapiMeta] {
+	return &server.Cache[server.SvcapiMeta]{
+		R:       storage.ReadRedis,
+		W:       storage.WriteRedis,
+		Name:    kind,
+		TTL:     config.AppConfig.Cache.TTL,
+		MissTTL: config.AppConfig.Cache.MissTTL,
+		Local:   config.AppConfig.Cache.Local,
+		Logger:  logger,
+	}
+}
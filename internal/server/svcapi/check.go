@@ -19,21 +19,22 @@ func CheckByMeta(ctx context.Context, svcid, uuid int) (svcapi server.SvcapiMeta
 
 	dao := SvcapiPgDao{
 		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		R:      storage.WriteDB,
 		Logger: logger,
 	}
 
-	var svcapis []server.SvcapiMeta
-	svcapis, err = dao.Select(&server.SvcapiMeta{Uuid: uuid, ServiceId: svcid})
+	// 读主库, 从库的旧数据会在删除缓存后写回. 缓存不区分 service, 读取后再检查
+	var found bool
+	svcapi, found, err = Cache(logger).Load(uuid, func() ([]server.SvcapiMeta, error) {
+		return dao.Select(&server.SvcapiMeta{Uuid: uuid})
+	})
 	if err != nil {
-		return svcapi, server.InternalErr(err.Error())
+		return svcapi, server.SqlErr(err)
 	}
 
-	if len(svcapis) == 0 {
-		return svcapi, server.NotFoundErr(fmt.Sprintf("svcapi: %d not found", uuid))
+	if !found || svcapi.ServiceId != svcid {
+		return server.SvcapiMeta{}, server.NotFoundErr(fmt.Sprintf("svcapi: %d not found", uuid))
 	}
 
-	svcapi = svcapis[0]
-
 	return svcapi, nil
 }
@@ -0,0 +1,14 @@
+package svcapi
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/server"
+)
+
+// 引用 svcapi 的表, 按删除顺序排列
+func Dependents() []server.Dependent {
+	return []server.Dependent{
+		{Table: "svc_api_example", Kind: "svcapieg", Cond: func(aid int) server.Cond {
+			return server.Eq("aid", aid)
+		}},
+	}
+}
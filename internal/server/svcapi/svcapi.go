@@ -8,11 +8,12 @@ import (
 	pb "github.com/crt379/svc-collector-grpc-proto/svcapi"
 	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
 	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
 	svrsvc "github.com/crt379/svc-collector-grpc/internal/server/service"
 	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
 	"github.com/crt379/svc-collector-grpc/internal/storage"
 	"github.com/crt379/svc-collector-grpc/internal/types"
-	"github.com/crt379/svc-collector-grpc/internal/util"
+	"go.uber.org/zap"
 )
 
 type SvcapiImp struct {
@@ -81,10 +82,32 @@ func (imp *SvcapiImp) Create(ctx context.Context, req *pb.CreateRequest) (resp *
 	}
 	svcapi.UpdateTime = svcapi.CreateTime
 
-	svcapi.Uuid, err = dao.Insert(&svcapi)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	// tenant 和 service 在创建提交前不能被删除
+	if err = server.LockAlive(uow.Tx, logger, "tenant", service.TenantId, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if err = server.LockAlive(uow.Tx, logger, "service", service.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	cdao := server.NewCacheDao(&SvcapiPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	if svcapi.Uuid, err = cdao.Insert(&svcapi); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	svcapi.Revision = server.InitRevision
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Created(kind, svcapi.TenantId, svcapi.Uuid, &svcapi)); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, svcapi.Uuid, svcapi.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ = svcapi.ToPbMeta()
 	resp.Svcapi = &pbmeta
@@ -115,11 +138,24 @@ func (imp *SvcapiImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 		Logger: logger,
 	}
 
+	if dao.ShowDeleted, err = server.BoolFromMeta(ctx, server.ShowDeletedKey); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+	if dao.AsOf, err = server.AsOfFromMeta(ctx); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	svcapi.Uuid = int(req.Uuid)
 	svcapi.Path = req.Path
 	svcapi.Method = req.Method
 	svcapi.ServiceId = service.Uuid
 
+	var keyset *server.KeysetOption
+	keyset, err = server.KeysetFromMeta[server.SvcapiMeta](ctx, "")
+	if err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	total, err = dao.Count(&svcapi)
 	if err != nil {
 		return server.SqlErrResp(&GResp{resp}, err)
@@ -134,15 +170,31 @@ func (imp *SvcapiImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 		if req.Limit > 0 {
 			resp.Limit = req.Limit
 		}
-		var limitoption *server.LimitOption
-		if int(resp.Limit) < total {
-			limitoption = server.NewLimitOption(int(resp.Page), int(resp.Limit), "row_number")
+		var option server.DaoOption
+		if keyset != nil {
+			keyset.Limit = int(resp.Limit)
+			option = keyset
+		} else if int(resp.Limit) < total {
+			option = server.NewLimitOption(int(resp.Page), int(resp.Limit))
 		}
 
-		svcapis, err = dao.Select(&svcapi, limitoption)
+		svcapis, err = dao.Select(&svcapi, option)
 		if err != nil {
 			return server.SqlErrResp(&GResp{resp}, err)
 		}
+
+		var next string
+		svcapis, next = server.KeysetPage(keyset, svcapis)
+		if serr := server.SetNextPageToken(ctx, next); serr != nil {
+			logger.Warn("SetNextPageToken err", zap.String("error", serr.Error()))
+		}
+	}
+
+	if serr := server.SetRevisions(ctx, svcapis); serr != nil {
+		logger.Warn("SetRevisions err", zap.String("error", serr.Error()))
+	}
+	if serr := server.SetDeleted(ctx, svcapis); serr != nil {
+		logger.Warn("SetDeleted err", zap.String("error", serr.Error()))
 	}
 
 	resp.Count, resp.Svcapis, _ = server.Metas2Pbmeta[server.SvcapiMeta, pb.SvcapiMeta](&svcapis)
@@ -155,7 +207,7 @@ func (imp *SvcapiImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *
 	var (
 		service server.ServiceMeta
 		svcapi  server.SvcapiMeta
-		total   int
+		svcapis []server.SvcapiMeta
 	)
 
 	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
@@ -181,18 +233,52 @@ func (imp *SvcapiImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *
 	svcapi.Uuid = int(req.Uuid)
 	svcapi.ServiceId = service.Uuid
 
-	total, err = dao.Count(&svcapi)
+	svcapis, err = dao.Select(&svcapi)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
-	if total == 0 {
+
+	if len(svcapis) == 0 {
 		return server.NotFoundResp(&DResp{resp}, fmt.Sprintf("svcapi: %d 不存在", req.Uuid))
 	}
 
-	err = dao.Delete(&svcapi)
+	svcapi = svcapis[0]
+	if err = server.CheckRevision(ctx, svcapi.Revision); err != nil {
+		return server.StatusResp(&DResp{resp}, err)
+	}
+
+	var cascade bool
+	if cascade, err = server.BoolFromMeta(ctx, server.CascadeKey); err != nil {
+		return server.ParamterResp(&DResp{resp}, err.Error())
+	}
+
+	// 默认有引用时拒绝删除, cascade 时在同一个事务中删除引用的数据
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	cdao := server.NewCacheDao(&SvcapiPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	record := audit.Cascaded(audit.SourceFromContext(ctx), logger, svcapi.TenantId, kind, svcapi.Uuid)
+
+	var counts []server.TableCount
+	counts, err = server.DeleteWithDependents(uow, table, Dependents(), svcapi.Uuid, cascade, record, func(at types.Time) error {
+		if err := cdao.Delete(&server.SvcapiMeta{Uuid: svcapi.Uuid, Revision: svcapi.Revision, DeletedAt: &at}); err != nil {
+			return err
+		}
+		return audit.Record(ctx, uow.Tx, logger, audit.Deleted(kind, svcapi.TenantId, svcapi.Uuid, &svcapi))
+	})
+	if err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+	if cascade {
+		if serr := server.SetHeader(ctx, server.ImpactKey, server.FormatCounts(counts)); serr != nil {
+			logger.Warn("SetHeader err", zap.String("error", serr.Error()))
+		}
+	}
 
 	return server.OkResp(&DResp{resp})
 }
@@ -238,19 +324,46 @@ func (imp *SvcapiImp) Update(ctx context.Context, req *pb.UpdateRequest) (resp *
 	}
 
 	svcapi = svcapis[0]
+	before := svcapi
+	if err = server.CheckRevision(ctx, svcapi.Revision); err != nil {
+		return server.StatusResp(&UResp{resp}, err)
+	}
+
 	newsvcapi.Path = req.Path
 	newsvcapi.Method = req.Method
 	newsvcapi.Describe = req.Describe
 
-	if !util.UpdateValueSame(&newsvcapi, &svcapi) {
+	var isupdate bool
+	isupdate, err = server.MergeUpdate(ctx, req, &newsvcapi, &svcapi, "path", "method", "describe")
+	if err != nil {
+		return server.ParamterResp(&UResp{resp}, err.Error())
+	}
+	if !isupdate {
 		return server.ParamterResp(&UResp{resp}, "没有需要修改的内容")
 	}
+	if svcapi.Path == "" || svcapi.Method == "" {
+		return server.ParamterResp(&UResp{resp}, "path 和 method 不能为空")
+	}
 
 	svcapi.UpdateTime = types.Time(time.Now())
-	_, err = dao.Update(&svcapi)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&UResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	cdao := server.NewCacheDao(&SvcapiPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}, Cache(logger))
+	uow.AfterCommit(cdao.Evict)
+	if svcapi, err = cdao.Update(&svcapi); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Updated(kind, svcapi.TenantId, svcapi.Uuid, &before, &svcapi)); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, svcapi.Uuid, svcapi.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ := svcapi.ToPbMeta()
 	resp.Svcapi = &pbmeta
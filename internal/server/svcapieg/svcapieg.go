@@ -2,8 +2,6 @@ package svcapieg
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -11,6 +9,7 @@ import (
 	pb "github.com/crt379/svc-collector-grpc-proto/svcapieg"
 	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
 	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
 	svrjdata "github.com/crt379/svc-collector-grpc/internal/server/jdata"
 	svrsvc "github.com/crt379/svc-collector-grpc/internal/server/service"
 	svrsvcapi "github.com/crt379/svc-collector-grpc/internal/server/svcapi"
@@ -59,9 +58,25 @@ func (imp *SvcapiegImp) Create(ctx context.Context, req *pb.CreateRequest) (resp
 	}
 
 	resp = new(pb.CreateReply)
+
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
+	if err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	defer uow.End(&err)
+
+	// tenant 和 svcapi 在创建提交前不能被删除
+	if err = server.LockAlive(uow.Tx, logger, "tenant", svcapi.TenantId, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if err = server.LockAlive(uow.Tx, logger, "service_api", svcapi.Uuid, "SHARE"); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+
 	dao := SvcapiegPgDao{
-		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		W:      uow.Tx,
+		R:      uow.Tx,
 		Logger: logger,
 	}
 
@@ -70,56 +85,50 @@ func (imp *SvcapiegImp) Create(ctx context.Context, req *pb.CreateRequest) (resp
 	var bodyjson any
 	err = json.Unmarshal([]byte(req.Data), &bodyjson)
 	if err != nil {
-		return server.InternalResp(&CResp{resp}, err)
+		return server.ParamterResp(&CResp{resp}, "data 不是合法的 json")
 	}
 	logger.Debug("req data json", zap.Any("body", bodyjson))
 
-	var bodyjsonbytes []byte
-	bodyjsonbytes, err = json.Marshal(bodyjson)
+	var canonical []byte
+	canonical, err = svrjdata.Canonical([]byte(req.Data))
 	if err != nil {
-		return server.InternalResp(&CResp{resp}, err)
+		return server.ParamterResp(&CResp{resp}, "data 不是合法的 json")
 	}
 
 	var (
-		jdata    server.Jdata
-		jdatas   []server.Jdata
-		hashtype string = "md5"
+		jdata     server.Jdata
+		hashtype  string = svrjdata.HashType()
+		hashvalue string
 	)
 	jdata_dao := svrjdata.JdataPgDao{
-		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		W:      uow.Tx,
+		R:      uow.Tx,
 		Logger: logger,
 	}
 
-	datajsonmd5 := md5.Sum(bodyjsonbytes)
-	datajsonmd5str := hex.EncodeToString(datajsonmd5[:])
-	logger.Info("req data json md5", zap.String(hashtype, datajsonmd5str))
+	hashvalue, err = svrjdata.Hash(hashtype, canonical)
+	if err != nil {
+		return server.InternalResp(&CResp{resp}, err)
+	}
+	logger.Info("req data json hash", zap.String(hashtype, hashvalue))
 
-	jdatas, err = jdata_dao.Select(&server.Jdata{HashType: hashtype, HashValue: datajsonmd5str})
+	// 已经存在时返回已有的 uuid, 并锁住该行到事务结束, Sweeper 不会在引用写入前删除
+	jdata.Data = string(canonical)
+	jdata.CreateTime = types.Time(time.Now())
+	jdata.UpdateTime = jdata.CreateTime
+	jdata.HashType = hashtype
+	jdata.HashValue = hashvalue
+	jdata.Uuid, err = jdata_dao.Insert(&jdata)
 	if err != nil {
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
 
-	if len(jdatas) == 0 {
-		jdata.Data = bodyjson
-		jdata.CreateTime = types.Time(time.Now())
-		jdata.UpdateTime = jdata.CreateTime
-		jdata.HashType = hashtype
-		jdata.HashValue = datajsonmd5str
-		jdata.Uuid, err = jdata_dao.Insert(&jdata)
-		if err != nil {
-			return server.SqlErrResp(&CResp{resp}, err)
-		}
-	} else {
-		jdata = jdatas[0]
-		egs, err = dao.Select(&server.SvcapiegMeta{JdataId: jdata.Uuid, SvcapiId: svcapi.Uuid})
-		if err != nil {
-			return server.SqlErrResp(&CResp{resp}, err)
-		}
-
-		if len(egs) > 0 {
-			return server.AlreadyExistsResp(&CResp{resp}, "已有相同的 svcapieg")
-		}
+	egs, err = dao.Select(&server.SvcapiegMeta{JdataId: jdata.Uuid, SvcapiId: svcapi.Uuid})
+	if err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if len(egs) > 0 {
+		return server.AlreadyExistsResp(&CResp{resp}, "已有相同的 svcapieg")
 	}
 
 	eg.Data = bodyjson
@@ -134,6 +143,15 @@ func (imp *SvcapiegImp) Create(ctx context.Context, req *pb.CreateRequest) (resp
 	if err != nil {
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
+	eg.Revision = server.InitRevision
+
+	err = audit.Record(ctx, uow.Tx, logger, audit.Created(kind, eg.TenantId, eg.Uuid, &eg))
+	if err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, eg.Uuid, eg.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, err = eg.ToPbMeta()
 	if err != nil {
@@ -168,9 +186,22 @@ func (imp *SvcapiegImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.G
 		Logger: logger,
 	}
 
+	if dao.ShowDeleted, err = server.BoolFromMeta(ctx, server.ShowDeletedKey); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+	if dao.AsOf, err = server.AsOfFromMeta(ctx); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	eg.Uuid = int(req.Uuid)
 	eg.SvcapiId = int(svcapi.Uuid)
 
+	var keyset *server.KeysetOption
+	keyset, err = server.KeysetFromMeta[server.SvcapiegMeta](ctx, dao.Table())
+	if err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
 	total, err = dao.Count(&eg)
 	if err != nil {
 		return server.SqlErrResp(&GResp{resp}, err)
@@ -185,15 +216,31 @@ func (imp *SvcapiegImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.G
 		if req.Limit > 0 {
 			resp.Limit = req.Limit
 		}
-		var limitoption *server.LimitOption
-		if int(resp.Limit) < total {
-			limitoption = server.NewLimitOption(int(resp.Page), int(resp.Limit), "row_number")
+		var option server.DaoOption
+		if keyset != nil {
+			keyset.Limit = int(resp.Limit)
+			option = keyset
+		} else if int(resp.Limit) < total {
+			option = server.NewLimitOption(int(resp.Page), int(resp.Limit))
 		}
 
-		egs, err = dao.SelectAndJdata(&eg, limitoption)
+		egs, err = dao.SelectAndJdata(&eg, option)
 		if err != nil {
 			return server.SqlErrResp(&GResp{resp}, err)
 		}
+
+		var next string
+		egs, next = server.KeysetPage(keyset, egs)
+		if serr := server.SetNextPageToken(ctx, next); serr != nil {
+			logger.Warn("SetNextPageToken err", zap.String("error", serr.Error()))
+		}
+	}
+
+	if serr := server.SetRevisions(ctx, egs); serr != nil {
+		logger.Warn("SetRevisions err", zap.String("error", serr.Error()))
+	}
+	if serr := server.SetDeleted(ctx, egs); serr != nil {
+		logger.Warn("SetDeleted err", zap.String("error", serr.Error()))
 	}
 
 	resp.Count, resp.Svcapiegs, err = server.Metas2Pbmeta[server.SvcapiegMeta, pb.SvcapiegMeta](&egs)
@@ -209,7 +256,7 @@ func (imp *SvcapiegImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp
 	var (
 		svcapi server.SvcapiMeta
 		eg     server.SvcapiegMeta
-		total  int
+		egs    []server.SvcapiegMeta
 	)
 
 	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
@@ -226,24 +273,41 @@ func (imp *SvcapiegImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp
 		return server.NotFoundResp(&DResp{resp}, fmt.Sprintf("svcapieg: %d 不存在", req.Uuid))
 	}
 
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
+	if err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+	defer uow.End(&err)
+
 	dao := SvcapiegPgDao{
-		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		W:      uow.Tx,
+		R:      uow.Tx,
 		Logger: logger,
 	}
 
 	eg.Uuid = int(req.Uuid)
 	eg.SvcapiId = int(svcapi.Uuid)
 
-	total, err = dao.Count(&eg)
+	egs, err = dao.Select(&eg)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
-	if total == 0 {
+	if len(egs) == 0 {
 		return server.NotFoundResp(&DResp{resp}, fmt.Sprintf("svcapieg: %d 不存在", req.Uuid))
 	}
+	eg = egs[0]
+	if err = server.CheckRevision(ctx, eg.Revision); err != nil {
+		return server.StatusResp(&DResp{resp}, err)
+	}
+
+	// 删除后仍然引用 jdata, jdata 在清理后由 jdata.Sweeper 删除
+	err = dao.Delete(&server.SvcapiegMeta{Uuid: eg.Uuid, Revision: eg.Revision})
+	if err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
 
-	err = dao.Delete(&eg)
+	err = audit.Record(ctx, uow.Tx, logger, audit.Deleted(kind, eg.TenantId, eg.Uuid, &eg))
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
@@ -259,7 +323,7 @@ func (imp *SvcapiegImp) Update(ctx context.Context, req *pb.UpdateRequest) (resp
 	)
 
 	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
-	logger.Info("SvcapiegImp Delete")
+	logger.Info("SvcapiegImp Update")
 
 	_, _, svcapi, err = imp.pre(ctx, int(req.ServiceId), int(req.SvcapiId))
 	if err != nil {
@@ -272,9 +336,16 @@ func (imp *SvcapiegImp) Update(ctx context.Context, req *pb.UpdateRequest) (resp
 		return server.NotFoundResp(&UResp{resp}, fmt.Sprintf("svcapieg: %d 不存在", req.Uuid))
 	}
 
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
+	if err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	defer uow.End(&err)
+
 	dao := SvcapiegPgDao{
-		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		W:      uow.Tx,
+		R:      uow.Tx,
 		Logger: logger,
 	}
 
@@ -289,85 +360,103 @@ func (imp *SvcapiegImp) Update(ctx context.Context, req *pb.UpdateRequest) (resp
 		return server.NotFoundResp(&UResp{resp}, fmt.Sprintf("svcapieg: %d 不存在", req.Uuid))
 	}
 	eg = egs[0]
+	if err = server.CheckRevision(ctx, eg.Revision); err != nil {
+		return server.StatusResp(&UResp{resp}, err)
+	}
+	before := eg
 
 	logger.Debug("req data", zap.Any("body", req.Data))
 
 	var bodyjson any
 	err = json.Unmarshal([]byte(req.Data), &bodyjson)
 	if err != nil {
-		return server.InternalResp(&UResp{resp}, err)
+		return server.ParamterResp(&UResp{resp}, "data 不是合法的 json")
 	}
 	logger.Debug("req data json", zap.Any("body", bodyjson))
 
-	var bodyjsonbytes []byte
-	bodyjsonbytes, err = json.Marshal(bodyjson)
+	var canonical []byte
+	canonical, err = svrjdata.Canonical([]byte(req.Data))
 	if err != nil {
-		return server.InternalResp(&UResp{resp}, err)
+		return server.ParamterResp(&UResp{resp}, "data 不是合法的 json")
 	}
 
 	var (
-		jdata    server.Jdata
-		jdatas   []server.Jdata
-		hashtype string = "md5"
+		jdata     server.Jdata
+		hashtype  string = svrjdata.HashType()
+		hashvalue string
 	)
 	jdata_dao := svrjdata.JdataPgDao{
-		W:      storage.WriteDB,
-		R:      storage.ReadDB,
+		W:      uow.Tx,
+		R:      uow.Tx,
 		Logger: logger,
 	}
 
-	datajsonmd5 := md5.Sum(bodyjsonbytes)
-	datajsonmd5str := hex.EncodeToString(datajsonmd5[:])
-	logger.Info("req data json md5", zap.String(hashtype, datajsonmd5str))
-
-	jdatas, err = jdata_dao.Select(&server.Jdata{HashType: hashtype, HashValue: datajsonmd5str})
+	hashvalue, err = svrjdata.Hash(hashtype, canonical)
 	if err != nil {
-		return server.SqlErrResp(&UResp{resp}, err)
+		return server.InternalResp(&UResp{resp}, err)
 	}
+	logger.Info("req data json hash", zap.String(hashtype, hashvalue))
 
 	var (
 		pbmeta pb.SvcapiegMeta
 		total  int
 	)
 
-	if len(jdatas) == 0 {
-		// todo: 如果原 jdata 没有关联 eg 了则可以 1.修改原jdata的value 2.删除原jdata，关联新jdata
-		jdata.Data = bodyjson
-		jdata.CreateTime = types.Time(time.Now())
-		jdata.UpdateTime = jdata.CreateTime
-		jdata.HashType = hashtype
-		jdata.HashValue = datajsonmd5str
-		jdata.Uuid, err = jdata_dao.Insert(&jdata)
-		if err != nil {
-			return server.SqlErrResp(&UResp{resp}, err)
-		}
-	} else {
-		jdata = jdatas[0]
-		if jdata.Uuid == eg.JdataId {
-			eg.Data = bodyjson
-			pbmeta, err = eg.ToPbMeta()
-			if err != nil {
-				return server.InternalResp(&UResp{resp}, err)
-			}
-			resp.Svcapieg = &pbmeta
-
-			return server.OkResp(&UResp{resp})
-		}
+	// 已经存在时返回已有的 uuid, 并锁住该行到事务结束, Sweeper 不会在引用写入前删除
+	jdata.Data = string(canonical)
+	jdata.CreateTime = types.Time(time.Now())
+	jdata.UpdateTime = jdata.CreateTime
+	jdata.HashType = hashtype
+	jdata.HashValue = hashvalue
+	jdata.Uuid, err = jdata_dao.Insert(&jdata)
+	if err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
 
-		total, err = dao.Count(&server.SvcapiegMeta{SvcapiId: svcapi.Uuid, JdataId: jdata.Uuid})
+	if jdata.Uuid == eg.JdataId {
+		eg.Data = bodyjson
+		pbmeta, err = eg.ToPbMeta()
 		if err != nil {
-			return server.SqlErrResp(&UResp{resp}, err)
+			return server.InternalResp(&UResp{resp}, err)
 		}
-		if total > 0 {
-			return server.AlreadyExistsResp(&UResp{resp}, "已有相同的 svcapieg")
+		resp.Svcapieg = &pbmeta
+		if serr := server.SetRevision(ctx, eg.Uuid, eg.Revision); serr != nil {
+			logger.Warn("SetRevision err", zap.String("error", serr.Error()))
 		}
+
+		return server.OkResp(&UResp{resp})
+	}
+
+	total, err = dao.Count(&server.SvcapiegMeta{SvcapiId: svcapi.Uuid, JdataId: jdata.Uuid})
+	if err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	if total > 0 {
+		return server.AlreadyExistsResp(&UResp{resp}, "已有相同的 svcapieg")
 	}
 
 	eg.Data = bodyjson
 	eg.UpdateTime = types.Time(time.Now())
+	oldjid := eg.JdataId
 	eg.JdataId = jdata.Uuid
 
-	_, err = dao.Update(&eg)
+	var updated server.SvcapiegMeta
+	updated, err = dao.Update(&eg)
+	if err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	eg.Revision = updated.Revision
+	if serr := server.SetRevision(ctx, eg.Uuid, eg.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
+
+	err = audit.Record(ctx, uow.Tx, logger, audit.Updated(kind, eg.TenantId, eg.Uuid, &before, &eg))
+	if err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+
+	// 原 jdata 没有被引用了则删除
+	_, err = jdata_dao.DeleteIfOrphan(oldjid)
 	if err != nil {
 		return server.SqlErrResp(&UResp{resp}, err)
 	}
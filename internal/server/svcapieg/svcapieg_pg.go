@@ -1,8 +1,9 @@
 package svcapieg
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/crt379/svc-collector-grpc/internal/server"
 	"github.com/crt379/svc-collector-grpc/internal/server/jdata"
@@ -15,17 +16,17 @@ var _ server.IDao[server.SvcapiegMeta] = (*SvcapiegPgDao)(nil)
 
 const (
 	table = "svc_api_example"
+	// 审计记录中的资源类型
+	kind = "svcapieg"
 )
 
 var (
-	_fields   = [...]string{"uuid", "create_time", "update_time", "aid", "tenant_id", "jid"}
-	_fields_0 = strings.Join(_fields[:], ",")
-	_fields_1 = strings.Join(_fields[1:], ",")
+	_fields = [...]string{"uuid", "create_time", "update_time", "aid", "tenant_id", "jid", "revision", "deleted_at"}
 )
 
 type SvcapiegPgDao struct {
-	W      *sqlx.DB
-	R      *sqlx.DB
+	W      server.DB
+	R      server.DB
 	Logger *zap.Logger
 	server.Dao
 	server.DaoLog
@@ -35,20 +36,12 @@ func (d *SvcapiegPgDao) Table() string {
 	return table
 }
 
-func (d *SvcapiegPgDao) fieldsStr(s int) string {
-	switch s {
-	case 0:
-		return _fields_0
-	case 1:
-		return _fields_1
-	}
-	return strings.Join(_fields[s:], ",")
-}
-
 func (d *SvcapiegPgDao) Insert(meta *server.SvcapiegMeta) (uuid int, err error) {
-	args := []any{meta.CreateTime, meta.UpdateTime, meta.SvcapiId, meta.TenantId, meta.JdataId}
-
-	query := d.InsertSQL(d.Table(), d.fieldsStr(1), len(args), "uuid")
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:]...).
+		Values(meta.CreateTime, meta.UpdateTime, meta.SvcapiId, meta.TenantId, meta.JdataId, server.InitRevision, meta.DeletedAt).
+		Returning("uuid").
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).Scan(&uuid)
@@ -56,35 +49,34 @@ func (d *SvcapiegPgDao) Insert(meta *server.SvcapiegMeta) (uuid int, err error)
 	return uuid, err
 }
 
-func (d *SvcapiegPgDao) Select(meta *server.SvcapiegMeta, ops ...server.DaoOption) (objs []server.SvcapiegMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+func (d *SvcapiegPgDao) conditions(meta *server.SvcapiegMeta) []server.Cond {
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq(d.Field(d.Table(), "uuid"), meta.Uuid))
 	}
 	if meta.SvcapiId != 0 {
-		k = append(k, "aid")
-		args = append(args, meta.SvcapiId)
+		cs = append(cs, server.Eq(d.Field(d.Table(), "aid"), meta.SvcapiId))
 	}
 	if meta.TenantId != 0 {
-		k = append(k, "tenant_id")
-		args = append(args, meta.TenantId)
+		cs = append(cs, server.Eq(d.Field(d.Table(), "tenant_id"), meta.TenantId))
 	}
 	if meta.JdataId != 0 {
-		k = append(k, "jid")
-		args = append(args, meta.JdataId)
+		cs = append(cs, server.Eq(d.Field(d.Table(), "jid"), meta.JdataId))
 	}
 
-	optconditions := make([]string, 0)
-	for _, op := range ops {
-		optconditions = append(optconditions, op.Conditions()...)
-	}
+	return cs
+}
 
-	query := d.SelectAddRowNumberSQL(d.Table(), d.fieldsStr(0), "uuid", k)
-	query = d.WithSQL("t", query)
-	query = d.SelectSQL(query, "t", d.fieldsStr(0), nil, optconditions...)
+func (d *SvcapiegPgDao) Select(meta *server.SvcapiegMeta, ops ...server.DaoOption) (objs []server.SvcapiegMeta, err error) {
+	query, args := server.Select(_fields[:]...).
+		From(d.Table()).
+		Where(d.conditions(meta)...).
+		Where(d.Alive(d.Table())...).
+		OrderBy("uuid").
+		Options(d.Snapshot(d.Table())).
+		Options(ops...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -98,35 +90,17 @@ func (d *SvcapiegPgDao) Select(meta *server.SvcapiegMeta, ops ...server.DaoOptio
 }
 
 func (d *SvcapiegPgDao) SelectAndJdata(meta *server.SvcapiegMeta, ops ...server.DaoOption) (objs []server.SvcapiegMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-
-	if meta.Uuid != 0 {
-		k = append(k, d.Field(d.Table(), "uuid"))
-		args = append(args, meta.Uuid)
-	}
-	if meta.SvcapiId != 0 {
-		k = append(k, d.Field(d.Table(), "aid"))
-		args = append(args, meta.SvcapiId)
-	}
-	if meta.TenantId != 0 {
-		k = append(k, d.Field(d.Table(), "tenant_id"))
-		args = append(args, meta.TenantId)
-	}
-	if meta.JdataId != 0 {
-		k = append(k, d.Field(d.Table(), "jid"))
-		args = append(args, meta.JdataId)
-	}
-
 	jdao := jdata.JdataPgDao{}
 
-	query := d.SelectSQL(
-		"",
-		d.Comma(d.Table(), jdao.Table()),
-		fields(),
-		k,
-		d.Equal(d.Field(d.Table(), "jid"), d.Field(jdao.Table(), "uuid")),
-	)
+	query, args := server.Select(fields()).
+		From(d.Table()).
+		Join(jdao.Table(), server.EqCol(d.Field(d.Table(), "jid"), d.Field(jdao.Table(), "uuid"))).
+		Where(d.conditions(meta)...).
+		Where(d.Alive(d.Table())...).
+		OrderBy(d.Field(d.Table(), "uuid")).
+		Options(d.Snapshot(d.Table())).
+		Options(ops...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -140,27 +114,7 @@ func (d *SvcapiegPgDao) SelectAndJdata(meta *server.SvcapiegMeta, ops ...server.
 }
 
 func (d *SvcapiegPgDao) Count(meta *server.SvcapiegMeta) (count int, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-
-	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
-	}
-	if meta.SvcapiId != 0 {
-		k = append(k, "aid")
-		args = append(args, meta.SvcapiId)
-	}
-	if meta.TenantId != 0 {
-		k = append(k, "tenant_id")
-		args = append(args, meta.TenantId)
-	}
-	if meta.JdataId != 0 {
-		k = append(k, "jid")
-		args = append(args, meta.JdataId)
-	}
-
-	query := d.SelectSQL("", d.Table(), "count(*)", k)
+	query, args := server.Select("count(*)").From(d.Table()).Where(d.conditions(meta)...).Where(d.Alive(d.Table())...).Options(d.Snapshot(d.Table())).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.R.QueryRowx(query, args...).Scan(&count)
@@ -169,68 +123,68 @@ func (d *SvcapiegPgDao) Count(meta *server.SvcapiegMeta) (count int, err error)
 }
 
 func (d *SvcapiegPgDao) Delete(meta *server.SvcapiegMeta) (err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-
-	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
-	}
-	if meta.SvcapiId != 0 {
-		k = append(k, "aid")
-		args = append(args, meta.SvcapiId)
-	}
-	if meta.TenantId != 0 {
-		k = append(k, "tenant_id")
-		args = append(args, meta.TenantId)
-	}
-	if meta.JdataId != 0 {
-		k = append(k, "jid")
-		args = append(args, meta.JdataId)
-	}
-	if len(k) == 0 {
+	cs := d.conditions(meta)
+	if len(cs) == 0 {
 		return nil
 	}
+	if meta.Revision != 0 {
+		cs = append(cs, server.Eq("revision", meta.Revision))
+	}
 
-	query := d.DeleteSQL(d.Table(), k)
+	cs = append(cs, server.IsNull(server.DeletedAtCol))
+
+	query, args := server.Update(d.Table()).
+		Set(server.DeletedAtCol, server.DeleteTime(meta.DeletedAt)).
+		Where(cs...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
-	_, err = d.W.Exec(query, args...)
+	var result sql.Result
+	result, err = d.W.Exec(query, args...)
+	if err != nil || meta.Revision == 0 {
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		err = server.StaleErr(d.W, d.Table(), meta.Uuid)
+	}
 
 	return
 }
 
 func (d *SvcapiegPgDao) Update(meta *server.SvcapiegMeta) (obj server.SvcapiegMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-
 	if meta.Uuid == 0 {
 		return obj, fmt.Errorf("uuid is 0")
 	}
+
+	b := server.Update(d.Table())
 	if meta.SvcapiId != 0 {
-		k = append(k, "aid")
-		args = append(args, meta.SvcapiId)
+		b.Set("aid", meta.SvcapiId)
 	}
 	if meta.TenantId != 0 {
-		k = append(k, "tenant_id")
-		args = append(args, meta.TenantId)
+		b.Set("tenant_id", meta.TenantId)
 	}
 	if meta.JdataId != 0 {
-		k = append(k, "jid")
-		args = append(args, meta.JdataId)
+		b.Set("jid", meta.JdataId)
 	}
 
 	var zerotime types.Time
 	if meta.UpdateTime != zerotime {
-		k = append(k, "update_time")
-		args = append(args, meta.UpdateTime)
+		b.Set("update_time", meta.UpdateTime)
 	}
+	b.Incr("revision", 1)
 
-	args = append(args, meta.Uuid)
-	query := d.UpdateSQL(d.Table(), k, d.fieldsStr(0), []string{"uuid"})
+	cs := []server.Cond{server.Eq("uuid", meta.Uuid), server.IsNull(server.DeletedAtCol)}
+	if meta.Revision != 0 {
+		cs = append(cs, server.Eq("revision", meta.Revision))
+	}
+
+	query, args := b.Where(cs...).Returning(_fields[:]...).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).StructScan(&obj)
+	if errors.Is(err, sql.ErrNoRows) && meta.Revision != 0 {
+		err = server.StaleErr(d.W, d.Table(), meta.Uuid)
+	}
 
 	return obj, err
 }
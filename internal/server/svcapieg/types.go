@@ -85,6 +85,8 @@ func fields() string {
 			d.Field(d.Table(), "aid"),
 			d.Field(d.Table(), "tenant_id"),
 			d.Field(d.Table(), "jid"),
+			d.Field(d.Table(), "revision"),
+			d.Field(d.Table(), "deleted_at"),
 		}
 		_svcapi_fields = strings.Join(fs, ", ")
 	}
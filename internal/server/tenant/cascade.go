@@ -0,0 +1,108 @@
+package tenant
+
+import (
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"go.uber.org/zap"
+)
+
+func tenantIdCond(tenantid int) server.Cond {
+	return server.Eq("tenant_id", tenantid)
+}
+
+// 属于 tenant 的表, 按删除顺序排列
+func Dependents() []server.Dependent {
+	return []server.Dependent{
+		{Table: "processor", Kind: "processor", Cond: tenantIdCond},
+		{Table: "app_svc_relation", Kind: "appsvc", Cond: func(tenantid int) server.Cond {
+			return server.Or(
+				server.InQuery("aid", server.Select("uuid").From("application").Where(tenantIdCond(tenantid))),
+				server.InQuery("sid", server.Select("uuid").From("service").Where(tenantIdCond(tenantid))),
+			)
+		}},
+		{Table: "svc_api_example", Kind: "svcapieg", Cond: tenantIdCond},
+		{Table: "service_api", Kind: "svcapi", Cond: tenantIdCond, Cache: "svcapi"},
+		{Table: "service", Kind: "service", Cond: tenantIdCond, Cache: "service"},
+		{Table: "application", Kind: "application", Cond: tenantIdCond, Cache: "application"},
+	}
+}
+
+// 级联删除 tenant 及其依赖的数据, DB 为事务时所有删除在同一个事务中, 提交后调用 Evict
+type Cascade struct {
+	DB     server.DB
+	Logger *zap.Logger
+	// 记录删除的依赖数据, 为空时不记录
+	Record server.CascadeRecorder
+	server.DaoLog
+
+	deps *server.Dependents
+}
+
+func (c *Cascade) dependents() *server.Dependents {
+	if c.deps == nil {
+		c.deps = &server.Dependents{Logger: c.Logger, List: Dependents(), Record: c.Record}
+	}
+	c.deps.DB = c.DB
+	return c.deps
+}
+
+// 删除级联删除的 service, svcapi, application 的缓存, 事务提交后调用
+func (c *Cascade) Evict() {
+	if c.deps != nil {
+		c.deps.Evict()
+	}
+}
+
+// 每个表将要删除的行数, 包括 tenant 本身
+func (c *Cascade) Impact(tenantid int) (counts []server.TableCount, err error) {
+	counts, err = c.dependents().Count(tenantid)
+	if err != nil {
+		return counts, err
+	}
+
+	var n int
+	n, err = c.count(table, server.And(server.Eq("uuid", tenantid), server.IsNull(server.DeletedAtCol)))
+	if err != nil {
+		return counts, err
+	}
+	counts = append(counts, server.TableCount{Table: table, Count: n})
+
+	return counts, nil
+}
+
+func (c *Cascade) count(table string, cond server.Cond) (count int, err error) {
+	query, args := server.Select("count(*)").From(table).Where(cond).ToSQL()
+	c.Debug(c.Logger, query, args...)
+
+	err = c.DB.QueryRowx(query, args...).Scan(&count)
+
+	return count, err
+}
+
+// 在 at 删除依赖的数据和 tenant, tenant.Revision 不为 0 时作为删除条件. c.DB 为事务, 先锁住 tenant
+func (c *Cascade) Delete(tenant *server.TenantMeta, at types.Time) (counts []server.TableCount, err error) {
+	if err = server.LockAlive(c.DB, c.Logger, table, tenant.Uuid, "UPDATE"); err != nil {
+		return counts, err
+	}
+
+	counts, _, err = c.DeleteBatch(tenant.Uuid, 0, at)
+	if err != nil {
+		return counts, err
+	}
+
+	dao := TenantPgDao{W: c.DB, R: c.DB, Logger: c.Logger}
+	err = dao.Delete(&server.TenantMeta{Uuid: tenant.Uuid, Revision: tenant.Revision, DeletedAt: &at})
+	if err != nil {
+		return counts, err
+	}
+	counts = append(counts, server.TableCount{Table: table, Count: 1})
+
+	return counts, nil
+}
+
+// 按顺序删除依赖的数据, 每个表最多删除 limit 行, limit <= 0 时不限制.
+// 返回本次删除的行数, done 表示依赖的数据已经全部删除
+func (c *Cascade) DeleteBatch(tenantid int, limit int, at types.Time) (counts []server.TableCount, done bool, err error) {
+	return c.dependents().Delete(tenantid, limit, at)
+}
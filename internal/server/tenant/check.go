@@ -30,7 +30,7 @@ func CheckByMeta(ctx context.Context) (tenant server.TenantMeta, err error) {
 		Logger: logger,
 	}
 
-	cache := TenantCache{
+	cache := server.TenantCache{
 		R: storage.ReadRedis,
 		W: storage.WriteRedis,
 	}
@@ -45,7 +45,7 @@ func CheckByMeta(ctx context.Context) (tenant server.TenantMeta, err error) {
 	var tenants []server.TenantMeta
 	tenants, err = dao.Select(&server.TenantMeta{Name: tenantname})
 	if err != nil {
-		return tenant, server.InternalErr(err.Error())
+		return tenant, server.SqlErr(err)
 	}
 
 	if len(tenants) == 0 {
@@ -0,0 +1,151 @@
+package tenant
+
+import (
+	"context"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DeleteJobKind = "tenant.delete"
+
+	deleteJobBatch = 500
+)
+
+type deleteProgress struct {
+	Total   []server.TableCount `json:"total"`
+	Deleted []server.TableCount `json:"deleted"`
+}
+
+// 累加每个表的行数, 保持表出现的顺序
+func addCounts(sum []server.TableCount, counts []server.TableCount) []server.TableCount {
+	for _, c := range counts {
+		found := false
+		for i := range sum {
+			if sum[i].Table == c.Table {
+				sum[i].Count += c.Count
+				found = true
+				break
+			}
+		}
+		if !found {
+			sum = append(sum, c)
+		}
+	}
+	return sum
+}
+
+// tenant 是否为 job 删除的, 删除时间为 job 的创建时间
+func deletedBy(tenant *server.TenantMeta, job *server.JobMeta) bool {
+	return tenant.DeletedAt != nil && time.Time(*tenant.DeletedAt).Equal(time.Time(job.CreateTime))
+}
+
+// 后台删除 tenant: 先标记 tenant 已经删除, 之后的请求不能再写入 tenant 的数据;
+// 依赖的数据每批一个事务, 每批锁住 tenant 并确认没有被恢复. tenant 已经不存在或被恢复时直接完成.
+// 删除时间为 job 的创建时间, 重复执行时所有批次的删除时间相同
+func DeleteJob(ctx context.Context, job *server.JobMeta, progress func(v any) error) (err error) {
+	logger := zap.L().With(zap.Int("job", job.Uuid))
+
+	dao := TenantPgDao{
+		W:      storage.WriteDB,
+		R:      storage.WriteDB,
+		Logger: logger,
+	}
+	dao.ShowDeleted = true
+
+	var tenants []server.TenantMeta
+	tenants, err = dao.Select(&server.TenantMeta{Uuid: job.Target})
+	if err != nil || len(tenants) == 0 {
+		return err
+	}
+	tenant := tenants[0]
+	if tenant.DeletedAt != nil && !deletedBy(&tenant, job) {
+		return nil
+	}
+
+	var p deleteProgress
+	c := Cascade{DB: storage.WriteDB, Logger: logger}
+	p.Total, err = c.Impact(tenant.Uuid)
+	if err != nil {
+		return err
+	}
+	if err = progress(&p); err != nil {
+		return err
+	}
+
+	if tenant.DeletedAt == nil {
+		// 等待持有 tenant 共享锁的写入提交
+		if err = dao.Delete(&server.TenantMeta{Uuid: tenant.Uuid, DeletedAt: &job.CreateTime}); err != nil {
+			return err
+		}
+	}
+	cache := server.TenantCache{
+		R: storage.ReadRedis,
+		W: storage.WriteRedis,
+	}
+	if cerr := cache.Evict(tenant.Uuid, tenant.Revision+1, tenant.Name); cerr != nil {
+		logger.Warn("Evict err", zap.String("error", cerr.Error()))
+	}
+	tenant.DeletedAt = nil
+
+	// 操作者和 trace id 为创建 job 的请求的
+	src := audit.Source{Actor: job.Actor, TraceId: job.TraceId}
+	record := audit.Cascaded(src, logger, tenant.Uuid, kind, tenant.Uuid)
+	for done := false; !done; {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		var counts []server.TableCount
+		counts, done, err = deleteBatch(ctx, job, &tenant, src, record, logger)
+		if err != nil {
+			return err
+		}
+
+		p.Deleted = addCounts(p.Deleted, counts)
+		if err = progress(&p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 在一个事务中删除 tenant 的一批数据, 数据删完时同时写入 tenant 的审计记录.
+// tenant 已经被恢复时 done 为 true 且不删除
+func deleteBatch(ctx context.Context, job *server.JobMeta, tenant *server.TenantMeta, src audit.Source, record server.CascadeRecorder, logger *zap.Logger) (counts []server.TableCount, done bool, err error) {
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
+	if err != nil {
+		return nil, false, err
+	}
+	defer uow.End(&err)
+
+	// 与恢复 tenant 互斥, 恢复后不再删除
+	tdao := TenantPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}
+	tdao.ShowDeleted = true
+	var locked []server.TenantMeta
+	locked, err = tdao.Select(&server.TenantMeta{Uuid: tenant.Uuid}, server.LockOption("UPDATE"))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(locked) == 0 || !deletedBy(&locked[0], job) {
+		logger.Info("tenant restored, stop deleting", zap.Int("tenant", tenant.Uuid))
+		return nil, true, nil
+	}
+
+	bc := Cascade{DB: uow.Tx, Logger: logger, Record: record}
+	uow.AfterCommit(bc.Evict)
+	counts, done, err = bc.DeleteBatch(tenant.Uuid, deleteJobBatch, job.CreateTime)
+	if err != nil || !done {
+		return counts, done, err
+	}
+	counts = append(counts, server.TableCount{Table: table, Count: 1})
+
+	return counts, done, audit.Write(uow.Tx, logger, src, audit.Deleted(kind, tenant.Uuid, tenant.Uuid, tenant))
+}
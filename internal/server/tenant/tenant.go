@@ -3,11 +3,14 @@ package tenant
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	pb "github.com/crt379/svc-collector-grpc-proto/tenant"
 	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
 	"github.com/crt379/svc-collector-grpc/internal/server"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
+	"github.com/crt379/svc-collector-grpc/internal/server/job"
 	"github.com/crt379/svc-collector-grpc/internal/storage"
 	"github.com/crt379/svc-collector-grpc/internal/types"
 	"github.com/crt379/svc-collector-grpc/internal/util"
@@ -33,7 +36,7 @@ func (imp *TenantImp) Create(ctx context.Context, req *pb.CreateRequest) (resp *
 		Logger: logger,
 	}
 
-	cache := TenantCache{
+	cache := server.TenantCache{
 		R: storage.ReadRedis,
 		W: storage.WriteRedis,
 	}
@@ -69,10 +72,24 @@ func (imp *TenantImp) Create(ctx context.Context, req *pb.CreateRequest) (resp *
 	tenant.CreateTime = types.Time(time.Now())
 	tenant.UpdateTime = tenant.CreateTime
 
-	tenant.Uuid, err = dao.Insert(&tenant)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&CResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	txdao := TenantPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}
+	if tenant.Uuid, err = txdao.Insert(&tenant); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	tenant.Revision = server.InitRevision
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Created(kind, tenant.Uuid, tenant.Uuid, &tenant)); err != nil {
+		return server.SqlErrResp(&CResp{resp}, err)
+	}
+	if serr := server.SetRevision(ctx, tenant.Uuid, tenant.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+	}
 
 	pbmeta, _ = tenant.ToPbMeta()
 	resp.Tenant = &pbmeta
@@ -98,25 +115,37 @@ func (imp *TenantImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 		Logger: logger,
 	}
 
-	cache := TenantCache{
+	cache := server.TenantCache{
 		R: storage.ReadRedis,
 		W: storage.WriteRedis,
 	}
 
 	resp = new(pb.GetReply)
 
+	if dao.ShowDeleted, err = server.BoolFromMeta(ctx, server.ShowDeletedKey); err != nil {
+		return server.ParamterResp(&GResp{resp}, err.Error())
+	}
+
+	// 缓存中只有没有删除的 tenant
 	if req.Uuid != 0 {
 		one = true
 		tenant.Uuid = int(req.Uuid)
-		rtenant, err = cache.Get(tenant.Uuid)
+		if !dao.ShowDeleted {
+			rtenant, err = cache.Get(tenant.Uuid)
+		}
 	}
 	if req.Name != "" {
 		one = true
 		tenant.Name = req.Name
-		rtenant, err = cache.ZScoreGet(tenant.Name)
+		if !dao.ShowDeleted {
+			rtenant, err = cache.ZScoreGet(tenant.Name)
+		}
 	}
 
-	if one && err == nil {
+	if one && !dao.ShowDeleted && err == nil {
+		if serr := server.SetRevision(ctx, rtenant.Uuid, rtenant.Revision); serr != nil {
+			logger.Warn("SetRevision err", zap.String("error", serr.Error()))
+		}
 		pt, _ := rtenant.ToPbMeta()
 		resp.Tenants = []*pb.TenantMeta{&pt}
 		resp.Count, resp.Total = 1, 1
@@ -133,7 +162,7 @@ func (imp *TenantImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 		if err != nil {
 			return server.SqlErrResp(&GResp{resp}, err)
 		}
-		if one {
+		if one && !dao.ShowDeleted {
 			err = cache.ZAddSet(&tenants)
 			if err != nil {
 				logger.Warn("ZAddSet err", zap.String("error", err.Error()))
@@ -141,6 +170,13 @@ func (imp *TenantImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 		}
 	}
 
+	if serr := server.SetRevisions(ctx, tenants); serr != nil {
+		logger.Warn("SetRevisions err", zap.String("error", serr.Error()))
+	}
+	if serr := server.SetDeleted(ctx, tenants); serr != nil {
+		logger.Warn("SetDeleted err", zap.String("error", serr.Error()))
+	}
+
 	resp.Count, resp.Tenants, _ = server.Metas2Pbmeta[server.TenantMeta, pb.TenantMeta](&tenants)
 	resp.Total = int32(total)
 
@@ -149,8 +185,8 @@ func (imp *TenantImp) Get(ctx context.Context, req *pb.GetRequest) (resp *pb.Get
 
 func (imp *TenantImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *pb.DeleteReply, err error) {
 	var (
-		tenant server.TenantMeta
-		total  int
+		tenant  server.TenantMeta
+		tenants []server.TenantMeta
 	)
 
 	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
@@ -169,30 +205,118 @@ func (imp *TenantImp) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *
 	}
 
 	tenant.Uuid = int(req.Uuid)
-	total, err = dao.Count(&tenant)
+	tenants, err = dao.Select(&tenant)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
 
-	if total == 0 {
+	if len(tenants) == 0 {
 		return server.NotFoundResp(&DResp{resp}, fmt.Sprintf("tenant: %d 不存在", req.Uuid))
 	}
 
-	err = dao.Delete(&tenant)
+	tenant = tenants[0]
+	if err = server.CheckRevision(ctx, tenant.Revision); err != nil {
+		return server.StatusResp(&DResp{resp}, err)
+	}
+
+	var dryrun, async bool
+	if dryrun, err = server.BoolFromMeta(ctx, server.DryRunKey); err != nil {
+		return server.ParamterResp(&DResp{resp}, err.Error())
+	}
+	if async, err = server.BoolFromMeta(ctx, server.AsyncKey); err != nil {
+		return server.ParamterResp(&DResp{resp}, err.Error())
+	}
+
+	var counts []server.TableCount
+	switch {
+	case dryrun:
+		c := Cascade{DB: storage.ReadDB, Logger: logger}
+		counts, err = c.Impact(tenant.Uuid)
+		if err != nil {
+			return server.SqlErrResp(&DResp{resp}, err)
+		}
+		if serr := server.SetHeader(ctx, server.ImpactKey, server.FormatCounts(counts)); serr != nil {
+			logger.Warn("SetHeader err", zap.String("error", serr.Error()))
+		}
+
+		return server.OkResp(&DResp{resp})
+	case async:
+		var jobid int
+		jobid, err = deleteAsync(ctx, &tenant, logger)
+		if err != nil {
+			return server.SqlErrResp(&DResp{resp}, err)
+		}
+		if serr := server.SetHeader(ctx, server.JobIdKey, strconv.Itoa(jobid)); serr != nil {
+			logger.Warn("SetHeader err", zap.String("error", serr.Error()))
+		}
+
+		return server.OkResp(&DResp{resp})
+	}
+
+	// 依赖的数据和 tenant 在同一个事务中删除
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&DResp{resp}, err)
 	}
+	defer uow.End(&err)
+
+	c := Cascade{DB: uow.Tx, Logger: logger, Record: audit.Cascaded(audit.SourceFromContext(ctx), logger, tenant.Uuid, kind, tenant.Uuid)}
+	uow.AfterCommit(c.Evict)
+	// 删除前读到的数据不会再写入缓存
+	uow.AfterCommit(func() {
+		cache := server.TenantCache{
+			R: storage.ReadRedis,
+			W: storage.WriteRedis,
+		}
+		if cerr := cache.Evict(tenant.Uuid, tenant.Revision+1, tenant.Name); cerr != nil {
+			logger.Warn("Evict err", zap.String("error", cerr.Error()))
+		}
+	})
+	if counts, err = c.Delete(&tenant, server.DeleteTime(nil)); err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Deleted(kind, tenant.Uuid, tenant.Uuid, &tenant)); err != nil {
+		return server.SqlErrResp(&DResp{resp}, err)
+	}
+	if serr := server.SetHeader(ctx, server.ImpactKey, server.FormatCounts(counts)); serr != nil {
+		logger.Warn("SetHeader err", zap.String("error", serr.Error()))
+	}
 
-	cache := TenantCache{
-		R: storage.ReadRedis,
-		W: storage.WriteRedis,
+	return server.OkResp(&DResp{resp})
+}
+
+// 创建后台删除的 job, 已有未完成的 job 时返回它的 uuid. job 完成时以请求的操作者写入审计记录
+func deleteAsync(ctx context.Context, tenant *server.TenantMeta, logger *zap.Logger) (uuid int, err error) {
+	dao := job.JobPgDao{
+		W:      storage.WriteDB,
+		R:      storage.WriteDB,
+		Logger: logger,
 	}
-	err = cache.ZRemDel(tenant.Name, tenant.Uuid)
+
+	var jobs []server.JobMeta
+	jobs, err = dao.Select(&server.JobMeta{Kind: DeleteJobKind, Target: tenant.Uuid})
 	if err != nil {
-		logger.Warn("ZRemDel err", zap.String("error", err.Error()))
+		return 0, err
+	}
+	for _, j := range jobs {
+		if j.State == server.JobPending || j.State == server.JobRunning {
+			return j.Uuid, nil
+		}
 	}
 
-	return server.OkResp(&DResp{resp})
+	j := server.JobMeta{
+		Kind:       DeleteJobKind,
+		Target:     tenant.Uuid,
+		TenantId:   tenant.Uuid,
+		State:      server.JobPending,
+		CreateTime: types.Time(time.Now()),
+	}
+	j.UpdateTime = j.CreateTime
+	src := audit.SourceFromContext(ctx)
+	j.Actor, j.TraceId = src.Actor, src.TraceId
+
+	return dao.Insert(&j)
 }
 
 func (imp *TenantImp) Update(ctx context.Context, req *pb.UpdateRequest) (resp *pb.UpdateReply, err error) {
@@ -228,26 +352,57 @@ func (imp *TenantImp) Update(ctx context.Context, req *pb.UpdateRequest) (resp *
 	}
 
 	tenant = tenants[0]
+	before := tenant
+	if err = server.CheckRevision(ctx, tenant.Revision); err != nil {
+		return server.StatusResp(&UResp{resp}, err)
+	}
+
 	newtenant.Name = req.Name
 	newtenant.Describe = req.Describe
 
-	if !util.UpdateValueSame(&newtenant, &tenant) {
+	var isupdate bool
+	isupdate, err = server.MergeUpdate(ctx, req, &newtenant, &tenant, "name", "describe")
+	if err != nil {
+		return server.ParamterResp(&UResp{resp}, err.Error())
+	}
+	if !isupdate {
 		return server.ParamterResp(&UResp{resp}, "没有需要修改的内容")
 	}
+	if tenant.Name == "" {
+		return server.ParamterResp(&UResp{resp}, "name 不能为空")
+	}
+	if util.StrPunctIllegal(tenant.Name, '-') {
+		return server.ParamterResp(&UResp{resp}, "name 不能含有非'-'的字符")
+	}
 
+	// 以读到的 revision 为条件修改, 期间被其他请求修改时返回 Aborted
 	tenant.UpdateTime = types.Time(time.Now())
-	_, err = dao.Update(&tenant)
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, storage.WriteDB, logger)
 	if err != nil {
 		return server.SqlErrResp(&UResp{resp}, err)
 	}
+	defer uow.End(&err)
 
-	cache := TenantCache{
-		R: storage.ReadRedis,
-		W: storage.WriteRedis,
+	txdao := TenantPgDao{W: uow.Tx, R: uow.Tx, Logger: logger}
+	if tenant, err = txdao.Update(&tenant); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
 	}
-	err = cache.ZRemDel(tenant.Name, tenant.Uuid)
-	if err != nil {
-		logger.Warn("ZRemDel err", zap.String("error", err.Error()))
+	if err = audit.Record(ctx, uow.Tx, logger, audit.Updated(kind, tenant.Uuid, tenant.Uuid, &before, &tenant)); err != nil {
+		return server.SqlErrResp(&UResp{resp}, err)
+	}
+	// 修改 name 时旧的 name 也需要删除
+	uow.AfterCommit(func() {
+		cache := server.TenantCache{
+			R: storage.ReadRedis,
+			W: storage.WriteRedis,
+		}
+		if cerr := cache.Evict(tenant.Uuid, tenant.Revision, before.Name, tenant.Name); cerr != nil {
+			logger.Warn("Evict err", zap.String("error", cerr.Error()))
+		}
+	})
+	if serr := server.SetRevision(ctx, tenant.Uuid, tenant.Revision); serr != nil {
+		logger.Warn("SetRevision err", zap.String("error", serr.Error()))
 	}
 
 	pbmeta, _ := tenant.ToPbMeta()
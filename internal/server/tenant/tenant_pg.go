@@ -1,8 +1,9 @@
 package tenant
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/crt379/svc-collector-grpc/internal/server"
 	"github.com/crt379/svc-collector-grpc/internal/types"
@@ -15,17 +16,17 @@ var _ server.IDao[server.TenantMeta] = (*TenantPgDao)(nil)
 
 const (
 	table = "tenant"
+	// 审计记录中的资源类型
+	kind = "tenant"
 )
 
 var (
-	_fields   = [...]string{"uuid", "name", "describe", "create_time", "update_time"}
-	_fields_0 = strings.Join(_fields[:], ",")
-	_fields_1 = strings.Join(_fields[1:], ",")
+	_fields = [...]string{"uuid", "name", "describe", "create_time", "update_time", "revision", "deleted_at"}
 )
 
 type TenantPgDao struct {
-	W      *sqlx.DB
-	R      *sqlx.DB
+	W      server.DB
+	R      server.DB
 	Logger *zap.Logger
 	server.Dao
 	server.DaoLog
@@ -35,20 +36,12 @@ func (d *TenantPgDao) Table() string {
 	return table
 }
 
-func (d *TenantPgDao) fieldsStr(s int) string {
-	switch s {
-	case 0:
-		return _fields_0
-	case 1:
-		return _fields_1
-	}
-	return strings.Join(_fields[s:], ",")
-}
-
 func (d *TenantPgDao) Insert(meta *server.TenantMeta) (uuid int, err error) {
-	args := []any{meta.Name, meta.Describe, meta.CreateTime, meta.UpdateTime}
-
-	query := d.InsertSQL(d.Table(), d.fieldsStr(1), len(args), "uuid")
+	query, args := server.Insert(d.Table()).
+		Columns(_fields[1:]...).
+		Values(meta.Name, meta.Describe, meta.CreateTime, meta.UpdateTime, server.InitRevision, meta.DeletedAt).
+		Returning("uuid").
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).Scan(&uuid)
@@ -57,23 +50,26 @@ func (d *TenantPgDao) Insert(meta *server.TenantMeta) (uuid int, err error) {
 }
 
 func (d *TenantPgDao) Select(meta *server.TenantMeta, ops ...server.DaoOption) (objs []server.TenantMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
 	if meta.Name != "" {
-		k = append(k, "name")
-		args = append(args, meta.Name)
+		cs = append(cs, server.Eq("name", meta.Name))
 	}
 	if meta.Describe != "" {
-		k = append(k, "describe")
-		args = append(args, meta.Describe)
+		cs = append(cs, server.Eq("describe", meta.Describe))
 	}
 
-	query := d.SelectSQL("", d.Table(), d.fieldsStr(0), k)
+	cs = append(cs, d.Alive(d.Table())...)
+
+	query, args := server.Select(_fields[:]...).
+		From(d.Table()).
+		Where(cs...).
+		OrderBy("uuid").
+		Options(ops...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	var rows *sqlx.Rows
@@ -87,19 +83,18 @@ func (d *TenantPgDao) Select(meta *server.TenantMeta, ops ...server.DaoOption) (
 }
 
 func (d *TenantPgDao) Count(meta *server.TenantMeta) (count int, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
 	if meta.Name != "" {
-		k = append(k, "name")
-		args = append(args, meta.Name)
+		cs = append(cs, server.Eq("name", meta.Name))
 	}
 
-	query := d.SelectSQL("", d.Table(), "count(*)", k)
+	cs = append(cs, d.Alive(d.Table())...)
+
+	query, args := server.Select("count(*)").From(d.Table()).Where(cs...).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.R.QueryRowx(query, args...).Scan(&count)
@@ -108,56 +103,69 @@ func (d *TenantPgDao) Count(meta *server.TenantMeta) (count int, err error) {
 }
 
 func (d *TenantPgDao) Delete(meta *server.TenantMeta) (err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
+	cs := make([]server.Cond, 0)
 
 	if meta.Uuid != 0 {
-		k = append(k, "uuid")
-		args = append(args, meta.Uuid)
+		cs = append(cs, server.Eq("uuid", meta.Uuid))
 	}
 	if meta.Name != "" {
-		k = append(k, "name")
-		args = append(args, meta.Name)
+		cs = append(cs, server.Eq("name", meta.Name))
+	}
+	if meta.Revision != 0 {
+		cs = append(cs, server.Eq("revision", meta.Revision))
 	}
-	if len(k) == 0 {
+	if len(cs) == 0 {
 		return nil
 	}
 
-	query := d.DeleteSQL(d.Table(), k)
+	cs = append(cs, server.IsNull(server.DeletedAtCol))
+
+	query, args := server.Update(d.Table()).
+		Set(server.DeletedAtCol, server.DeleteTime(meta.DeletedAt)).
+		Where(cs...).
+		ToSQL()
 	d.Debug(d.Logger, query, args...)
 
-	_, err = d.W.Exec(query, args...)
+	var result sql.Result
+	result, err = d.W.Exec(query, args...)
+	if err != nil || meta.Revision == 0 {
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		err = server.StaleErr(d.W, d.Table(), meta.Uuid)
+	}
 
 	return
 }
 
 func (d *TenantPgDao) Update(meta *server.TenantMeta) (obj server.TenantMeta, err error) {
-	k := make([]string, 0)
-	args := make([]any, 0)
-
 	if meta.Uuid == 0 {
 		return obj, fmt.Errorf("uuid is 0")
 	}
-	if meta.Name != "" {
-		k = append(k, "name")
-		args = append(args, meta.Name)
-	}
-	if meta.Describe != "" {
-		k = append(k, "describe")
-		args = append(args, meta.Describe)
-	}
+
+	// 可修改的列总是写入, 调用方传入完整的对象
+	b := server.Update(d.Table())
+	b.Set("name", meta.Name)
+	b.Set("describe", meta.Describe)
 
 	var zerotime types.Time
 	if meta.UpdateTime != zerotime {
-		k = append(k, "update_time")
-		args = append(args, meta.UpdateTime)
+		b.Set("update_time", meta.UpdateTime)
+	}
+	b.Incr("revision", 1)
+
+	cs := []server.Cond{server.Eq("uuid", meta.Uuid), server.IsNull(server.DeletedAtCol)}
+	if meta.Revision != 0 {
+		cs = append(cs, server.Eq("revision", meta.Revision))
 	}
 
-	args = append(args, meta.Uuid)
-	query := d.UpdateSQL(d.Table(), k, d.fieldsStr(0), []string{"uuid"})
+	query, args := b.Where(cs...).Returning(_fields[:]...).ToSQL()
 	d.Debug(d.Logger, query, args...)
 
 	err = d.W.QueryRowx(query, args...).StructScan(&obj)
+	if errors.Is(err, sql.ErrNoRows) && meta.Revision != 0 {
+		err = server.StaleErr(d.W, d.Table(), meta.Uuid)
+	}
 
 	return obj, err
 }
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/go-redis/redis"
+)
+
+// 写入一个 tenant. KEYS: zset, 数据, revision; ARGV: name, uuid, revision, 数据.
+// revision 小于记录的 revision 时不写入, 避免修改前读到的数据在失效后写回.
+// 同时删除 zset 中同一个 uuid 的其他 name
+var setScript = redis.NewScript(`
+local rev = tonumber(redis.call('GET', KEYS[3]) or '0')
+if tonumber(ARGV[3]) < rev then
+	return 0
+end
+local names = redis.call('ZRANGEBYSCORE', KEYS[1], ARGV[2], ARGV[2])
+for _, name in ipairs(names) do
+	if name ~= ARGV[1] then
+		redis.call('ZREM', KEYS[1], name)
+	end
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('SET', KEYS[2], ARGV[4])
+redis.call('SET', KEYS[3], ARGV[3])
+return 1
+`)
+
+// 删除一个 tenant. KEYS: zset, 数据, revision; ARGV: uuid, revision.
+// 删除 zset 中 uuid 的所有 name, 记录的 revision 只增加
+var evictScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1])
+redis.call('DEL', KEYS[2])
+local rev = tonumber(redis.call('GET', KEYS[3]) or '0')
+if tonumber(ARGV[2]) > rev then
+	redis.call('SET', KEYS[3], ARGV[2])
+end
+return 1
+`)
+
+// zset 中 member 为 name, score 为 uuid; 数据按 uuid 保存. 每个 uuid 记录缓存过的最大 revision,
+// 写入和删除都在 lua 中执行, 修改 name 时旧的 name 一起删除
+type TenantCache struct {
+	R *redis.Client
+	W *redis.Client
+}
+
+func (c *TenantCache) ZKey() string {
+	return "tenant"
+}
+
+func (c *TenantCache) Key(uuid int) string {
+	return fmt.Sprintf("%s-%d", c.ZKey(), uuid)
+}
+
+func (c *TenantCache) RevKey(uuid int) string {
+	return fmt.Sprintf("%s-rev-%d", c.ZKey(), uuid)
+}
+
+// 失效消息中 member 的 key
+func (c *TenantCache) MemberKey(member string) string {
+	return fmt.Sprintf("%s:%s", c.ZKey(), member)
+}
+
+func (c *TenantCache) keys(uuid int) []string {
+	return []string{c.ZKey(), c.Key(uuid), c.RevKey(uuid)}
+}
+
+func (c *TenantCache) ZRank(member string) (int, error) {
+	result, err := c.R.ZRank(c.ZKey(), member).Result()
+	return int(result), err
+}
+
+func (c *TenantCache) ZScore(member string) (int, error) {
+	result, err := c.R.ZScore(c.ZKey(), member).Result()
+	return int(result), err
+}
+
+// 返回是否写入, revision 比缓存过的旧时不写入
+func (c *TenantCache) Set(m *TenantMeta) (bool, error) {
+	buf, err := m.MarshalBinary()
+	if err != nil {
+		return false, err
+	}
+
+	n, err := setScript.Run(c.W, c.keys(m.Uuid), m.Name, m.Uuid, m.Revision, buf).Int()
+	return n == 1, err
+}
+
+func (c *TenantCache) Get(uuid int) (t TenantMeta, err error) {
+	err = c.R.Get(c.Key(uuid)).Scan(&t)
+	return t, err
+}
+
+func (c *TenantCache) ZAddSet(ms *[]TenantMeta) (err error) {
+	for i := range *ms {
+		if _, err = c.Set(&(*ms)[i]); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// 删除 uuid 的数据和所有 name, 并通知所有实例删除 names 和 uuid.
+// revision 为修改后或删除时的 revision, 之前读到的数据不会再写入; 删除时为当前 revision + 1
+func (c *TenantCache) Evict(uuid int, revision int64, names ...string) error {
+	if err := evictScript.Run(c.W, c.keys(uuid), uuid, revision).Err(); err != nil {
+		return err
+	}
+
+	keys := []string{c.Key(uuid)}
+	for _, name := range names {
+		keys = append(keys, c.MemberKey(name))
+	}
+	return Invalidations.Publish(keys...)
+}
+
+// 删除记录的 revision, 恢复被删除的 tenant 后可以再次缓存
+func (c *TenantCache) Forget(uuid int) error {
+	if err := c.Evict(uuid, 0); err != nil {
+		return err
+	}
+	return c.W.Del(c.RevKey(uuid)).Err()
+}
+
+// name 对应的数据, 数据的 name 与 member 不同时返回 redis.Nil
+func (c *TenantCache) ZScoreGet(member string) (t TenantMeta, err error) {
+	tid, err := c.ZScore(member)
+	if err != nil {
+		return t, err
+	}
+
+	t, err = c.Get(tid)
+	if err == nil && t.Name != member {
+		return TenantMeta{}, redis.Nil
+	}
+	return t, err
+}
+
+// 缓存中的 name 和 uuid
+func (c *TenantCache) Members() (map[string]int, error) {
+	zs, err := c.R.ZRangeWithScores(c.ZKey(), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]int, len(zs))
+	for _, z := range zs {
+		name, _ := z.Member.(string)
+		members[name] = int(z.Score)
+	}
+	return members, nil
+}
+
+// uuids 中有缓存数据的 revision
+func (c *TenantCache) Revisions(uuids []int) (map[int]int64, error) {
+	revs := make(map[int]int64)
+	if len(uuids) == 0 {
+		return revs, nil
+	}
+
+	keys := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		keys = append(keys, c.Key(uuid))
+	}
+	vals, err := c.R.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var t TenantMeta
+		if err = t.UnmarshalBinary([]byte(s)); err != nil {
+			// 无法解析的数据按最旧处理
+			revs[uuids[i]] = 0
+			continue
+		}
+		revs[uuids[i]] = t.Revision
+	}
+	return revs, nil
+}
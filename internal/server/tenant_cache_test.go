@@ -0,0 +1,87 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func newTestTenantCache(t *testing.T) *TenantCache {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return &TenantCache{R: client, W: client}
+}
+
+func mustSetTenant(t *testing.T, c *TenantCache, m TenantMeta, want bool) {
+	t.Helper()
+	ok, err := c.Set(&m)
+	if err != nil {
+		t.Fatalf("Set %+v: %v", m, err)
+	}
+	if ok != want {
+		t.Fatalf("Set %+v: got %v, want %v", m, ok, want)
+	}
+}
+
+func TestTenantCacheRename(t *testing.T) {
+	c := newTestTenantCache(t)
+
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "old", Revision: 1}, true)
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "new", Revision: 2}, true)
+
+	if _, err := c.ZScoreGet("old"); err != redis.Nil {
+		t.Fatalf("ZScoreGet old: got %v, want redis.Nil", err)
+	}
+	members, err := c.Members()
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if len(members) != 1 || members["new"] != 1 {
+		t.Fatalf("Members: got %v, want map[new:1]", members)
+	}
+	got, err := c.ZScoreGet("new")
+	if err != nil {
+		t.Fatalf("ZScoreGet new: %v", err)
+	}
+	if got.Uuid != 1 || got.Revision != 2 {
+		t.Fatalf("ZScoreGet new: got %+v", got)
+	}
+}
+
+func TestTenantCacheStaleSet(t *testing.T) {
+	c := newTestTenantCache(t)
+
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "new", Revision: 2}, true)
+	// 修改前读到的数据不会覆盖
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "old", Revision: 1}, false)
+
+	if _, err := c.ZScoreGet("old"); err != redis.Nil {
+		t.Fatalf("ZScoreGet old: got %v, want redis.Nil", err)
+	}
+	got, err := c.Get(1)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Name != "new" || got.Revision != 2 {
+		t.Fatalf("Get: got %+v", got)
+	}
+
+	// 删除后记录的 revision 不降低, 删除前读到的数据不会写回
+	if err = c.Evict(1, 3, "new"); err != nil {
+		t.Fatalf("Evict: %v", err)
+	}
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "new", Revision: 2}, false)
+	if _, err = c.Get(1); err != redis.Nil {
+		t.Fatalf("Get after Evict: got %v, want redis.Nil", err)
+	}
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "new", Revision: 3}, true)
+
+	// Forget 后可以再次缓存恢复的 tenant
+	if err = c.Forget(1); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "new", Revision: 1}, true)
+}
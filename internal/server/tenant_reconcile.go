@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultReconcileInterval = 10 * time.Minute
+
+// 查询未删除的 tenant
+type TenantSelector interface {
+	Select(meta *TenantMeta, ops ...DaoOption) ([]TenantMeta, error)
+}
+
+// 定期比较 redis 中的 tenant 缓存和 pg, 删除 name 或 revision 不一致的缓存
+type TenantReconciler struct {
+	Dao      TenantSelector
+	Cache    *TenantCache
+	Interval time.Duration
+	Logger   *zap.Logger
+}
+
+func (r *TenantReconciler) interval() time.Duration {
+	if r.Interval <= 0 {
+		return defaultReconcileInterval
+	}
+	return r.Interval
+}
+
+// 返回删除的 uuid 数量
+func (r *TenantReconciler) Reconcile(ctx context.Context) (n int, err error) {
+	// 先读缓存, 读 pg 期间写入的缓存不会被误删
+	var members map[string]int
+	if members, err = r.Cache.Members(); err != nil {
+		return n, err
+	}
+
+	var tenants []TenantMeta
+	if tenants, err = r.Dao.Select(&TenantMeta{}); err != nil {
+		return n, err
+	}
+	alive := make(map[int]TenantMeta, len(tenants))
+	uuids := make([]int, 0, len(tenants))
+	for _, t := range tenants {
+		alive[t.Uuid] = t
+		uuids = append(uuids, t.Uuid)
+	}
+
+	// uuid -> 需要通知的 name
+	stale := make(map[int][]string)
+	for name, uuid := range members {
+		if t, ok := alive[uuid]; !ok || t.Name != name {
+			stale[uuid] = append(stale[uuid], name)
+		}
+	}
+
+	var revs map[int]int64
+	if revs, err = r.Cache.Revisions(uuids); err != nil {
+		return n, err
+	}
+	for uuid, rev := range revs {
+		if t := alive[uuid]; rev != t.Revision {
+			stale[uuid] = append(stale[uuid], t.Name)
+		}
+	}
+
+	for uuid, names := range stale {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+		// 已经删除的 tenant 不提高记录的 revision
+		if err = r.Cache.Evict(uuid, alive[uuid].Revision, names...); err != nil {
+			return n, err
+		}
+		r.Logger.Info("tenant cache stale", zap.Int("uuid", uuid), zap.Strings("names", names))
+		n++
+	}
+
+	return n, nil
+}
+
+func (r *TenantReconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		n, err := r.Reconcile(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.Logger.Warn("tenant cache reconcile err", zap.String("error", err.Error()))
+		} else if n > 0 {
+			r.Logger.Info("tenant cache reconcile", zap.Int("count", n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
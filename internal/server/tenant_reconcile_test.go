@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+)
+
+type tenantSelector []TenantMeta
+
+func (s tenantSelector) Select(meta *TenantMeta, ops ...DaoOption) ([]TenantMeta, error) {
+	return s, nil
+}
+
+func TestTenantReconcilerRepairsDrift(t *testing.T) {
+	c := newTestTenantCache(t)
+
+	// 1: revision 落后于 pg; 2: 一致; 3: pg 中已经删除; 4: 一致, 但残留了修改前的 name
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "a", Revision: 1}, true)
+	mustSetTenant(t, c, TenantMeta{Uuid: 2, Name: "b", Revision: 1}, true)
+	mustSetTenant(t, c, TenantMeta{Uuid: 3, Name: "c", Revision: 1}, true)
+	mustSetTenant(t, c, TenantMeta{Uuid: 4, Name: "d", Revision: 2}, true)
+	if err := c.W.ZAdd(c.ZKey(), redis.Z{Score: 4, Member: "d-old"}).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+
+	r := TenantReconciler{
+		Dao: tenantSelector{
+			{Uuid: 1, Name: "a", Revision: 2},
+			{Uuid: 2, Name: "b", Revision: 1},
+			{Uuid: 4, Name: "d", Revision: 2},
+		},
+		Cache:  c,
+		Logger: zap.NewNop(),
+	}
+
+	n, err := r.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("Reconcile: got %d, want 3", n)
+	}
+
+	members, err := c.Members()
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if len(members) != 1 || members["b"] != 2 {
+		t.Fatalf("Members: got %v, want map[b:2]", members)
+	}
+	for _, uuid := range []int{1, 3, 4} {
+		if _, err = c.Get(uuid); err != redis.Nil {
+			t.Fatalf("Get %d: got %v, want redis.Nil", uuid, err)
+		}
+	}
+
+	// 落后的数据不会写回, pg 中的数据可以再次缓存
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "a", Revision: 1}, false)
+	mustSetTenant(t, c, TenantMeta{Uuid: 1, Name: "a", Revision: 2}, true)
+
+	// 再次执行没有需要删除的缓存
+	if n, err = r.Reconcile(context.Background()); err != nil || n != 0 {
+		t.Fatalf("Reconcile again: got %d, %v", n, err)
+	}
+}
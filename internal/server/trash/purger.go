@@ -0,0 +1,169 @@
+package trash
+
+import (
+	"context"
+	"time"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPurgeRetention = 30 * 24 * time.Hour
+	defaultPurgeInterval  = time.Hour
+	defaultPurgeBatch     = 500
+
+	defaultHistoryRetention = 90 * 24 * time.Hour
+)
+
+// 被引用的表在后, 引用它的数据先被清理. 不再被引用的 jdata 由 jdata.Sweeper 清理
+var purgeTables = []string{
+	"processor",
+	"app_svc_relation",
+	"svc_api_example",
+	"service_api",
+	"service",
+	"application",
+	"tenant",
+}
+
+// 有历史版本的表, 见 server.HistorySuffix
+var historyTables = []string{
+	"service",
+	"service_api",
+	"svc_api_example",
+	"app_svc_relation",
+	"processor",
+}
+
+// 定期清理删除时间超过 Retention 的数据, 清理后不能再恢复;
+// 同时清理结束时间超过 HistoryRetention 的历史版本, 只被它们引用的 jdata 之后由 jdata.Sweeper 清理
+type Purger struct {
+	DB               server.DB
+	Retention        time.Duration
+	HistoryRetention time.Duration
+	Interval         time.Duration
+	Batch            int
+	Logger           *zap.Logger
+	server.DaoLog
+}
+
+func (p *Purger) retention() time.Duration {
+	if p.Retention <= 0 {
+		return defaultPurgeRetention
+	}
+	return p.Retention
+}
+
+func (p *Purger) historyRetention() time.Duration {
+	if p.HistoryRetention <= 0 {
+		return defaultHistoryRetention
+	}
+	return p.HistoryRetention
+}
+
+func (p *Purger) interval() time.Duration {
+	if p.Interval <= 0 {
+		return defaultPurgeInterval
+	}
+	return p.Interval
+}
+
+func (p *Purger) batch() int {
+	if p.Batch <= 0 {
+		return defaultPurgeBatch
+	}
+	return p.Batch
+}
+
+// 按表的顺序分批清理, 之后清理历史版本, 返回每个表清理的行数
+func (p *Purger) Purge(ctx context.Context) (counts []server.TableCount, err error) {
+	before := time.Now().Add(-p.retention())
+	for _, table := range purgeTables {
+		var c server.TableCount
+		c, err = p.purgeAll(ctx, table, "uuid", server.Lt(server.DeletedAtCol, before))
+		counts = append(counts, c)
+		if err != nil {
+			return counts, err
+		}
+	}
+
+	// 当前版本的 valid_to 为 NULL, 不会被清理
+	hbefore := time.Now().Add(-p.historyRetention())
+	for _, table := range historyTables {
+		var c server.TableCount
+		c, err = p.purgeAll(ctx, table+server.HistorySuffix, "ctid", server.Lt("valid_to", hbefore))
+		counts = append(counts, c)
+		if err != nil {
+			return counts, err
+		}
+	}
+
+	return counts, nil
+}
+
+// 分批删除 table 中满足 cond 的行, key 为定位行的列, 历史表没有唯一的 uuid, 使用 ctid
+func (p *Purger) purgeAll(ctx context.Context, table string, key string, cond server.Cond) (c server.TableCount, err error) {
+	c.Table = table
+	for {
+		if err = ctx.Err(); err != nil {
+			return c, err
+		}
+
+		var n int
+		n, err = p.purge(table, key, cond)
+		if err != nil {
+			return c, err
+		}
+		c.Count += n
+		if n < p.batch() {
+			return c, nil
+		}
+	}
+}
+
+func (p *Purger) purge(table string, key string, cond server.Cond) (n int, err error) {
+	sub := server.Select(key).
+		From(table).
+		Where(cond).
+		Limit(p.batch()).
+		For("UPDATE SKIP LOCKED")
+
+	query, args := server.Delete(table).Where(server.InQuery(key, sub)).ToSQL()
+	p.Debug(p.Logger, query, args...)
+
+	result, err := p.DB.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	affected, err = result.RowsAffected()
+
+	return int(affected), err
+}
+
+func (p *Purger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval())
+	defer ticker.Stop()
+
+	for {
+		counts, err := p.Purge(ctx)
+		if err != nil {
+			p.Logger.Warn("trash purge err", zap.String("error", err.Error()))
+		}
+		p.Logger.Info(
+			"trash purge",
+			zap.Duration("retention", p.retention()),
+			zap.Duration("history_retention", p.historyRetention()),
+			zap.String("purged", server.FormatCounts(counts)),
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package trash
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type TrashServer interface {
+	Restore(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+func _Trash_Restore_Handler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(structpb.Struct)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrashServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trash.Trash/Restore",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(TrashServer).Restore(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// 接口定义见 proto/trash/trash.proto, Metadata 为相对 proto 目录的路径
+var Trash_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "trash.Trash",
+	HandlerType: (*TrashServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Restore",
+			Handler:    _Trash_Restore_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "trash/trash.proto",
+}
+
+func RegisterServer(srv *grpc.Server) {
+	srv.RegisterService(&Trash_ServiceDesc, &TrashImp{})
+}
@@ -0,0 +1,172 @@
+package trash
+
+import (
+	"context"
+
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	svrapp "github.com/crt379/svc-collector-grpc/internal/server/application"
+	"github.com/crt379/svc-collector-grpc/internal/server/audit"
+	svrsvc "github.com/crt379/svc-collector-grpc/internal/server/service"
+	svrapi "github.com/crt379/svc-collector-grpc/internal/server/svcapi"
+	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+	"github.com/crt379/svc-collector-grpc/internal/types"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// 可以恢复的数据
+type kind struct {
+	name  string
+	table string
+	// 限定数据属于 tenant 且父数据没有被删除, 为 nil 时不需要 tenant
+	scope      func(tenantid int) server.Cond
+	dependents func() []server.Dependent
+	// 恢复后删除 uuid 的缓存, 为 nil 时没有缓存
+	uncache func(logger *zap.Logger, uuid int) error
+}
+
+func tenantIdCond(tenantid int) server.Cond {
+	return server.Eq("tenant_id", tenantid)
+}
+
+// col 引用的 parent 没有被删除
+func parentAlive(col string, parent string) server.Cond {
+	return server.InQuery(col, server.Select("uuid").From(parent).Where(server.IsNull(server.DeletedAtCol)))
+}
+
+var kinds = map[string]kind{
+	"tenant": {
+		name:       "tenant",
+		table:      "tenant",
+		dependents: svrtenant.Dependents,
+		uncache: func(logger *zap.Logger, uuid int) error {
+			cache := server.TenantCache{R: storage.ReadRedis, W: storage.WriteRedis}
+			return cache.Forget(uuid)
+		},
+	},
+	"service": {
+		name:       "service",
+		table:      "service",
+		scope:      tenantIdCond,
+		dependents: svrsvc.Dependents,
+		uncache: func(logger *zap.Logger, uuid int) error {
+			return svrsvc.Cache(logger).Del(uuid)
+		},
+	},
+	"svcapi": {
+		name:  "svcapi",
+		table: "service_api",
+		scope: func(tenantid int) server.Cond {
+			return server.And(tenantIdCond(tenantid), parentAlive("sid", "service"))
+		},
+		dependents: svrapi.Dependents,
+		uncache: func(logger *zap.Logger, uuid int) error {
+			return svrapi.Cache(logger).Del(uuid)
+		},
+	},
+	"svcapieg": {
+		name:  "svcapieg",
+		table: "svc_api_example",
+		scope: func(tenantid int) server.Cond {
+			return server.And(tenantIdCond(tenantid), parentAlive("aid", "service_api"))
+		},
+	},
+	"application": {
+		name:       "application",
+		table:      "application",
+		scope:      tenantIdCond,
+		dependents: svrapp.Dependents,
+		uncache: func(logger *zap.Logger, uuid int) error {
+			return svrapp.Cache(logger).Del(uuid)
+		},
+	},
+	"appsvc": {
+		name:  "appsvc",
+		table: "app_svc_relation",
+		scope: func(tenantid int) server.Cond {
+			return server.And(
+				server.InQuery("aid", server.Select("uuid").From("application").Where(tenantIdCond(tenantid), server.IsNull(server.DeletedAtCol))),
+				parentAlive("sid", "service"),
+			)
+		},
+	},
+	"processor": {
+		name:  "processor",
+		table: "processor",
+		scope: func(tenantid int) server.Cond {
+			return server.And(tenantIdCond(tenantid), parentAlive("aid", "application"))
+		},
+	},
+}
+
+// 在一个事务中恢复 uuid 和与它一起被级联删除的数据, 返回每个表恢复的行数.
+// 数据不存在或父数据已经被删除时返回 sql.ErrNoRows, 没有被删除时返回 server.ErrNotDeleted
+func (k *kind) restore(ctx context.Context, db *sqlx.DB, logger *zap.Logger, tenantid int, uuid int) (counts []server.TableCount, err error) {
+	var dl server.DaoLog
+
+	cs := []server.Cond{server.Eq("uuid", uuid)}
+	if k.scope != nil {
+		cs = append(cs, k.scope(tenantid))
+	}
+
+	var uow *server.UnitOfWork
+	uow, err = server.BeginUnitOfWork(ctx, db, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer uow.End(&err)
+
+	query, args := server.Select(server.DeletedAtCol).From(k.table).Where(cs...).For("UPDATE").ToSQL()
+	dl.Debug(logger, query, args...)
+
+	var at *types.Time
+	if err = uow.Tx.QueryRowx(query, args...).Scan(&at); err != nil {
+		return nil, err
+	}
+	if at == nil {
+		return nil, server.ErrNotDeleted
+	}
+
+	query, args = server.Update(k.table).Set(server.DeletedAtCol, nil).Where(server.Eq("uuid", uuid)).ToSQL()
+	dl.Debug(logger, query, args...)
+
+	if _, err = uow.Tx.Exec(query, args...); err != nil {
+		return nil, err
+	}
+	counts = []server.TableCount{{Table: k.table, Count: 1}}
+	if k.uncache != nil {
+		uow.AfterCommit(func() {
+			if cerr := k.uncache(logger, uuid); cerr != nil {
+				logger.Warn("cache del err", zap.String("error", cerr.Error()))
+			}
+		})
+	}
+
+	if k.scope == nil {
+		tenantid = uuid
+	}
+	if k.dependents != nil {
+		record := audit.Cascaded(audit.SourceFromContext(ctx), logger, tenantid, k.name, uuid)
+		deps := &server.Dependents{DB: uow.Tx, Logger: logger, List: k.dependents(), Record: record}
+		// 一起恢复的数据可能有不存在的负缓存
+		uow.AfterCommit(deps.Evict)
+		var dcounts []server.TableCount
+		dcounts, err = deps.Restore(uuid, *at)
+		counts = append(counts, dcounts...)
+		if err != nil {
+			return counts, err
+		}
+	}
+
+	err = audit.Record(ctx, uow.Tx, logger, audit.Change{
+		Kind:     k.name,
+		Action:   audit.ActionRestore,
+		TenantId: tenantid,
+		Target:   uuid,
+		After:    counts,
+	})
+
+	return counts, err
+}
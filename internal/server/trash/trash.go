@@ -0,0 +1,111 @@
+package trash
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/crt379/svc-collector-grpc/internal/auth"
+	"github.com/crt379/svc-collector-grpc/internal/ctxvalue"
+	"github.com/crt379/svc-collector-grpc/internal/server"
+	svrtenant "github.com/crt379/svc-collector-grpc/internal/server/tenant"
+	"github.com/crt379/svc-collector-grpc/internal/storage"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type TrashImp struct{}
+
+var _ TrashServer = (*TrashImp)(nil)
+
+func kindNames() string {
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// 恢复 tenant 需要 super-admin, 或认证的身份属于该 tenant. 没有启用认证时 context 中没有身份, 不能恢复 tenant
+func checkTenantOwner(ctx context.Context, logger *zap.Logger, uuid int) error {
+	if auth.IsSuperAdmin(ctx) {
+		return nil
+	}
+	denied := server.PermissionDeniedErr("只有 super-admin 或 tenant 自己可以恢复 tenant")
+
+	id, ok := ctxvalue.IdentityContext{}.GetValue(ctx)
+	if !ok {
+		return denied
+	}
+
+	dao := svrtenant.TenantPgDao{
+		W:      storage.WriteDB,
+		R:      storage.WriteDB,
+		Logger: logger,
+	}
+	dao.ShowDeleted = true
+
+	tenants, err := dao.Select(&server.TenantMeta{Uuid: uuid})
+	if err != nil {
+		return server.SqlErr(err)
+	}
+	if len(tenants) == 0 || tenants[0].Name != id.Tenant {
+		return denied
+	}
+
+	return nil
+}
+
+// 请求 {"kind": "service", "uuid": 1}, 响应 {"code": 10000, "message": "success", "restored": {"service": 1, ...}}.
+// 除 tenant 外需要 x-access-tenant, tenant 见 checkTenantOwner. 响应 header ImpactKey 为每个表恢复的行数
+func (imp *TrashImp) Restore(ctx context.Context, req *structpb.Struct) (resp *structpb.Struct, err error) {
+	logger, _ := ctxvalue.LoggerContext{}.GetValue(ctx)
+	logger.Info("TrashImp Restore")
+
+	resp = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+
+	name := req.GetFields()["kind"].GetStringValue()
+	k, ok := kinds[name]
+	if !ok {
+		return server.ParamterResp(&RResp{resp}, fmt.Sprintf("kind 只能为: %s", kindNames()))
+	}
+
+	uuid := int(req.GetFields()["uuid"].GetNumberValue())
+	if uuid <= 0 {
+		return server.NotFoundResp(&RResp{resp}, fmt.Sprintf("%s: %d 不存在", name, uuid))
+	}
+
+	var tenant server.TenantMeta
+	if k.scope != nil {
+		tenant, err = svrtenant.CheckByMeta(ctx)
+	} else {
+		err = checkTenantOwner(ctx, logger, uuid)
+	}
+	if err != nil {
+		return server.StatusResp(&RResp{resp}, err)
+	}
+
+	var counts []server.TableCount
+	counts, err = k.restore(ctx, storage.WriteDB, logger, tenant.Uuid, uuid)
+	if err != nil {
+		return server.SqlErrResp(&RResp{resp}, err)
+	}
+	if serr := server.SetHeader(ctx, server.ImpactKey, server.FormatCounts(counts)); serr != nil {
+		logger.Warn("SetHeader err", zap.String("error", serr.Error()))
+	}
+
+	restored := make(map[string]any, len(counts))
+	for _, c := range counts {
+		restored[c.Table] = c.Count
+	}
+	var v *structpb.Value
+	if v, err = structpb.NewValue(restored); err != nil {
+		return server.InternalResp(&RResp{resp}, err)
+	}
+	resp.Fields["restored"] = v
+
+	return server.OkResp(&RResp{resp})
+}
@@ -0,0 +1,26 @@
+package trash
+
+import (
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// trash 服务没有 proto 定义, 请求和响应都使用 google.protobuf.Struct
+type RResp struct {
+	*structpb.Struct
+}
+
+func (r *RResp) SetCode(code int32) {
+	r.Fields["code"] = structpb.NewNumberValue(float64(code))
+}
+
+func (r *RResp) SetMessage(msg string) {
+	r.Fields["message"] = structpb.NewStringValue(msg)
+}
+
+func (r *RResp) GetMessage() string {
+	return r.Fields["message"].GetStringValue()
+}
+
+func (r *RResp) GetPBResp() *structpb.Struct {
+	return r.Struct
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// *sqlx.DB 和 *sqlx.Tx 都实现了该接口, dao 通过它在连接池和事务之间切换
+type DB interface {
+	sqlx.Queryer
+	sqlx.Execer
+}
+
+var (
+	_ DB = (*sqlx.DB)(nil)
+	_ DB = (*sqlx.Tx)(nil)
+)
+
+// 多个 dao 共享同一个事务, 由 End 根据 rpc 的结果提交或回滚. 所有写入事务都使用它,
+// 提交后才能执行的操作 (如删除缓存) 通过 AfterCommit 注册
+type UnitOfWork struct {
+	Tx     *sqlx.Tx
+	Logger *zap.Logger
+
+	after []func()
+}
+
+func BeginUnitOfWork(ctx context.Context, db *sqlx.DB, logger *zap.Logger) (*UnitOfWork, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UnitOfWork{Tx: tx, Logger: logger}, nil
+}
+
+// 配合 defer 使用: *err 为 nil 时提交, 否则回滚; panic 时回滚后继续 panic
+func (u *UnitOfWork) End(err *error) {
+	if r := recover(); r != nil {
+		u.rollback()
+		panic(r)
+	}
+
+	if *err != nil {
+		u.rollback()
+		return
+	}
+
+	if cerr := u.Tx.Commit(); cerr != nil {
+		*err = SqlErr(cerr)
+		return
+	}
+	for _, f := range u.after {
+		f()
+	}
+}
+
+// 提交成功后按注册的顺序执行 f, 回滚时不执行
+func (u *UnitOfWork) AfterCommit(f func()) {
+	u.after = append(u.after, f)
+}
+
+func (u *UnitOfWork) rollback() {
+	err := u.Tx.Rollback()
+	if err != nil && !errors.Is(err, sql.ErrTxDone) && u.Logger != nil {
+		u.Logger.Warn("rollback err", zap.String("error", err.Error()))
+	}
+}
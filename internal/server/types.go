@@ -17,6 +17,7 @@ import (
 
 	"github.com/golang/protobuf/ptypes/timestamp"
 	jsoniter "github.com/json-iterator/go"
+	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -52,11 +53,21 @@ func Metas2Pbmeta[T any, PT any, TP TPBMeta[T, PT]](metas *[]T) (l int32, pbmeta
 }
 
 type TenantMeta struct {
-	Uuid       int        `json:"uuid" db:"uuid"`
-	Name       string     `json:"name" db:"name"`
-	Describe   string     `json:"describe" db:"describe"`
-	CreateTime types.Time `json:"create_time" db:"create_time"`
-	UpdateTime types.Time `json:"update_time" db:"update_time"`
+	Uuid       int         `json:"uuid" db:"uuid"`
+	Name       string      `json:"name" db:"name"`
+	Describe   string      `json:"describe" db:"describe"`
+	CreateTime types.Time  `json:"create_time" db:"create_time"`
+	UpdateTime types.Time  `json:"update_time" db:"update_time"`
+	Revision   int64       `json:"revision" db:"revision"`
+	DeletedAt  *types.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+func (m *TenantMeta) revision() (int, int64) {
+	return m.Uuid, m.Revision
+}
+
+func (m *TenantMeta) deletedAt() (int, *types.Time) {
+	return m.Uuid, m.DeletedAt
 }
 
 func (m *TenantMeta) ToPbMeta() (pbtenant.TenantMeta, error) {
@@ -78,12 +89,22 @@ func (m *TenantMeta) UnmarshalBinary(data []byte) error {
 }
 
 type ServiceMeta struct {
-	Uuid       int        `json:"uuid" db:"uuid"`
-	Name       string     `json:"name" db:"name"`
-	Describe   string     `json:"describe" db:"describe"`
-	CreateTime types.Time `json:"create_time" db:"create_time"`
-	UpdateTime types.Time `json:"update_time" db:"update_time"`
-	TenantId   int        `json:"tenant_id" db:"tenant_id"`
+	Uuid       int         `json:"uuid" db:"uuid"`
+	Name       string      `json:"name" db:"name"`
+	Describe   string      `json:"describe" db:"describe"`
+	CreateTime types.Time  `json:"create_time" db:"create_time"`
+	UpdateTime types.Time  `json:"update_time" db:"update_time"`
+	Revision   int64       `json:"revision" db:"revision"`
+	DeletedAt  *types.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	TenantId   int         `json:"tenant_id" db:"tenant_id"`
+}
+
+func (m *ServiceMeta) revision() (int, int64) {
+	return m.Uuid, m.Revision
+}
+
+func (m *ServiceMeta) deletedAt() (int, *types.Time) {
+	return m.Uuid, m.DeletedAt
 }
 
 func (m *ServiceMeta) ToPbMeta() (pbservice.ServiceMeta, error) {
@@ -106,14 +127,24 @@ func (m *ServiceMeta) UnmarshalBinary(data []byte) error {
 }
 
 type SvcapiMeta struct {
-	Uuid       int        `json:"uuid" db:"uuid"`
-	Path       string     `json:"path" db:"path"`
-	Method     string     `json:"method" db:"method"`
-	Describe   string     `json:"describe" db:"describe"`
-	CreateTime types.Time `json:"create_time" db:"create_time"`
-	UpdateTime types.Time `json:"update_time" db:"update_time"`
-	ServiceId  int        `json:"service_id" db:"sid"`
-	TenantId   int        `json:"tenant_id" db:"tenant_id"`
+	Uuid       int         `json:"uuid" db:"uuid"`
+	Path       string      `json:"path" db:"path"`
+	Method     string      `json:"method" db:"method"`
+	Describe   string      `json:"describe" db:"describe"`
+	CreateTime types.Time  `json:"create_time" db:"create_time"`
+	UpdateTime types.Time  `json:"update_time" db:"update_time"`
+	Revision   int64       `json:"revision" db:"revision"`
+	DeletedAt  *types.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	ServiceId  int         `json:"service_id" db:"sid"`
+	TenantId   int         `json:"tenant_id" db:"tenant_id"`
+}
+
+func (m *SvcapiMeta) revision() (int, int64) {
+	return m.Uuid, m.Revision
+}
+
+func (m *SvcapiMeta) deletedAt() (int, *types.Time) {
+	return m.Uuid, m.DeletedAt
 }
 
 func (m *SvcapiMeta) ToPbMeta() (pbsvcapi.SvcapiMeta, error) {
@@ -130,14 +161,24 @@ func (m *SvcapiMeta) ToPbMeta() (pbsvcapi.SvcapiMeta, error) {
 }
 
 type SvcapiegMeta struct {
-	Uuid       int        `json:"uuid" db:"uuid"`
-	Data       any        `json:"data" db:"data"`
-	CreateTime types.Time `json:"create_time" db:"create_time"`
-	UpdateTime types.Time `json:"update_time" db:"update_time"`
-	SvcapiId   int        `json:"svcapi_id" db:"aid"`
-	ServiceId  int        `json:"service_id" db:"-"`
-	TenantId   int        `json:"tenant_id" db:"tenant_id"`
-	JdataId    int        `json:"-" db:"jid"`
+	Uuid       int         `json:"uuid" db:"uuid"`
+	Data       any         `json:"data" db:"data"`
+	CreateTime types.Time  `json:"create_time" db:"create_time"`
+	UpdateTime types.Time  `json:"update_time" db:"update_time"`
+	Revision   int64       `json:"revision" db:"revision"`
+	DeletedAt  *types.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	SvcapiId   int         `json:"svcapi_id" db:"aid"`
+	ServiceId  int         `json:"service_id" db:"-"`
+	TenantId   int         `json:"tenant_id" db:"tenant_id"`
+	JdataId    int         `json:"-" db:"jid"`
+}
+
+func (m *SvcapiegMeta) revision() (int, int64) {
+	return m.Uuid, m.Revision
+}
+
+func (m *SvcapiegMeta) deletedAt() (int, *types.Time) {
+	return m.Uuid, m.DeletedAt
 }
 
 func (m *SvcapiegMeta) DataToMap() error {
@@ -200,12 +241,22 @@ type Jdata struct {
 }
 
 type ApplicationMeta struct {
-	Uuid       int        `json:"uuid" db:"uuid"`
-	Name       string     `json:"name" db:"name"`
-	Describe   string     `json:"describe" db:"describe"`
-	CreateTime types.Time `json:"create_time" db:"create_time"`
-	UpdateTime types.Time `json:"update_time" db:"update_time"`
-	TenantId   int        `json:"tenant_id" db:"tenant_id"`
+	Uuid       int         `json:"uuid" db:"uuid"`
+	Name       string      `json:"name" db:"name"`
+	Describe   string      `json:"describe" db:"describe"`
+	CreateTime types.Time  `json:"create_time" db:"create_time"`
+	UpdateTime types.Time  `json:"update_time" db:"update_time"`
+	Revision   int64       `json:"revision" db:"revision"`
+	DeletedAt  *types.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	TenantId   int         `json:"tenant_id" db:"tenant_id"`
+}
+
+func (m *ApplicationMeta) revision() (int, int64) {
+	return m.Uuid, m.Revision
+}
+
+func (m *ApplicationMeta) deletedAt() (int, *types.Time) {
+	return m.Uuid, m.DeletedAt
 }
 
 func (m *ApplicationMeta) ToPbMeta() (pbapp.ApplicationMete, error) {
@@ -225,10 +276,15 @@ type AppsvcMeta struct {
 	SvcId      int         `json:"svcid" db:"sid"`
 	CreateTime types.Time  `json:"create_time" db:"create_time"`
 	UpdateTime types.Time  `json:"update_time" db:"update_time"`
+	DeletedAt  *types.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 	Service    ServiceMeta `json:"service" db:"-"`
 	SvcName    string      `json:"-" db:"-"`
 }
 
+func (m *AppsvcMeta) deletedAt() (int, *types.Time) {
+	return m.Uuid, m.DeletedAt
+}
+
 func (m *AppsvcMeta) ToPbMeta() (pbappsvc.AppsvcMeta, error) {
 	svc, _ := m.Service.ToPbMeta()
 	return pbappsvc.AppsvcMeta{
@@ -242,14 +298,24 @@ func (m *AppsvcMeta) ToPbMeta() (pbappsvc.AppsvcMeta, error) {
 }
 
 type ProcessorMeta struct {
-	Uuid       int        `json:"uuid" db:"uuid"`
-	Addr       string     `json:"addr" db:"addr"`
-	Weight     int        `json:"weight" db:"weight"`
-	State      string     `json:"state" db:"state"`
-	CreateTime types.Time `json:"create_time" db:"create_time"`
-	UpdateTime types.Time `json:"update_time" db:"update_time"`
-	AppId      int        `json:"aid" db:"aid"`
-	TanantId   int        `json:"tenant_id" db:"tenant_id"`
+	Uuid       int         `json:"uuid" db:"uuid"`
+	Addr       string      `json:"addr" db:"addr"`
+	Weight     int         `json:"weight" db:"weight"`
+	State      string      `json:"state" db:"state"`
+	CreateTime types.Time  `json:"create_time" db:"create_time"`
+	UpdateTime types.Time  `json:"update_time" db:"update_time"`
+	Revision   int64       `json:"revision" db:"revision"`
+	DeletedAt  *types.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	AppId      int         `json:"aid" db:"aid"`
+	TanantId   int         `json:"tenant_id" db:"tenant_id"`
+}
+
+func (m *ProcessorMeta) revision() (int, int64) {
+	return m.Uuid, m.Revision
+}
+
+func (m *ProcessorMeta) deletedAt() (int, *types.Time) {
+	return m.Uuid, m.DeletedAt
 }
 
 func (m *ProcessorMeta) ToPbMeta() (pbprocessor.ProcessorMeta, error) {
@@ -316,3 +382,143 @@ func (m *AppprocMeta) ToPbMeta() (pbappproc.AppprocMeta, error) {
 		Processors:  procs,
 	}, err
 }
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+type JobMeta struct {
+	Uuid   int    `json:"uuid" db:"uuid"`
+	Kind   string `json:"kind" db:"kind"`
+	Target int    `json:"target" db:"target"`
+	State  string `json:"state" db:"state"`
+	// json 文本, 由 job 的处理函数写入
+	Progress   string     `json:"progress" db:"progress"`
+	Error      string     `json:"error" db:"error"`
+	CreateTime types.Time `json:"create_time" db:"create_time"`
+	UpdateTime types.Time `json:"update_time" db:"update_time"`
+	// 创建 job 的请求的操作者和 trace id, 用于审计记录
+	Actor   string `json:"actor" db:"actor"`
+	TraceId string `json:"trace_id" db:"trace_id"`
+	// 创建 job 的 tenant
+	TenantId int `json:"tenant_id" db:"tenant_id"`
+}
+
+func (m *JobMeta) ToStruct() (*structpb.Struct, error) {
+	var progress any
+	if m.Progress != "" {
+		if err := json.Unmarshal([]byte(m.Progress), &progress); err != nil {
+			return nil, err
+		}
+	}
+
+	return structpb.NewStruct(map[string]any{
+		"uuid":        m.Uuid,
+		"kind":        m.Kind,
+		"target":      m.Target,
+		"tenant_id":   m.TenantId,
+		"state":       m.State,
+		"progress":    progress,
+		"error":       m.Error,
+		"create_time": m.CreateTime.String(),
+		"update_time": m.UpdateTime.String(),
+	})
+}
+
+type AuditMeta struct {
+	Uuid     int    `json:"uuid" db:"uuid"`
+	Actor    string `json:"actor" db:"actor"`
+	TenantId int    `json:"tenant_id" db:"tenant_id"`
+	// 资源类型, 如 service, svcapi
+	Kind   string `json:"kind" db:"kind"`
+	Target int    `json:"target" db:"target"`
+	Action string `json:"action" db:"action"`
+	// 修改前后的数据的 json 文本, 创建时 Before 为 nil, 删除时 After 为 nil
+	Before     *string    `json:"before" db:"before"`
+	After      *string    `json:"after" db:"after"`
+	TraceId    string     `json:"trace_id" db:"trace_id"`
+	CreateTime types.Time `json:"create_time" db:"create_time"`
+}
+
+func (m *AuditMeta) ToStruct() (*structpb.Struct, error) {
+	var before, after any
+	if m.Before != nil {
+		if err := json.Unmarshal([]byte(*m.Before), &before); err != nil {
+			return nil, err
+		}
+	}
+	if m.After != nil {
+		if err := json.Unmarshal([]byte(*m.After), &after); err != nil {
+			return nil, err
+		}
+	}
+
+	return structpb.NewStruct(map[string]any{
+		"uuid":        m.Uuid,
+		"actor":       m.Actor,
+		"tenant_id":   m.TenantId,
+		"kind":        m.Kind,
+		"target":      m.Target,
+		"action":      m.Action,
+		"before":      before,
+		"after":       after,
+		"trace_id":    m.TraceId,
+		"create_time": m.CreateTime.String(),
+	})
+}
+
+// 变更事件, 和修改在同一个事务中写入 outbox, 由 outbox.Relay 发布
+type OutboxEvent struct {
+	// 写入时分配, 事务提交的顺序可能不同, 只用于去重. 发布的顺序为 stream 的 entry id
+	Seq      int64  `json:"seq" db:"seq"`
+	Kind     string `json:"kind" db:"kind"`
+	Action   string `json:"action" db:"action"`
+	TenantId int    `json:"tenant_id" db:"tenant_id"`
+	Target   int    `json:"target" db:"target"`
+
+	Actor       string      `json:"actor" db:"actor"`
+	TraceId     string      `json:"trace_id" db:"trace_id"`
+	CreateTime  types.Time  `json:"create_time" db:"create_time"`
+	PublishTime *types.Time `json:"publish_time,omitempty" db:"publish_time"`
+}
+
+// 发布到 redis stream 的字段
+func (m *OutboxEvent) StreamValues() map[string]any {
+	return map[string]any{
+		"seq":         m.Seq,
+		"kind":        m.Kind,
+		"action":      m.Action,
+		"tenant_id":   m.TenantId,
+		"target":      m.Target,
+		"actor":       m.Actor,
+		"trace_id":    m.TraceId,
+		"create_time": m.CreateTime.String(),
+	}
+}
+
+// tenant 的 api key, 只保存 key 的 sha256
+type ApiKeyMeta struct {
+	Uuid       int         `json:"uuid" db:"uuid"`
+	TenantId   int         `json:"tenant_id" db:"tenant_id"`
+	Name       string      `json:"name" db:"name"`
+	Prefix     string      `json:"prefix" db:"prefix"`
+	KeyHash    string      `json:"-" db:"key_hash"`
+	CreateTime types.Time  `json:"create_time" db:"create_time"`
+	ExpireTime *types.Time `json:"expire_time,omitempty" db:"expire_time"`
+	RevokeTime *types.Time `json:"revoke_time,omitempty" db:"revoke_time"`
+	// 查询时关联的 tenant 名称
+	TenantName string `json:"tenant_name" db:"tenant_name"`
+}
+
+type RoleBindingMeta struct {
+	Uuid       int        `json:"uuid" db:"uuid"`
+	TenantId   int        `json:"tenant_id" db:"tenant_id"`
+	Principal  string     `json:"principal" db:"principal"`
+	Role       string     `json:"role" db:"role"`
+	CreateTime types.Time `json:"create_time" db:"create_time"`
+	// 查询时关联的 tenant 名称
+	TenantName string `json:"tenant_name" db:"tenant_name"`
+}
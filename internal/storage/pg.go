@@ -29,8 +29,7 @@ func init() {
 		log.Panicf(err.Error())
 	}
 
-	WriteDB.SetMaxOpenConns(20)
-	WriteDB.SetMaxIdleConns(10)
+	setPool(WriteDB, config.AppConfig.PgSql.Pool)
 
 	if config.AppConfig.PgSql.Read.Port == "" {
 		ReadDB = WriteDB
@@ -46,11 +45,26 @@ func init() {
 			log.Panicf(err.Error())
 		}
 
-		ReadDB.SetMaxOpenConns(20)
-		ReadDB.SetMaxIdleConns(10)
+		setPool(ReadDB, config.AppConfig.PgSql.Pool)
 	}
 }
 
+// 没有配置时最多 20 个连接, 10 个空闲连接
+func setPool(db *sqlx.DB, pool config.PoolConfig) {
+	maxOpen, maxIdle := pool.MaxOpen, pool.MaxIdle
+	if maxOpen <= 0 {
+		maxOpen = 20
+	}
+	if maxIdle <= 0 {
+		maxIdle = 10
+	}
+
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(pool.MaxLifetime)
+	db.SetConnMaxIdleTime(pool.MaxIdleTime)
+}
+
 func NewPgConnect(host, port, user, password, database string) (*sqlx.DB, error) {
 	s := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s", host, port, user, password, database)
 	db, err := sqlx.Connect("pgx", s)
@@ -3,6 +3,7 @@ package util
 import (
 	"net"
 	"reflect"
+	"strings"
 	"unicode"
 )
 
@@ -101,6 +102,45 @@ func UpdateValueSame[T any](newobj T, obj T) (isupdate bool) {
 	return
 }
 
+// 根据 newobj 修改 obj 中 json tag 在 paths 中的字段, 零值也会写入, 要求obj 和 newobj 类型要一致
+func UpdateValueMask[T any](newobj T, obj T, paths []string) (isupdate bool) {
+	t1 := reflect.TypeOf(newobj)
+	v1 := reflect.ValueOf(newobj)
+	if t1.Kind() != reflect.Ptr {
+		return false
+	}
+
+	t1 = t1.Elem()
+	v1 = v1.Elem()
+	if t1.Kind() != reflect.Struct {
+		return false
+	}
+
+	masked := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		masked[p] = true
+	}
+
+	v2 := reflect.ValueOf(obj).Elem()
+	for i := 0; i < t1.NumField(); i++ {
+		name, _, _ := strings.Cut(t1.Field(i).Tag.Get("json"), ",")
+		if !masked[name] {
+			continue
+		}
+
+		v2v := v2.Field(i)
+		if v2v.IsValid() && v2v.CanSet() {
+			v1v := v1.Field(i)
+			if !v1v.Equal(v2v) {
+				v2v.Set(v1v)
+				isupdate = true
+			}
+		}
+	}
+
+	return
+}
+
 // 判断 s1 是不是 s2 的前缀
 func StrInStrBegin(s1, s2 string) bool {
 	if len(s2) < len(s1) {